@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/app"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// TODO: add docker-compose file
+// TODO: find a way to convert content to utf-8
+
+// runCrawl crawls until it is interrupted or crawler.duration passed. With
+// --replay or --rank it does that one job instead and exits.
+func runCrawl(o *options, args []string) error {
+	fs := o.flagSet("crawl")
+	replay := fs.String("replay", "", "parse and store the WARC files in this directory instead of crawling")
+	ranks := fs.Bool("rank", false, "compute link ranks from the stored link graph and exit")
+	logLevel := fs.String("log-level", "info", "minimum level of the crawl log: debug, info, warn or error")
+	fs.Parse(args)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return fmt.Errorf("log-level: %s", err.Error())
+	}
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	app, err := app.NewApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(app.Cfg.Log.Path, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	app.Logger = slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+	}))
+
+	if *replay != "" {
+		log.Printf("Replaying %s...", *replay)
+		if err := app.Replay(*replay); err != nil {
+			log.Print(err.Error())
+		}
+		if err := app.Shutdown(app.Cfg.Crawler.ShutdownTimeout); err != nil {
+			log.Print(err.Error())
+		}
+		log.Printf("Records replayed: %d\nErrors made: %d\n",
+			app.Count.Load(), app.ErrCount.Load())
+		return nil
+	}
+
+	if *ranks {
+		log.Printf("Computing ranks...")
+		if err := app.ComputeRanks(); err != nil {
+			log.Print(err.Error())
+		}
+		if err := app.Shutdown(app.Cfg.Crawler.ShutdownTimeout); err != nil {
+			log.Print(err.Error())
+		}
+		return nil
+	}
+
+	if err := app.RestoreFrontier(); err != nil {
+		log.Print(err.Error())
+	}
+	app.BlockRoutine()
+	app.CrawlRoutine()
+	app.SpillRoutine()
+	app.LimitRoutine()
+	app.SeedRoutine()
+	app.FeedRoutine()
+	app.RankRoutine()
+	app.Run()
+	longTicker := time.NewTicker(time.Second * 100)
+	shortTicker := time.NewTicker(time.Second * 10)
+	go func() {
+		count := 1
+		for range longTicker.C {
+			log.Printf("Total requests made in %d s: %d\nErrors made: %d\nLinks spilled: %d, dropped: %d\n",
+				count*100, app.Count.Load(), app.ErrCount.Load(), app.Spilled.Load(), app.Dropped.Load())
+			log.Printf("Pages written: %d, write failures: %d\n",
+				app.PageWriter.Written.Load(), app.PageWriter.Failed.Load())
+			if app.IndexWriter != nil {
+				log.Printf("Pages indexed: %d, index failures: %d\n",
+					app.IndexWriter.Written.Load(), app.IndexWriter.Failed.Load())
+			}
+			for _, s := range app.Processors.Stats() {
+				log.Printf("Processor %s: processed %d, dropped %d, failed %d, took %s\n",
+					s.Name, s.Processed, s.Dropped, s.Failed, s.Duration)
+			}
+			count++
+		}
+	}()
+	go func() {
+		for range shortTicker.C {
+			log.Printf("Total request made: %d\nErrors made: %d\n",
+				app.Count.Load(), app.ErrCount.Load())
+		}
+	}()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if app.Cfg.Crawler.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.Cfg.Crawler.Duration)
+		defer cancel()
+	}
+
+	log.Printf("Running...")
+	<-ctx.Done()
+	longTicker.Stop()
+	shortTicker.Stop()
+
+	log.Printf("Shutting down...")
+	if err := app.Shutdown(app.Cfg.Crawler.ShutdownTimeout); err != nil {
+		log.Print(err.Error())
+	}
+	log.Printf("Total request made: %d\nErrors made: %d\n",
+		app.Count.Load(), app.ErrCount.Load())
+	return nil
+}
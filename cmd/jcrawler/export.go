@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"io"
+	"os"
+)
+
+// runExport writes every stored page as one JSON object per line, to
+// --out or to stdout.
+func runExport(o *options, args []string) error {
+	fs := o.flagSet("export")
+	out := fs.String("out", "", "file to write to instead of stdout")
+	fs.Parse(args)
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("export: %s", err.Error())
+	}
+	defer store.CloseConnection()
+
+	var dst io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("export: %s", err.Error())
+		}
+		defer f.Close()
+		dst = f
+	}
+	w := bufio.NewWriter(dst)
+	enc := json.NewEncoder(w)
+	count := 0
+	err = store.IteratePages(func(p *db.Page) error {
+		count++
+		return enc.Encode(p)
+	})
+	if err != nil {
+		return fmt.Errorf("export: %s", err.Error())
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("export: %s", err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "exported %d pages\n", count)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/joho/godotenv"
+	"log"
+	"os"
+)
+
+var ERROR_EMPTY_CONN_STRING = errors.New("empty db connection string")
+var ERROR_TEMP_BACKEND = errors.New("the temp backend only lives as long as a crawl, use local or mongo")
+var ERROR_UNKNOWN_COMMAND = errors.New("unknown command")
+
+// options are the flags every command shares. They may be given before
+// or after the command name; flags only one command reads are registered
+// by that command.
+type options struct {
+	config string
+}
+
+// register adds the shared flags to fs. The current values are the
+// defaults, so flags parsed before the command name are kept.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", o.config, "directory that holds config.yaml")
+}
+
+func (o *options) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	o.register(fs)
+	return fs
+}
+
+// load reads .env and the config every command starts from.
+func (o *options) load() (*config.Config, error) {
+	godotenv.Load()
+	return config.NewConfig(o.config)
+}
+
+// openStore opens the store the config points at. The "temp" backend
+// is gone once the crawl that made it stops, so there is nothing to open.
+func openStore(cfg *config.Config) (db.Store, error) {
+	switch cfg.DB.Backend {
+	case "local":
+		return db.NewLocalStore(cfg.DB.DataDir)
+	case "temp":
+		return nil, ERROR_TEMP_BACKEND
+	}
+	if cfg.DB.ConnString == "" {
+		return nil, ERROR_EMPTY_CONN_STRING
+	}
+	return db.NewStorage(cfg.DB.ConnString)
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(o *options, args []string) error
+}
+
+var commands = []*command{
+	{"crawl", "[--log-level LEVEL] [--replay DIR] [--rank]", "run the crawler until it is stopped or crawler.duration passed", runCrawl},
+	{"serve", "[--addr ADDR]", "serve the search and admin API on --addr", runServe},
+	{"migrate", "up|status", "apply or list the database migrations", runMigrate},
+	{"seed", "add [--depth N] [--budget N] [--tags a,b] URL | list", "add or list crawl seeds", runSeed},
+	{"reindex", "", "rebuild the search index with the current mapping", runReindex},
+	{"export", "[--out FILE]", "write the stored pages as JSON lines", runExport},
+	{"stats", "", "print counts of the stored pages, seeds and blocked urls", runStats},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: jcrawler [--config DIR] <command> [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n           %s\n", c.name, c.args, c.summary)
+	}
+}
+
+func main() {
+	o := &options{config: "."}
+	fs := flag.NewFlagSet("jcrawler", flag.ExitOnError)
+	fs.Usage = usage
+	o.register(fs)
+	fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := fs.Arg(0)
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(o, fs.Args()[1:]); err != nil {
+				log.Fatal(err.Error())
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", ERROR_UNKNOWN_COMMAND, name)
+	usage()
+	os.Exit(2)
+}
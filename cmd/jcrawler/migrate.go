@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+)
+
+var ERROR_MIGRATE_USAGE = errors.New("usage: jcrawler migrate up|status")
+
+// runMigrate applies or lists the MongoDB migrations. The local store
+// migrates itself whenever it is opened, so opening it is all "up" does.
+func runMigrate(o *options, args []string) error {
+	fs := o.flagSet("migrate")
+	fs.Parse(args)
+	if fs.NArg() != 1 || (fs.Arg(0) != "up" && fs.Arg(0) != "status") {
+		return ERROR_MIGRATE_USAGE
+	}
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("migrate: %s", err.Error())
+	}
+	defer store.CloseConnection()
+
+	mongo, ok := store.(*db.Storage)
+	if !ok {
+		fmt.Printf("local store in %s is up to date\n", cfg.DB.DataDir)
+		return nil
+	}
+	if fs.Arg(0) == "up" {
+		applied, err := mongo.MigrateUp()
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("nothing to migrate")
+		}
+		return nil
+	}
+
+	statuses, err := mongo.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, m := range statuses {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%3d  %-24s %s\n", m.Version, m.Name, applied)
+	}
+	return nil
+}
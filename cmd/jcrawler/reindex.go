@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/index"
+	"strings"
+)
+
+var ERROR_INDEX_DISABLED = errors.New("the search index is disabled in the config")
+
+func runReindex(o *options, args []string) error {
+	o.flagSet("reindex").Parse(args)
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	if !cfg.Index.Enabled {
+		return ERROR_INDEX_DISABLED
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("reindex: %s", err.Error())
+	}
+	defer store.CloseConnection()
+	idx, err := index.Init(cfg.Index)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	// Pages deleted while the copy runs only leave the old index, so the
+	// blocklist they are added to is applied to the new one.
+	from, to, err := idx.Reindex(context.Background(), store.GetBlocked)
+	if err != nil {
+		return err
+	}
+	if len(from) == 0 {
+		fmt.Printf("created %s behind alias %s\n", to, index.IndexName)
+		return nil
+	}
+	sources := strings.Join(from, ", ")
+	fmt.Printf("reindexed %s into %s and moved alias %s\n", sources, to, index.IndexName)
+	fmt.Printf("%s can be deleted once searches look right\n", sources)
+	return nil
+}
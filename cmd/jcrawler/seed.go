@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var ERROR_SEED_USAGE = errors.New("usage: jcrawler seed add [--depth N] [--budget N] [--tags a,b] URL | seed list")
+var ERROR_INVALID_SEED_URL = errors.New("seed url should be absolute http(s) url")
+
+// runSeed adds or lists seeds. A running crawler picks up added seeds on
+// its next poll.
+func runSeed(o *options, args []string) error {
+	if len(args) == 0 {
+		return ERROR_SEED_USAGE
+	}
+	switch args[0] {
+	case "add":
+		return runSeedAdd(o, args[1:])
+	case "list":
+		return runSeedList(o, args[1:])
+	}
+	return ERROR_SEED_USAGE
+}
+
+func runSeedAdd(o *options, args []string) error {
+	fs := o.flagSet("seed add")
+	depth := fs.Int("depth", 0, "how many links deep to follow from the seed, 0 for no limit")
+	budget := fs.Int("budget", 0, "how many pages to enqueue for the seed, 0 for no limit")
+	tags := fs.String("tags", "", "comma separated tags")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return ERROR_SEED_USAGE
+	}
+	u, err := url.Parse(fs.Arg(0))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ERROR_INVALID_SEED_URL
+	}
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("seed: %s", err.Error())
+	}
+	defer store.CloseConnection()
+
+	seed := &db.Seed{URL: u.String(), Depth: *depth, Budget: *budget}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			seed.Tags = append(seed.Tags, tag)
+		}
+	}
+	seed, err = store.UpsertSeed(seed)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added seed %s for %s\n", seed.ID, seed.URL)
+	return nil
+}
+
+func runSeedList(o *options, args []string) error {
+	o.flagSet("seed list").Parse(args)
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("seed: %s", err.Error())
+	}
+	defer store.CloseConnection()
+
+	seeds, err := store.GetSeeds()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tURL\tDEPTH\tBUDGET\tPAUSED\tTAGS")
+	for _, s := range seeds {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%t\t%s\n",
+			s.ID, s.URL, s.Depth, s.Budget, s.Paused, strings.Join(s.Tags, ","))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"github.com/evok02/jcrawler/internal/index"
+	"github.com/evok02/jcrawler/internal/server"
+	"log"
+)
+
+// runServe serves the API from the store in the config. Search goes to
+// OpenSearch when the index is enabled and to the store otherwise.
+func runServe(o *options, args []string) error {
+	fs := o.flagSet("serve")
+	addr := fs.String("addr", server.DEFAULT_ADDR, "address the API server listens on")
+	fs.Parse(args)
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("serve: %s", err.Error())
+	}
+	defer store.CloseConnection()
+
+	var idx *index.Index
+	if cfg.Index.Enabled {
+		if idx, err = index.Connect(cfg.Index); err != nil {
+			return fmt.Errorf("serve: %s", err.Error())
+		}
+		defer idx.Close()
+	}
+
+	log.Printf("Serving on %s...", *addr)
+	return server.Run(*addr, server.NewApiConfig(store, idx))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// STATS_TOP is how many hosts and languages stats lists.
+const STATS_TOP = 10
+
+type count struct {
+	key string
+	n   int
+}
+
+func top(counts map[string]int) []count {
+	res := make([]count, 0, len(counts))
+	for k, n := range counts {
+		res = append(res, count{k, n})
+	}
+	slices.SortFunc(res, func(a, b count) int {
+		return cmp.Or(cmp.Compare(b.n, a.n), cmp.Compare(a.key, b.key))
+	})
+	return res[:min(len(res), STATS_TOP)]
+}
+
+// runStats prints what the store holds: pages by host and language, the
+// latest crawl, seeds and blocked urls.
+func runStats(o *options, args []string) error {
+	o.flagSet("stats").Parse(args)
+	cfg, err := o.load()
+	if err != nil {
+		return err
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return fmt.Errorf("stats: %s", err.Error())
+	}
+	defer store.CloseConnection()
+
+	pages := 0
+	var latest time.Time
+	hosts := map[string]int{}
+	languages := map[string]int{}
+	err = store.IteratePages(func(p *db.Page) error {
+		pages++
+		if p.UpdatedAt.After(latest) {
+			latest = p.UpdatedAt
+		}
+		if u, err := url.Parse(p.URL); err == nil {
+			hosts[u.Hostname()]++
+		}
+		if p.Language != "" {
+			languages[p.Language]++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("stats: %s", err.Error())
+	}
+	seeds, err := store.GetSeeds()
+	if err != nil {
+		return fmt.Errorf("stats: %s", err.Error())
+	}
+	paused := 0
+	for _, s := range seeds {
+		if s.Paused {
+			paused++
+		}
+	}
+	blocked, err := store.GetBlocked()
+	if err != nil {
+		return fmt.Errorf("stats: %s", err.Error())
+	}
+
+	fmt.Printf("pages:     %d on %d hosts\n", pages, len(hosts))
+	if !latest.IsZero() {
+		fmt.Printf("latest:    %s\n", latest.UTC().Format(time.RFC3339))
+	}
+	fmt.Printf("seeds:     %d (%d paused)\n", len(seeds), paused)
+	fmt.Printf("blocked:   %d\n", len(blocked))
+	if len(hosts) > 0 {
+		fmt.Println("\ntop hosts:")
+		for _, c := range top(hosts) {
+			fmt.Printf("  %-40s %d\n", c.key, c.n)
+		}
+	}
+	if len(languages) > 0 {
+		fmt.Println("\nlanguages:")
+		for _, c := range top(languages) {
+			fmt.Printf("  %-40s %d\n", c.key, c.n)
+		}
+	}
+	return nil
+}
@@ -1,9 +0,0 @@
-package main
-
-import (
-	"github.com/evok02/jcrawler/internal/server"
-)
-
-func main() {
-
-}
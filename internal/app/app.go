@@ -4,230 +4,175 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/evok02/jcrawler/internal/batch"
 	"github.com/evok02/jcrawler/internal/config"
 	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/feed"
 	"github.com/evok02/jcrawler/internal/filter"
 	"github.com/evok02/jcrawler/internal/index"
-	"github.com/evok02/jcrawler/internal/parser"
+	"github.com/evok02/jcrawler/internal/limiter"
+	"github.com/evok02/jcrawler/internal/processor"
 	"github.com/evok02/jcrawler/internal/scheduler"
+	"github.com/evok02/jcrawler/internal/sitemap"
+	"github.com/evok02/jcrawler/internal/warc"
 	"github.com/evok02/jcrawler/internal/worker"
-	"github.com/joho/godotenv"
+	"golang.org/x/sync/errgroup"
 	"log/slog"
-	"strings"
+	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-const MAX_AMOUNT_ROUTINES = 100
-
 var ERROR_INVALID_URL_FORMAT = errors.New("malicious url format")
+var ERROR_UNKNOWN_BACKEND = errors.New("unknown page storage backend")
 
 type App struct {
-	Count    atomic.Int32
-	ErrCount atomic.Int32
-	Ctx      context.Context
-	Worker   *worker.Worker
-	Queue    *scheduler.JobQueue
-	Filter   *filter.Filter
-	Parser   *parser.Parser
-	DB       *db.Storage
-	Cfg      *config.Config
-	Index    *index.Index
-	Logger   *slog.Logger
+	Count         atomic.Int32
+	ErrCount      atomic.Int32
+	Dropped       atomic.Int32
+	Spilled       atomic.Int32
+	Ctx           context.Context
+	Worker        *worker.Worker
+	Queue         *scheduler.JobQueue
+	Filter        *filter.Filter
+	DB            db.Store
+	Pages         db.PageStore
+	Cfg           *config.Config
+	Index         *index.Index
+	Sitemap       *sitemap.Collector
+	Feeds         *feed.Poller
+	Limiter       *limiter.Limiter
+	Processors    *processor.Chain
+	PageWriter    *batch.Batcher[*db.Page]
+	IndexWriter   *batch.Batcher[*index.Document]
+	VersionWriter *batch.Batcher[*db.PageVersion]
+	LinkWriter    *batch.Batcher[*db.PageLinks]
+	Archive       *warc.Writer
+	Logger        *slog.Logger
+
+	cancel     context.CancelFunc
+	group      errgroup.Group
+	knownFeeds sync.Map
+	seeds      map[string]*seedState
+	seedsMu    sync.Mutex
+	leftover   []*scheduler.Job
+	leftoverMu sync.Mutex
+	spilled    []*scheduler.Job
+	spilledMu  sync.Mutex
+	ranks      atomic.Pointer[map[string]*db.PageRank]
+	blocked    atomic.Pointer[map[string]struct{}]
+	// pendingCrawls holds the tasks of crawl jobs by their page until the
+	// page writer reports how the write went.
+	pendingCrawls sync.Map
+	// tempDir holds the store of the "temp" backend.
+	tempDir string
 }
 
-func NewApp(cfgPath string) (*App, error) {
-	app := &App{}
-	godotenv.Load()
-	cfg, err := config.NewConfig(cfgPath)
-	if err != nil {
-		return nil, err
-	}
+func NewApp(cfg *config.Config) (*App, error) {
+	app := &App{seeds: make(map[string]*seedState)}
 	app.Cfg = cfg
 
 	app.Worker = worker.NewWorker(cfg.Worker.Delay, cfg.Worker.Timeout)
-	app.Parser = parser.NewParser()
 	app.Filter = filter.NewFilter(time.Hour * 6)
-
-	idx, err := index.Init(cfg.Index)
+	app.Sitemap = sitemap.NewCollector(app.Worker, cfg.Worker.Timeout,
+		cfg.Sitemap.MaxDepth, cfg.Sitemap.MaxURLs)
+	app.Feeds = feed.NewPoller(app.Worker, cfg.Worker.Timeout)
+	lim, err := limiter.NewLimiter(limiter.Limits{
+		GlobalRPS:      cfg.Limit.GlobalRPS,
+		HostRPS:        cfg.Limit.HostRPS,
+		MaxConcurrency: cfg.Limit.MaxConcurrency,
+	})
 	if err != nil {
 		return nil, err
 	}
-	app.Index = idx
+	app.Limiter = lim
 
-	s, err := db.NewStorage(cfg.DB.ConnString)
+	chain, err := processor.NewChain(cfg.Pipeline.Processors)
 	if err != nil {
 		return nil, err
 	}
+	app.Processors = chain
 
-	if err := s.Init(); err != nil {
-		return nil, err
-	}
-
-	app.DB = s
-	app.Queue = scheduler.NewJobQueue(10)
-	app.Ctx = context.Background()
-	return app, nil
-}
-
-func (app *App) FetcherRoutine() <-chan *worker.FetchResponse {
-	resChan := make(chan *worker.FetchResponse)
-	sem := make(chan struct{}, MAX_AMOUNT_ROUTINES)
-	go func() {
-	outer:
-		for {
-			select {
-			case url := <-app.Queue.Pop(app.Ctx, 1):
-				sem <- struct{}{}
-				go func() {
-					defer func() { <-sem }()
-					context, cancel := context.WithTimeout(context.Background(), time.Second*10)
-					defer cancel()
-					start := time.Now()
-					res, err := app.Worker.Fetch(context, url)
-					if err != nil {
-						app.handleBadResponse(url, start, err)
-						return
-					}
-					app.handleGoodResponse(url, start)
-					resChan <- res
-				}()
-			case <-app.Ctx.Done():
-				break outer
-			}
+	if cfg.Index.Enabled {
+		idx, err := index.Init(cfg.Index)
+		if err != nil {
+			return nil, err
 		}
-		close(resChan)
-	}()
-	return resChan
-}
-
-func (app *App) handleGoodResponse(url string, start time.Time) {
-	app.Count.Add(1)
-	app.Logger.Info("resource was fetched successfuly",
-		slog.String("method", "GET"),
-		slog.String("url", url),
-		slog.Float64("response_time", time.Since(start).Seconds()))
-}
-
-func (app *App) handleBadResponse(url string, start time.Time, err error) {
-	app.ErrCount.Add(1)
-	app.Logger.Error("FetcherRoutine: %s"+err.Error(),
-		slog.String("method", "GET"),
-		slog.String("url", url),
-		slog.Float64("response_time", time.Since(start).Seconds()))
-}
-
-func (app *App) parseResToPage(pres *parser.ParseResponse) (*db.Page, error) {
-	if pres.Addr == nil {
-		return nil, ERROR_INVALID_URL_FORMAT
+		app.Index = idx
 	}
-	hashLink, err := app.Filter.HashLink(pres.Addr.String())
-	if err != nil {
-		return nil, fmt.Errorf("ParseResToPage: %s", err.Error())
+
+	if err := app.openStore(); err != nil {
+		return nil, err
 	}
-	return &db.Page{
-		URLHash:   hashLink,
-		URL:       pres.Addr.String(),
-		UpdatedAt: time.Now().UTC(),
-		Content:   strings.ToValidUTF8(string(pres.Content), ""),
-		Title:     pres.Title,
-	}, nil
-}
 
-func (app *App) ParserRoutine(in <-chan *worker.FetchResponse) <-chan *parser.ParseResponse {
-	resChan := make(chan *parser.ParseResponse)
-	go func() {
-	outer:
-		for {
-			select {
-			case res := <-in:
-				pres, err := app.Parser.Parse(res)
-				if err != nil {
-					go app.handleBadPage(res, err)
-					continue outer
-				}
-				resChan <- pres
-				go app.createEntry(pres)
-			case <-app.Ctx.Done():
-				break outer
-			}
+	if cfg.Warc.Enabled {
+		w, err := warc.NewWriter(cfg.Warc.Dir, cfg.Warc.Prefix, cfg.Warc.MaxSize)
+		if err != nil {
+			return nil, err
 		}
-		close(resChan)
-	}()
-	return resChan
-}
-
-func (app *App) handleBadPage(res *worker.FetchResponse, err error) {
-	app.Logger.Error("ParserRoutine: %s"+err.Error(),
-		slog.Any("res", res))
-	app.ErrCount.Add(1)
+		app.Archive = w
+	}
+	app.startWriters()
+	app.Queue = scheduler.NewJobQueue(cfg.Queue.Size)
+	app.Ctx, app.cancel = context.WithCancel(context.Background())
+	return app, nil
 }
 
-func (app *App) createEntry(pres *parser.ParseResponse) {
-	page, err := app.parseResToPage(pres)
-	if err != nil {
-		app.Logger.Error("ParserRoutine: %s"+err.Error(),
-			slog.Any("page", page))
-		app.ErrCount.Add(1)
-		return
-	}
-	go func() {
-		err = app.DB.InsertPage(page)
+// openStore picks the storage backend. "mongo" keeps everything in
+// MongoDB and "local" keeps everything in an embedded database in the
+// data directory. "temp" is the local store in a temporary directory
+// that Shutdown removes, for crawls that need nothing to keep or run.
+func (app *App) openStore() error {
+	switch app.Cfg.DB.Backend {
+	case "local":
+		s, err := db.NewLocalStore(app.Cfg.DB.DataDir)
 		if err != nil {
-			slog.Error("ParserRoutine: %s"+err.Error(),
-				slog.Any("page", page))
-			app.ErrCount.Add(1)
-			return
+			return err
 		}
-	}()
-
-	go func() {
-		err := app.Index.HandleEntry(app.Ctx, page)
+		app.DB, app.Pages = s, s
+	case "temp":
+		dir, err := os.MkdirTemp("", "jcrawler-")
 		if err != nil {
-			app.Logger.Error("ParserRoutine: %s"+err.Error(),
-				slog.Any("page", page))
-			app.ErrCount.Add(1)
-			return
+			return fmt.Errorf("openStore: %s", err.Error())
 		}
-	}()
-}
-
-func (app *App) FilterRoutine(in <-chan *parser.ParseResponse) {
-	go func() {
-	outer:
-		for {
-			select {
-			case res := <-in:
-				linkChan := make(chan string)
-				app.enqueIfValid(linkChan, res)
-				close(linkChan)
-			case <-app.Ctx.Done():
-				break outer
-			}
+		s, err := db.NewLocalStore(dir)
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
 		}
-	}()
-}
-
-func (app *App) enqueIfValid(linkChan chan string, res *parser.ParseResponse) {
-	go func() {
-		for range linkChan {
-			app.Queue.Push(app.Ctx, 1, linkChan)
+		app.DB, app.Pages = s, s
+		app.tempDir = dir
+	case "mongo":
+		s, err := db.NewStorage(app.Cfg.DB.ConnString)
+		if err != nil {
+			return err
 		}
-	}()
-	for _, link := range res.Links {
-		if ok, err := app.Filter.IsValid(link, app.DB); ok && err == nil {
-			linkChan <- link.String()
+		if err := s.Init(); err != nil {
+			return err
 		}
+		app.DB, app.Pages = s, s
+	default:
+		return fmt.Errorf("openStore: %w: %s", ERROR_UNKNOWN_BACKEND, app.Cfg.DB.Backend)
 	}
+	return nil
 }
 
-func (app *App) PushSeed() chan string {
-	resChan := make(chan string)
-	go func() {
-		for _, link := range app.Cfg.Seed {
-			resChan <- link
-		}
-		close(resChan)
-	}()
-	return resChan
+// spawn runs fn in the app's group, so Shutdown waits for it.
+func (app *App) spawn(fn func()) {
+	app.group.Go(func() error {
+		fn()
+		return nil
+	})
+}
+
+// Run wires the pipeline stages together. Every stage has a bounded
+// number of workers and a bounded output channel, so a slow stage blocks
+// the ones before it instead of piling up goroutines.
+func (app *App) Run() {
+	fetched := app.FetcherRoutine()
+	parsed := app.ParserRoutine(fetched)
+	processed := app.ProcessorRoutine(parsed)
+	stored := app.StorageRoutine(processed)
+	app.FilterRoutine(stored)
 }
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"fmt"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSite = map[string]string{
+	"/":  `<html><head><title>Home</title></head><body><a href="/a">first</a> <a href="/b">second</a></body></html>`,
+	"/a": `<html><head><title>Page A</title></head><body><p>Alpha</p><a href="/">home</a></body></html>`,
+	"/b": `<html><head><title>Page B</title></head><body><p>Beta</p><a href="/a">first</a></body></html>`,
+}
+
+func newTestApp(t *testing.T, seed string) *App {
+	dir := t.TempDir()
+	cfg := fmt.Sprintf(`
+worker:
+  timeout: 5s
+  delay: 0s
+seed:
+  - %s
+db:
+  backend: temp
+index:
+  enabled: false
+sitemap:
+  enabled: false
+feed:
+  enabled: false
+limit:
+  host_rps: 100
+batch:
+  interval: 20ms
+queue:
+  seed_poll_interval: 20ms
+`, seed)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0644))
+	c, err := config.NewConfig(dir)
+	require.NoError(t, err)
+
+	app, err := NewApp(c)
+	require.NoError(t, err)
+	app.Logger = slog.New(slog.DiscardHandler)
+	return app
+}
+
+func TestPipeline(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := testSite[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body))
+	}))
+	defer site.Close()
+
+	app := newTestApp(t, site.URL+"/")
+	app.BlockRoutine()
+	app.SeedRoutine()
+	app.Run()
+
+	// Test: the seed and the pages it links to are fetched and stored
+	require.Eventually(t, func() bool {
+		return app.PageWriter.Written.Load() >= int64(len(testSite))
+	}, 10*time.Second, 20*time.Millisecond)
+
+	hash, err := app.Filter.HashLink(site.URL + "/b")
+	require.NoError(t, err)
+	p, err := app.Pages.GetPageByID(hash)
+	require.NoError(t, err)
+	assert.Equal(t, "Page B", p.Title)
+	assert.Contains(t, p.Content, "Beta")
+	assert.False(t, p.CrawledAt.IsZero())
+
+	// Test: the temp backend leaves nothing behind
+	dir := app.tempDir
+	require.NoError(t, app.Shutdown(5*time.Second))
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
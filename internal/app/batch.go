@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"github.com/evok02/jcrawler/internal/batch"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/index"
+	"log/slog"
+)
+
+func (app *App) startWriters() {
+	opts := batch.Options{
+		Size:     app.Cfg.Batch.Size,
+		Interval: app.Cfg.Batch.Interval,
+		Retries:  app.Cfg.Batch.Retries,
+		Backoff:  app.Cfg.Batch.Backoff,
+	}
+	app.PageWriter = batch.NewBatcher(opts,
+		func(ctx context.Context, pages []*db.Page) []error {
+			return app.Pages.BulkUpsertPages(pages)
+		})
+	app.PageWriter.OnFailure = func(p *db.Page, err error) {
+		app.handleFailedWrite(p, err)
+		app.pageFailed(p, err)
+	}
+	app.PageWriter.OnSuccess = app.pageWritten
+	app.VersionWriter = batch.NewBatcher(opts,
+		func(ctx context.Context, vs []*db.PageVersion) []error {
+			return app.DB.AddVersions(vs)
+		})
+	app.VersionWriter.OnFailure = func(v *db.PageVersion, err error) {
+		app.Logger.Error("StorageRoutine: "+err.Error(),
+			slog.String("url_hash_id", v.URLHash))
+		app.ErrCount.Add(1)
+	}
+	app.LinkWriter = batch.NewBatcher(opts,
+		func(ctx context.Context, ls []*db.PageLinks) []error {
+			return app.DB.SaveLinks(ls)
+		})
+	app.LinkWriter.OnFailure = func(pl *db.PageLinks, err error) {
+		app.Logger.Error("StorageRoutine: "+err.Error(),
+			slog.String("url", pl.URL))
+		app.ErrCount.Add(1)
+	}
+	if app.Index != nil {
+		app.IndexWriter = batch.NewBatcher(opts, app.Index.BulkIndex)
+		app.IndexWriter.OnFailure = func(doc *index.Document, err error) {
+			app.handleFailedWrite(doc.Page, err)
+		}
+	}
+}
+
+func (app *App) handleFailedWrite(p *db.Page, err error) {
+	app.Logger.Error("StorageRoutine: "+err.Error(),
+		slog.String("url", p.URL))
+	app.ErrCount.Add(1)
+}
+
+// closeWriters flushes pages that are still buffered. It has to run
+// before the database and index connections are closed.
+func (app *App) closeWriters() {
+	app.PageWriter.Close()
+	app.VersionWriter.Close()
+	app.LinkWriter.Close()
+	if app.IndexWriter != nil {
+		app.IndexWriter.Close()
+	}
+}
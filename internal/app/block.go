@@ -0,0 +1,67 @@
+package app
+
+import (
+	"log/slog"
+	"time"
+)
+
+// BlockRoutine loads the URLs removed through the API and keeps the set
+// up to date, so the crawler stops fetching them without a restart. The
+// first load happens before it returns, so no blocked URL from the
+// restored frontier slips through.
+func (app *App) BlockRoutine() {
+	app.syncBlocked()
+	ticker := time.NewTicker(app.Cfg.Queue.BlockPollInterval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				app.syncBlocked()
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (app *App) syncBlocked() {
+	blocked, err := app.DB.GetBlocked()
+	if err != nil {
+		app.Logger.Error("syncBlocked: " + err.Error())
+		app.ErrCount.Add(1)
+		return
+	}
+	set := make(map[string]struct{}, len(blocked))
+	for _, b := range blocked {
+		set[b.URLHash] = struct{}{}
+	}
+	app.blocked.Store(&set)
+}
+
+// isBlocked reports whether link was removed through the API. URLs are
+// matched by the hash pages are stored under.
+func (app *App) isBlocked(link string) bool {
+	blocked := app.blocked.Load()
+	if blocked == nil || len(*blocked) == 0 {
+		return false
+	}
+	hash, err := app.Filter.HashLink(link)
+	if err != nil {
+		return false
+	}
+	return app.isBlockedHash(hash, link)
+}
+
+// isBlockedHash is isBlocked for a page whose hash is already known.
+func (app *App) isBlockedHash(hash, link string) bool {
+	blocked := app.blocked.Load()
+	if blocked == nil {
+		return false
+	}
+	if _, ok := (*blocked)[hash]; ok {
+		app.Logger.Debug("skipping blocked url", slog.String("url", link))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"log/slog"
+	"time"
+)
+
+// CRAWL_CLAIM_LIMIT is how many crawl jobs are claimed per poll.
+const CRAWL_CLAIM_LIMIT = 10
+
+// ERROR_DROPPED is reported for a crawl target a processor kept out of
+// storage.
+var ERROR_DROPPED = errors.New("page was dropped by a processor")
+
+// ERROR_BLOCKED is reported for a crawl target that was removed through
+// the API.
+var ERROR_BLOCKED = errors.New("url is blocked")
+
+// CrawlRoutine picks up the crawl jobs added through the API and pushes
+// their URLs to the front of the frontier. They go straight to the queue,
+// so the filter's revisit timeout does not hold them back. Jobs claimed
+// longer than the claim timeout ago that are still running are picked up
+// again, so a crawler that died does not leave them running for good.
+func (app *App) CrawlRoutine() {
+	ticker := time.NewTicker(app.Cfg.Queue.CrawlPollInterval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			app.claimCrawls()
+			select {
+			case <-ticker.C:
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (app *App) claimCrawls() {
+	stale := time.Now().UTC().Add(-app.Cfg.Queue.CrawlClaimTimeout)
+	jobs, err := app.DB.ClaimCrawlJobs(CRAWL_CLAIM_LIMIT, stale)
+	if err != nil {
+		app.Logger.Error("claimCrawls: " + err.Error())
+		app.ErrCount.Add(1)
+	}
+	for _, job := range jobs {
+		app.Logger.Info("crawl job claimed",
+			slog.String("job", job.ID),
+			slog.Int("urls", len(job.Targets)))
+		for i, t := range job.Targets {
+			if t.Finished() {
+				continue
+			}
+			j := &scheduler.Job{
+				URL:         t.URL,
+				Priority:    scheduler.PriorityUrgent,
+				CrawlID:     job.ID,
+				CrawlTarget: i,
+			}
+			// The queue only refuses jobs on shutdown. The job is claimed
+			// by now, so its URLs go to the persisted frontier instead.
+			if err := app.Queue.PushJob(app.Ctx, j); err != nil {
+				app.requeue(j)
+			}
+		}
+	}
+}
+
+// reportCrawl records the progress of a URL pushed for a crawl job. Jobs
+// from the regular frontier have nothing to report.
+func (app *App) reportCrawl(job *scheduler.Job, t *db.CrawlTarget) {
+	if job.CrawlID == "" {
+		return
+	}
+	if err := app.DB.UpdateCrawlTarget(job.CrawlID, job.CrawlTarget, t); err != nil {
+		app.Logger.Error("reportCrawl: "+err.Error(),
+			slog.String("job", job.CrawlID),
+			slog.String("url", job.URL))
+		app.ErrCount.Add(1)
+	}
+}
+
+// failCrawl marks the crawl target of job as failed, keeping whatever
+// was learnt about it so far. t is nil before the fetch.
+func (app *App) failCrawl(job *scheduler.Job, t *db.CrawlTarget, err error) {
+	if job.CrawlID == "" {
+		return
+	}
+	if t == nil {
+		t = &db.CrawlTarget{URL: job.URL}
+	}
+	t.State = db.CrawlFailed
+	t.Error = err.Error()
+	app.reportCrawl(job, t)
+}
+
+// fetchedCrawl builds the target of a fetched crawl job, which stays
+// running until the page is stored.
+func (app *App) fetchedCrawl(job *scheduler.Job, status int, start time.Time) *db.CrawlTarget {
+	if job.CrawlID == "" {
+		return nil
+	}
+	t := &db.CrawlTarget{
+		URL:        job.URL,
+		State:      db.CrawlRunning,
+		StatusCode: status,
+		FetchedAt:  &start,
+		FetchMs:    time.Since(start).Milliseconds(),
+	}
+	app.reportCrawl(job, t)
+	return t
+}
+
+// pageChanged compares a page about to be stored for a crawl job with the
+// stored copy. It returns nil when that could not be told.
+func (app *App) pageChanged(task *Task) *bool {
+	if task.Crawl == nil {
+		return nil
+	}
+	changed := true
+	prev, err := app.Pages.GetPageByID(task.Page.URLHash)
+	if err != nil && !errors.Is(err, db.ERROR_INVALID_ID) {
+		return nil
+	}
+	if err == nil {
+		changed = prev.ContentHash != task.Page.ContentHash
+	}
+	return &changed
+}
+
+// awaitWrite keeps the crawl target of task until the page writer flushed
+// its page, as handing the page to the writer only buffers it.
+func (app *App) awaitWrite(task *Task, changed *bool) {
+	if task.Crawl == nil {
+		return
+	}
+	task.Crawl.PageID = task.Page.URLHash
+	task.Crawl.Changed = changed
+	app.pendingCrawls.Store(task.Page, task)
+}
+
+// pageWritten reports the crawl target waiting for p as done.
+func (app *App) pageWritten(p *db.Page) {
+	if v, ok := app.pendingCrawls.LoadAndDelete(p); ok {
+		task := v.(*Task)
+		task.Crawl.State = db.CrawlDone
+		app.reportCrawl(task.Job, task.Crawl)
+	}
+}
+
+// pageFailed reports the crawl target waiting for p as failed.
+func (app *App) pageFailed(p *db.Page, err error) {
+	if v, ok := app.pendingCrawls.LoadAndDelete(p); ok {
+		task := v.(*Task)
+		app.failCrawl(task.Job, task.Crawl, err)
+	}
+}
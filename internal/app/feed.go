@@ -0,0 +1,126 @@
+package app
+
+import (
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/feed"
+	"github.com/evok02/jcrawler/internal/parser"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+func (app *App) registerFeeds(pres *parser.ParseResponse) {
+	for _, link := range pres.Feeds {
+		feedURL := link.String()
+		if _, known := app.knownFeeds.LoadOrStore(feedURL, struct{}{}); known {
+			continue
+		}
+		hashLink, err := app.Filter.HashLink(feedURL)
+		if err != nil {
+			continue
+		}
+		err = app.DB.InsertFeed(&db.Feed{
+			URLHash:    hashLink,
+			URL:        feedURL,
+			SourceURL:  pres.Addr.String(),
+			Interval:   app.Cfg.Feed.MinInterval,
+			NextPollAt: time.Now().UTC(),
+		})
+		if err != nil {
+			app.knownFeeds.Delete(feedURL)
+			app.Logger.Error("registerFeeds: "+err.Error(),
+				slog.String("feed", feedURL))
+			app.ErrCount.Add(1)
+		}
+	}
+}
+
+func (app *App) FeedRoutine() {
+	if !app.Cfg.Feed.Enabled {
+		return
+	}
+	ticker := time.NewTicker(app.Cfg.Feed.PollInterval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				feeds, err := app.DB.GetDueFeeds(time.Now().UTC(), app.Cfg.Feed.BatchSize)
+				if err != nil {
+					app.Logger.Error("FeedRoutine: " + err.Error())
+					app.ErrCount.Add(1)
+					continue
+				}
+				for _, f := range feeds {
+					app.pollFeed(f)
+				}
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// pollFeed pushes unseen items to the front of the frontier and adapts
+// the polling interval: feeds that produced something are polled twice
+// as often, quiet ones back off up to the configured maximum.
+func (app *App) pollFeed(f *db.Feed) {
+	now := time.Now().UTC()
+	f.LastPolledAt = now
+	if f.Interval <= 0 {
+		f.Interval = app.Cfg.Feed.MinInterval
+	}
+	res, err := app.Feeds.Poll(app.Ctx, f.URL, f.ETag, f.LastModified)
+	if err != nil {
+		app.Logger.Error("pollFeed: "+err.Error(), slog.String("feed", f.URL))
+		app.ErrCount.Add(1)
+		f.Interval = min(f.Interval*2, app.Cfg.Feed.MaxInterval)
+	} else {
+		f.ETag, f.LastModified = res.ETag, res.LastModified
+		fresh := []string{}
+		if !res.NotModified {
+			for _, item := range res.Feed.Items {
+				if f.HasSeen(item.ID) {
+					continue
+				}
+				fresh = append(fresh, item.ID)
+				app.enqueueFeedItem(f, item)
+			}
+		}
+		f.MarkSeen(fresh)
+		if len(fresh) > 0 {
+			f.Interval = max(f.Interval/2, app.Cfg.Feed.MinInterval)
+		} else {
+			f.Interval = min(f.Interval*2, app.Cfg.Feed.MaxInterval)
+		}
+	}
+	f.NextPollAt = now.Add(f.Interval)
+
+	if err := app.DB.UpdateFeed(f); err != nil {
+		app.Logger.Error("pollFeed: "+err.Error(), slog.String("feed", f.URL))
+		app.ErrCount.Add(1)
+	}
+}
+
+// enqueueFeedItem pushes the page of a feed item. Item links may be
+// relative, so they are resolved against the URL of the feed.
+func (app *App) enqueueFeedItem(f *db.Feed, item *feed.Item) {
+	base, err := url.Parse(f.URL)
+	if err != nil {
+		return
+	}
+	ref, err := url.Parse(item.Link)
+	if err != nil {
+		return
+	}
+	link := base.ResolveReference(ref)
+	if ok, err := app.Filter.IsValid(link, app.Pages); !ok || err != nil {
+		return
+	}
+	app.Queue.PushJob(app.Ctx, &scheduler.Job{
+		URL:      link.String(),
+		Priority: scheduler.PriorityUrgent,
+		LastMod:  item.Published,
+	})
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"time"
+)
+
+// LimitRoutine publishes the configured limits unless some were already
+// stored, then applies whatever the API writes to the settings collection
+// to the running limiter.
+func (app *App) LimitRoutine() {
+	limits := app.Limiter.Limits()
+	if err := app.DB.InsertLimits(&limits); err != nil {
+		app.Logger.Error("LimitRoutine: " + err.Error())
+		app.ErrCount.Add(1)
+	}
+
+	ticker := time.NewTicker(app.Cfg.Limit.PollInterval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			app.syncLimits()
+			select {
+			case <-ticker.C:
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (app *App) syncLimits() {
+	limits, err := app.DB.GetLimits()
+	if err != nil {
+		if !errors.Is(err, db.ERROR_INVALID_ID) {
+			app.Logger.Error("syncLimits: " + err.Error())
+			app.ErrCount.Add(1)
+		}
+		return
+	}
+	if err := app.Limiter.Set(*limits); err != nil {
+		app.Logger.Error("syncLimits: " + err.Error())
+		app.ErrCount.Add(1)
+	}
+}
@@ -0,0 +1,352 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/index"
+	"github.com/evok02/jcrawler/internal/lang"
+	"github.com/evok02/jcrawler/internal/parser"
+	"github.com/evok02/jcrawler/internal/processor"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"github.com/evok02/jcrawler/internal/worker"
+	"golang.org/x/sync/errgroup"
+	"log/slog"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Task carries one URL through the pipeline, collecting the output of
+// every stage it passed.
+type Task struct {
+	Job   *scheduler.Job
+	Fetch *worker.FetchResponse
+	Parse *parser.ParseResponse
+	Doc   *processor.Document
+	Page  *db.Page
+	// Crawl is the progress of the crawl job target the task runs for,
+	// nil for tasks from the regular frontier.
+	Crawl *db.CrawlTarget
+}
+
+// runStage starts n workers reading from in. Each worker is built by
+// newWorker, so it can own state that is not safe to share; it returns
+// false for tasks that should not reach the next stage. out is closed
+// once in is drained and every worker returned.
+func (app *App) runStage(n int, in <-chan *Task, out chan<- *Task, newWorker func() func(*Task) bool) {
+	workers := new(errgroup.Group)
+	for range max(n, 1) {
+		work := newWorker()
+		workers.Go(func() error {
+			for task := range in {
+				if work(task) && out != nil {
+					out <- task
+				}
+			}
+			return nil
+		})
+	}
+	app.group.Go(func() error {
+		err := workers.Wait()
+		if out != nil {
+			close(out)
+		}
+		return err
+	})
+}
+
+func (app *App) FetcherRoutine() <-chan *Task {
+	out := make(chan *Task, app.Cfg.Pipeline.Buffer)
+	app.group.Go(func() error {
+		var inflight sync.WaitGroup
+		for {
+			if err := app.Limiter.Acquire(app.Ctx); err != nil {
+				break
+			}
+			job, err := app.Queue.PopJob(app.Ctx)
+			if err != nil {
+				app.Limiter.Release()
+				break
+			}
+			inflight.Add(1)
+			go func() {
+				defer inflight.Done()
+				defer app.Limiter.Release()
+				if task, ok := app.fetch(job); ok {
+					out <- task
+				}
+			}()
+		}
+		inflight.Wait()
+		close(out)
+		return nil
+	})
+	return out
+}
+
+func (app *App) fetch(job *scheduler.Job) (*Task, bool) {
+	if app.isBlocked(job.URL) {
+		app.failCrawl(job, nil, ERROR_BLOCKED)
+		return nil, false
+	}
+	if err := app.waitLimit(job.URL); err != nil {
+		app.failCrawl(job, nil, err)
+		app.requeue(job)
+		return nil, false
+	}
+	context, cancel := context.WithTimeout(context.Background(), app.Cfg.Worker.Timeout)
+	defer cancel()
+	start := time.Now()
+	res, err := app.Worker.Fetch(context, job.URL)
+	if err != nil {
+		app.handleBadResponse(job.URL, start, err)
+		app.failCrawl(job, &db.CrawlTarget{
+			URL:       job.URL,
+			FetchedAt: &start,
+			FetchMs:   time.Since(start).Milliseconds(),
+		}, err)
+		return nil, false
+	}
+	app.handleGoodResponse(job.URL, start)
+	crawl := app.fetchedCrawl(job, res.Response.StatusCode, start)
+	if app.Archive != nil {
+		app.archive(res)
+	}
+	return &Task{Job: job, Fetch: res, Crawl: crawl}, true
+}
+
+func (app *App) waitLimit(link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	return app.Limiter.Wait(app.Ctx, u.Hostname())
+}
+
+func (app *App) handleGoodResponse(url string, start time.Time) {
+	app.Count.Add(1)
+	app.Logger.Info("resource was fetched successfuly",
+		slog.String("method", "GET"),
+		slog.String("url", url),
+		slog.Float64("response_time", time.Since(start).Seconds()))
+}
+
+func (app *App) handleBadResponse(url string, start time.Time, err error) {
+	app.ErrCount.Add(1)
+	app.Logger.Error("FetcherRoutine: "+err.Error(),
+		slog.String("method", "GET"),
+		slog.String("url", url),
+		slog.Float64("response_time", time.Since(start).Seconds()))
+}
+
+func (app *App) ParserRoutine(in <-chan *Task) <-chan *Task {
+	out := make(chan *Task, app.Cfg.Pipeline.Buffer)
+	app.runStage(app.Cfg.Pipeline.ParseWorkers, in, out, func() func(*Task) bool {
+		p := parser.NewParser()
+		return func(task *Task) bool {
+			pres, err := p.Parse(task.Fetch)
+			if err != nil {
+				app.handleBadPage(task.Fetch, err)
+				app.failCrawl(task.Job, task.Crawl, err)
+				return false
+			}
+			if pres.Addr == nil {
+				app.Logger.Error("ParserRoutine: "+ERROR_INVALID_URL_FORMAT.Error(),
+					slog.String("url", task.Job.URL))
+				app.ErrCount.Add(1)
+				app.failCrawl(task.Job, task.Crawl, ERROR_INVALID_URL_FORMAT)
+				return false
+			}
+			task.Parse = pres
+			return true
+		}
+	})
+	return out
+}
+
+// ProcessorRoutine runs the configured processor chain on every parsed
+// page. A failing processor is logged and skipped; a dropping one keeps
+// the page out of storage and its links out of the frontier.
+func (app *App) ProcessorRoutine(in <-chan *Task) <-chan *Task {
+	out := make(chan *Task, app.Cfg.Pipeline.Buffer)
+	app.runStage(app.Cfg.Pipeline.ProcessWorkers, in, out, func() func(*Task) bool {
+		return func(task *Task) bool {
+			doc, err := app.Processors.Run(app.Ctx, parseResToDoc(task))
+			if err != nil {
+				app.Logger.Error("ProcessorRoutine: "+err.Error(),
+					slog.String("url", task.Job.URL))
+				app.ErrCount.Add(1)
+			}
+			if doc == nil {
+				app.failCrawl(task.Job, task.Crawl, ERROR_DROPPED)
+				return false
+			}
+			task.Doc = doc
+			page, err := app.docToPage(doc)
+			if err != nil {
+				app.Logger.Error("ProcessorRoutine: "+err.Error(),
+					slog.String("url", task.Job.URL))
+				app.ErrCount.Add(1)
+				app.failCrawl(task.Job, task.Crawl, err)
+				return false
+			}
+			task.Page = page
+			return true
+		}
+	})
+	return out
+}
+
+func (app *App) handleBadPage(res *worker.FetchResponse, err error) {
+	res.Response.Body.Close()
+	app.Logger.Error("ParserRoutine: "+err.Error(),
+		slog.Any("res", res))
+	app.ErrCount.Add(1)
+}
+
+func parseResToDoc(task *Task) *processor.Document {
+	return &processor.Document{
+		URL:      task.Parse.Addr,
+		Status:   task.Fetch.Response.StatusCode,
+		Header:   task.Fetch.Response.Header,
+		Title:    task.Parse.Title,
+		Content:  strings.ToValidUTF8(string(task.Parse.Content), ""),
+		Language: task.Parse.Language,
+		Links:    task.Parse.Links,
+	}
+}
+
+func (app *App) docToPage(doc *processor.Document) (*db.Page, error) {
+	hashLink, err := app.Filter.HashLink(doc.URL.String())
+	if err != nil {
+		return nil, fmt.Errorf("docToPage: %s", err.Error())
+	}
+	var meta map[string]any
+	if len(doc.Fields) > 0 {
+		meta = doc.Fields
+	}
+	content := strings.ToValidUTF8(doc.Content, "")
+	language := doc.Language
+	if language == "" {
+		language = lang.Detect(content)
+	}
+	contentType, _, _ := mime.ParseMediaType(doc.Header.Get("Content-Type"))
+	now := time.Now().UTC()
+	return &db.Page{
+		URLHash:     hashLink,
+		URL:         doc.URL.String(),
+		UpdatedAt:   now,
+		CrawledAt:   now,
+		Content:     content,
+		Title:       doc.Title,
+		Meta:        meta,
+		ContentHash: db.ContentHash(doc.Title, content),
+		Language:    language,
+		ContentType: contentType,
+		Keywords:    doc.Keywords,
+	}, nil
+}
+
+// StorageRoutine hands pages to the batching writers for the database and
+// the search index. Adding blocks while a full batch is being written, so
+// a slow Mongo or OpenSearch still slows down fetching through the bounded
+// channels.
+func (app *App) StorageRoutine(in <-chan *Task) <-chan *Task {
+	out := make(chan *Task, app.Cfg.Pipeline.Buffer)
+	app.runStage(app.Cfg.Pipeline.StoreWorkers, in, out, func() func(*Task) bool {
+		return func(task *Task) bool {
+			if !app.store(task) {
+				return false
+			}
+			if len(task.Parse.Feeds) > 0 {
+				app.registerFeeds(task.Parse)
+			}
+			return true
+		}
+	})
+	return out
+}
+
+// store hands the page of task to the writers. It returns false for a
+// page that was removed through the API while it was being fetched and
+// parsed, which is dropped along with its links.
+func (app *App) store(task *Task) bool {
+	if app.isBlockedHash(task.Page.URLHash, task.Page.URL) {
+		app.failCrawl(task.Job, task.Crawl, ERROR_BLOCKED)
+		return false
+	}
+	if app.IndexWriter != nil {
+		app.fillRank(task.Page)
+	}
+	app.awaitWrite(task, app.pageChanged(task))
+	if err := app.PageWriter.Add(context.Background(), task.Page); err != nil {
+		app.handleFailedWrite(task.Page, err)
+		app.pageFailed(task.Page, err)
+	}
+	version, err := db.NewPageVersion(task.Page)
+	if err == nil {
+		err = app.VersionWriter.Add(context.Background(), version)
+	}
+	if err != nil {
+		app.handleFailedWrite(task.Page, err)
+	}
+	links, err := app.pageLinks(task)
+	if err == nil {
+		err = app.LinkWriter.Add(context.Background(), links)
+	}
+	if err != nil {
+		app.handleFailedWrite(task.Page, err)
+	}
+	if app.IndexWriter == nil {
+		return true
+	}
+	// Anchors that point at the page are only known once their sources
+	// were stored, so a page picks up new ones when it is crawled again.
+	anchors, err := app.DB.GetAnchors(task.Page.URLHash, index.MAX_ANCHORS)
+	if err != nil {
+		app.handleFailedWrite(task.Page, err)
+	}
+	doc := index.NewDocument(task.Page, anchors)
+	if err := app.IndexWriter.Add(context.Background(), doc); err != nil {
+		app.handleFailedWrite(task.Page, err)
+	}
+	return true
+}
+
+func (app *App) FilterRoutine(in <-chan *Task) {
+	app.runStage(app.Cfg.Pipeline.FilterWorkers, in, nil, func() func(*Task) bool {
+		return func(task *Task) bool {
+			app.enqueIfValid(task)
+			return false
+		}
+	})
+}
+
+// enqueIfValid never blocks on a full frontier: the filter stage feeds the
+// queue the fetcher reads from, so waiting here could stall the pipeline.
+// Links that do not fit are spilled to the stored frontier instead.
+func (app *App) enqueIfValid(task *Task) {
+	for _, link := range task.Doc.Links {
+		if ok, err := app.Filter.IsValid(link, app.Pages); !ok || err != nil {
+			continue
+		}
+		if app.isBlocked(link.String()) {
+			continue
+		}
+		child, ok := app.childJob(task.Job, link.String())
+		if !ok {
+			continue
+		}
+		child.Priority = app.rankPriority(child.URL)
+		switch err := app.Queue.TryPushJob(child); err {
+		case nil:
+		case scheduler.ERROR_QUEUE_FULL:
+			app.spill(child)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/rank"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"log/slog"
+	"time"
+)
+
+// pageLinks turns the anchors of a stored page into its edges of the link
+// graph. Targets are hashed like pages are, so an edge points at the page
+// the target is stored under once it is crawled.
+func (app *App) pageLinks(task *Task) (*db.PageLinks, error) {
+	pl := &db.PageLinks{
+		URLHash:   task.Page.URLHash,
+		URL:       task.Page.URL,
+		Links:     make([]db.Link, 0, len(task.Parse.Anchors)),
+		UpdatedAt: task.Page.UpdatedAt,
+	}
+	for _, a := range task.Parse.Anchors {
+		if a.URL.Scheme != "http" && a.URL.Scheme != "https" {
+			continue
+		}
+		target := a.URL.String()
+		hash, err := app.Filter.HashLink(target)
+		if err != nil {
+			return nil, fmt.Errorf("pageLinks: %s", err.Error())
+		}
+		pl.Links = append(pl.Links, db.Link{
+			TargetHash: hash,
+			TargetURL:  target,
+			Anchor:     a.Text,
+			Context:    a.Context,
+		})
+	}
+	return pl, nil
+}
+
+// RankRoutine recomputes link scores every rank interval. A zero interval
+// leaves ranking to explicit ComputeRanks calls.
+func (app *App) RankRoutine() {
+	if app.Cfg.Rank.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(app.Cfg.Rank.Interval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := app.ComputeRanks(); err != nil {
+					app.Logger.Error("RankRoutine: " + err.Error())
+					app.ErrCount.Add(1)
+				}
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// ComputeRanks runs PageRank over the stored link graph and writes the
+// scores to the pages, the search index and the frontier's rank table.
+func (app *App) ComputeRanks() error {
+	start := time.Now()
+	g := rank.Graph{}
+	err := app.DB.IterateLinks(func(pl *db.PageLinks) error {
+		targets := make([]string, 0, len(pl.Links))
+		for _, l := range pl.Links {
+			targets = append(targets, l.TargetHash)
+		}
+		g[pl.URLHash] = targets
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ComputeRanks: %s", err.Error())
+	}
+
+	scores, err := rank.PageRank(g, rank.Options{
+		Damping:    app.Cfg.Rank.Damping,
+		Iterations: app.Cfg.Rank.Iterations,
+		Tolerance:  app.Cfg.Rank.Tolerance,
+	})
+	if err != nil {
+		return fmt.Errorf("ComputeRanks: %s", err.Error())
+	}
+	ranks := make([]*db.PageRank, 0, len(scores))
+	cache := make(map[string]*db.PageRank, len(scores))
+	for id, s := range scores {
+		r := &db.PageRank{URLHash: id, Rank: s.Rank, InDegree: s.InDegree}
+		ranks = append(ranks, r)
+		cache[id] = r
+	}
+	app.ranks.Store(&cache)
+
+	if err := app.Pages.SetRanks(ranks); err != nil {
+		return fmt.Errorf("ComputeRanks: %s", err.Error())
+	}
+	if app.Index != nil {
+		failed := 0
+		for start := 0; start < len(ranks); start += db.RANK_BATCH {
+			batch := ranks[start:min(start+db.RANK_BATCH, len(ranks))]
+			for _, err := range app.Index.UpdateRanks(context.Background(), batch) {
+				if err != nil {
+					failed++
+				}
+			}
+		}
+		if failed > 0 {
+			app.Logger.Error("ComputeRanks: failed to update index ranks",
+				slog.Int("failed", failed))
+			app.ErrCount.Add(1)
+		}
+	}
+	app.Logger.Info("ranks computed",
+		slog.Int("pages", len(ranks)),
+		slog.Float64("took", time.Since(start).Seconds()))
+	return nil
+}
+
+// rankPriority scales the default frontier priority by the link score of
+// a URL from the last rank run. Unknown URLs keep the default.
+func (app *App) rankPriority(link string) float64 {
+	ranks := app.ranks.Load()
+	if ranks == nil {
+		return scheduler.PriorityDefault
+	}
+	hash, err := app.Filter.HashLink(link)
+	if err != nil {
+		return scheduler.PriorityDefault
+	}
+	r, ok := (*ranks)[hash]
+	if !ok {
+		return scheduler.PriorityDefault
+	}
+	return min(max(scheduler.PriorityDefault*r.Rank, scheduler.PriorityLow), scheduler.PriorityHigh)
+}
+
+// fillRank sets the link score of p, which docToPage leaves at zero, so
+// indexing the page again does not reset its rank in the index. The score
+// comes from the last rank run, or from the stored copy of the page when
+// that run did not see it.
+func (app *App) fillRank(p *db.Page) {
+	if ranks := app.ranks.Load(); ranks != nil {
+		if r, ok := (*ranks)[p.URLHash]; ok {
+			p.Rank, p.InDegree = r.Rank, r.InDegree
+			return
+		}
+	}
+	prev, err := app.Pages.GetPageByID(p.URLHash)
+	if err != nil {
+		return
+	}
+	p.Rank, p.InDegree = prev.Rank, prev.InDegree
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+type seedState struct {
+	seed     *db.Seed
+	pushed   bool
+	enqueued atomic.Int32
+}
+
+// SeedRoutine imports the seeds from config and then keeps the crawler in
+// sync with the seeds collection, so seeds added, paused or removed
+// through the API take effect without a restart.
+func (app *App) SeedRoutine() {
+	for _, link := range app.Cfg.Seed {
+		if _, err := app.DB.InsertSeed(&db.Seed{URL: link}); err != nil {
+			app.Logger.Error("SeedRoutine: "+err.Error(), slog.String("seed", link))
+			app.ErrCount.Add(1)
+		}
+	}
+
+	ticker := time.NewTicker(app.Cfg.Queue.SeedPollInterval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			app.syncSeeds()
+			select {
+			case <-ticker.C:
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (app *App) syncSeeds() {
+	seeds, err := app.DB.GetSeeds()
+	if err != nil {
+		app.Logger.Error("syncSeeds: " + err.Error())
+		app.ErrCount.Add(1)
+		return
+	}
+
+	active := make(map[string]struct{}, len(seeds))
+	fresh := []*db.Seed{}
+	app.seedsMu.Lock()
+	for _, seed := range seeds {
+		active[seed.ID] = struct{}{}
+		state, ok := app.seeds[seed.ID]
+		if !ok {
+			state = &seedState{}
+			app.seeds[seed.ID] = state
+		}
+		resumed := state.seed != nil && state.seed.Paused && !seed.Paused
+		state.seed = seed
+		if !seed.Paused && (!state.pushed || resumed) {
+			state.pushed = true
+			fresh = append(fresh, seed)
+		}
+	}
+	for id := range app.seeds {
+		if _, ok := active[id]; !ok {
+			delete(app.seeds, id)
+		}
+	}
+	app.seedsMu.Unlock()
+
+	for _, seed := range fresh {
+		app.pushSeed(seed)
+	}
+}
+
+func (app *App) pushSeed(seed *db.Seed) {
+	err := app.Queue.PushJob(app.Ctx, &scheduler.Job{
+		URL:      seed.URL,
+		Priority: scheduler.PriorityHigh,
+		SeedID:   seed.ID,
+	})
+	if err != nil {
+		return
+	}
+	if app.Cfg.Sitemap.Enabled {
+		app.spawn(func() { app.collectSitemaps(seed) })
+	}
+}
+
+// childJob derives the job for a link found on the parent's page. Links
+// inherit the seed of their parent and are dropped once that seed is
+// paused, removed, or has used up its depth or budget.
+func (app *App) childJob(parent *scheduler.Job, link string) (*scheduler.Job, bool) {
+	child := scheduler.NewJob(link)
+	if parent == nil || parent.SeedID == "" {
+		return child, true
+	}
+
+	app.seedsMu.Lock()
+	state, ok := app.seeds[parent.SeedID]
+	var seed *db.Seed
+	if ok {
+		seed = state.seed
+	}
+	app.seedsMu.Unlock()
+	if !ok || seed.Paused {
+		return nil, false
+	}
+
+	child.SeedID = parent.SeedID
+	child.Depth = parent.Depth + 1
+	if seed.Depth > 0 && child.Depth > seed.Depth {
+		return nil, false
+	}
+	if seed.Budget > 0 && int(state.enqueued.Add(1)) > seed.Budget {
+		return nil, false
+	}
+	return child, true
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func queuedURLs(app *App) []string {
+	urls := []string{}
+	for _, job := range app.Queue.Drain() {
+		urls = append(urls, job.URL)
+	}
+	return urls
+}
+
+func TestSyncSeedsPause(t *testing.T) {
+	app := newTestApp(t, "https://unused.example/")
+	t.Cleanup(func() { app.Shutdown(5 * time.Second) })
+	seed, err := app.DB.InsertSeed(&db.Seed{URL: "https://a.com/"})
+	require.NoError(t, err)
+
+	// Test: a new seed is pushed once, not on every poll
+	app.syncSeeds()
+	assert.Equal(t, []string{"https://a.com/"}, queuedURLs(app))
+	app.syncSeeds()
+	assert.Empty(t, queuedURLs(app))
+
+	// Test: a paused seed pushes no jobs and drops the links found under it
+	_, err = app.DB.SetSeedPaused(seed.ID, true)
+	require.NoError(t, err)
+	app.syncSeeds()
+	assert.Empty(t, queuedURLs(app))
+	parent := &scheduler.Job{URL: seed.URL, SeedID: seed.ID}
+	_, ok := app.childJob(parent, "https://a.com/x")
+	assert.False(t, ok)
+
+	// Test: resuming the seed pushes it again and lets its links through
+	_, err = app.DB.SetSeedPaused(seed.ID, false)
+	require.NoError(t, err)
+	app.syncSeeds()
+	assert.Equal(t, []string{"https://a.com/"}, queuedURLs(app))
+	child, ok := app.childJob(parent, "https://a.com/x")
+	require.True(t, ok)
+	assert.Equal(t, seed.ID, child.SeedID)
+
+	// Test: a deleted seed no longer owns any links
+	require.NoError(t, app.DB.DeleteSeedByID(seed.ID))
+	app.syncSeeds()
+	_, ok = app.childJob(parent, "https://a.com/y")
+	assert.False(t, ok)
+}
+
+func TestSyncSeedsLimits(t *testing.T) {
+	app := newTestApp(t, "https://unused.example/")
+	t.Cleanup(func() { app.Shutdown(5 * time.Second) })
+	budget, err := app.DB.InsertSeed(&db.Seed{URL: "https://a.com/", Budget: 3})
+	require.NoError(t, err)
+	depth, err := app.DB.InsertSeed(&db.Seed{URL: "https://b.com/", Depth: 1})
+	require.NoError(t, err)
+	app.syncSeeds()
+	queuedURLs(app)
+
+	// Test: no more links than the budget are enqueued for a seed
+	parent := &scheduler.Job{URL: budget.URL, SeedID: budget.ID}
+	accepted := 0
+	for _, link := range []string{"https://a.com/1", "https://a.com/2", "https://a.com/3",
+		"https://a.com/4", "https://a.com/5"} {
+		if _, ok := app.childJob(parent, link); ok {
+			accepted++
+		}
+	}
+	assert.Equal(t, 3, accepted)
+
+	// Test: the budget is kept across polls of the seeds collection
+	app.syncSeeds()
+	_, ok := app.childJob(parent, "https://a.com/6")
+	assert.False(t, ok)
+
+	// Test: links below the seed's depth are dropped
+	root := &scheduler.Job{URL: depth.URL, SeedID: depth.ID}
+	child, ok := app.childJob(root, "https://b.com/1")
+	require.True(t, ok)
+	assert.Equal(t, 1, child.Depth)
+	_, ok = app.childJob(child, "https://b.com/2")
+	assert.False(t, ok)
+
+	// Test: links of jobs without a seed are not limited
+	free, ok := app.childJob(nil, "https://c.com/")
+	require.True(t, ok)
+	assert.Empty(t, free.SeedID)
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"os"
+	"time"
+)
+
+var ERROR_SHUTDOWN_TIMEOUT = errors.New("pipeline did not drain before the shutdown deadline")
+
+// requeue keeps a job that was popped but never fetched, so it ends up in
+// the persisted frontier instead of being lost.
+func (app *App) requeue(job *scheduler.Job) {
+	app.leftoverMu.Lock()
+	defer app.leftoverMu.Unlock()
+	app.leftover = append(app.leftover, job)
+}
+
+func (app *App) RestoreFrontier() error {
+	entries, err := app.DB.LoadFrontier(0)
+	if err != nil {
+		return fmt.Errorf("RestoreFrontier: %s", err.Error())
+	}
+	app.spawn(func() {
+		for _, e := range entries {
+			job := frontierJob(e)
+			if err := app.Queue.PushJob(app.Ctx, job); err != nil {
+				app.requeue(job)
+			}
+		}
+	})
+	return nil
+}
+
+func frontierJob(e *db.FrontierEntry) *scheduler.Job {
+	return &scheduler.Job{
+		URL:         e.URL,
+		Priority:    e.Priority,
+		LastMod:     e.LastMod,
+		ChangeFreq:  e.ChangeFreq,
+		SeedID:      e.SeedID,
+		Depth:       e.Depth,
+		CrawlID:     e.CrawlID,
+		CrawlTarget: e.CrawlTarget,
+	}
+}
+
+func frontierEntries(jobs []*scheduler.Job) []*db.FrontierEntry {
+	now := time.Now().UTC()
+	entries := make([]*db.FrontierEntry, 0, len(jobs))
+	for _, job := range jobs {
+		entries = append(entries, &db.FrontierEntry{
+			URL:         job.URL,
+			Priority:    job.Priority,
+			LastMod:     job.LastMod,
+			ChangeFreq:  job.ChangeFreq,
+			SeedID:      job.SeedID,
+			Depth:       job.Depth,
+			CrawlID:     job.CrawlID,
+			CrawlTarget: job.CrawlTarget,
+			SavedAt:     now,
+		})
+	}
+	return entries
+}
+
+func (app *App) persistFrontier() error {
+	app.leftoverMu.Lock()
+	jobs := append(app.Queue.Drain(), app.leftover...)
+	app.leftover = nil
+	app.leftoverMu.Unlock()
+	jobs = append(jobs, app.takeSpilled()...)
+
+	return app.DB.SaveFrontier(frontierEntries(jobs))
+}
+
+// Shutdown stops the crawl: no new URLs are popped or accepted, work that
+// is already in flight gets until timeout to finish, and what is left of
+// the frontier is saved before the connections are closed.
+func (app *App) Shutdown(timeout time.Duration) error {
+	app.cancel()
+	app.Queue.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.group.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = ERROR_SHUTDOWN_TIMEOUT
+	}
+
+	if perr := app.persistFrontier(); perr != nil {
+		err = errors.Join(err, perr)
+	}
+	app.closeWriters()
+	if app.Archive != nil {
+		if aerr := app.Archive.Close(); aerr != nil {
+			err = errors.Join(err, fmt.Errorf("Shutdown: %s", aerr.Error()))
+		}
+	}
+	if app.Index != nil {
+		app.Index.Close()
+	}
+	if cerr := app.DB.CloseConnection(); cerr != nil {
+		err = errors.Join(err, fmt.Errorf("Shutdown: %s", cerr.Error()))
+	}
+	if app.tempDir != "" {
+		if rerr := os.RemoveAll(app.tempDir); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("Shutdown: %s", rerr.Error()))
+		}
+	}
+	return err
+}
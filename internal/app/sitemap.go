@@ -0,0 +1,39 @@
+package app
+
+import (
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"github.com/evok02/jcrawler/internal/sitemap"
+	"log/slog"
+	"net/url"
+)
+
+func (app *App) collectSitemaps(seed *db.Seed) {
+	root := &scheduler.Job{URL: seed.URL, SeedID: seed.ID}
+	err := app.Sitemap.Collect(app.Ctx, seed.URL, func(u *sitemap.URL) {
+		app.enqueueSitemapURL(root, u)
+	})
+	if err != nil {
+		app.Logger.Error("collectSitemaps: "+err.Error(),
+			slog.String("seed", seed.URL))
+		app.ErrCount.Add(1)
+	}
+}
+
+func (app *App) enqueueSitemapURL(root *scheduler.Job, u *sitemap.URL) {
+	link, err := url.Parse(u.Loc)
+	if err != nil {
+		return
+	}
+	if ok, err := app.Filter.IsValid(link, app.Pages); !ok || err != nil {
+		return
+	}
+	job, ok := app.childJob(root, link.String())
+	if !ok {
+		return
+	}
+	job.Priority = u.Priority
+	job.LastMod = u.LastMod
+	job.ChangeFreq = u.ChangeFreq
+	app.Queue.PushJob(app.Ctx, job)
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"log/slog"
+	"time"
+)
+
+// MAX_SPILLED bounds how many spilled jobs wait in memory for the next
+// flush. Jobs beyond it are dropped.
+const MAX_SPILLED = 50000
+
+// spill keeps a job that did not fit in the frontier. Spilled jobs are
+// saved with the persisted frontier and pushed back by SpillRoutine once
+// the queue has room again.
+func (app *App) spill(job *scheduler.Job) {
+	app.Spilled.Add(1)
+	app.keepSpilled([]*scheduler.Job{job})
+}
+
+func (app *App) keepSpilled(jobs []*scheduler.Job) {
+	app.spilledMu.Lock()
+	defer app.spilledMu.Unlock()
+	for _, job := range jobs {
+		if len(app.spilled) >= MAX_SPILLED {
+			app.Dropped.Add(1)
+			continue
+		}
+		app.spilled = append(app.spilled, job)
+	}
+}
+
+func (app *App) takeSpilled() []*scheduler.Job {
+	app.spilledMu.Lock()
+	defer app.spilledMu.Unlock()
+	jobs := app.spilled
+	app.spilled = nil
+	return jobs
+}
+
+// SpillRoutine writes spilled jobs to the stored frontier and, whenever
+// the queue is less than half full, loads the best stored jobs back.
+func (app *App) SpillRoutine() {
+	ticker := time.NewTicker(app.Cfg.Queue.SpillInterval)
+	app.spawn(func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				app.flushSpilled()
+				app.refill()
+			case <-app.Ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (app *App) flushSpilled() {
+	jobs := app.takeSpilled()
+	if len(jobs) == 0 {
+		return
+	}
+	if err := app.DB.SaveFrontier(frontierEntries(jobs)); err != nil {
+		app.Logger.Error("flushSpilled: "+err.Error(), slog.Int("jobs", len(jobs)))
+		app.ErrCount.Add(1)
+		app.keepSpilled(jobs)
+	}
+}
+
+func (app *App) refill() {
+	room := app.Cfg.Queue.Size/2 - app.Queue.Len()
+	if room <= 0 {
+		return
+	}
+	entries, err := app.DB.LoadFrontier(room)
+	if err != nil {
+		app.Logger.Error("refill: " + err.Error())
+		app.ErrCount.Add(1)
+		return
+	}
+	for _, e := range entries {
+		job := frontierJob(e)
+		if err := app.Queue.TryPushJob(job); err != nil {
+			app.keepSpilled([]*scheduler.Job{job})
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/scheduler"
+	"github.com/evok02/jcrawler/internal/warc"
+	"github.com/evok02/jcrawler/internal/worker"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// archive writes the exchange to the WARC files. The body has to be read
+// for that, so the part the record keeps is buffered and put back in
+// front of the rest of the stream, which the parser still reads in full.
+func (app *App) archive(res *worker.FetchResponse) {
+	orig := res.Response.Body
+	body, err := io.ReadAll(io.LimitReader(orig, warc.MAX_RECORD_BODY+1))
+	res.Response.Body = &replayedBody{
+		Reader: io.MultiReader(bytes.NewReader(body), orig),
+		Closer: orig,
+	}
+	if err == nil {
+		err = app.Archive.WriteExchange(res.Response, body)
+	}
+	if err != nil {
+		app.Logger.Error("archive: "+err.Error(),
+			slog.String("url", res.HostName.String()))
+		app.ErrCount.Add(1)
+	}
+}
+
+// replayedBody reads a response body whose start was already consumed and
+// closes the original stream.
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// ReplayRoutine reads the response records of the WARC files in dir and
+// hands them to the pipeline as if they had just been fetched.
+func (app *App) ReplayRoutine(dir string) (<-chan *Task, error) {
+	files, err := warc.Files(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ReplayRoutine: %s", err.Error())
+	}
+	out := make(chan *Task, app.Cfg.Pipeline.Buffer)
+	app.spawn(func() {
+		defer close(out)
+		for _, path := range files {
+			if err := app.replayFile(path, out); err != nil {
+				app.Logger.Error("ReplayRoutine: "+err.Error(),
+					slog.String("file", path))
+				app.ErrCount.Add(1)
+			}
+			if app.Ctx.Err() != nil {
+				return
+			}
+		}
+	})
+	return out, nil
+}
+
+func (app *App) replayFile(path string, out chan<- *Task) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := warc.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Type() != "response" {
+			continue
+		}
+		res, err := rec.Response()
+		if err != nil {
+			app.Logger.Error("ReplayRoutine: "+err.Error(),
+				slog.String("url", rec.TargetURI()))
+			app.ErrCount.Add(1)
+			continue
+		}
+		task := &Task{
+			Job:   scheduler.NewJob(rec.TargetURI()),
+			Fetch: &worker.FetchResponse{Response: res, HostName: res.Request.URL},
+		}
+		select {
+		case out <- task:
+			app.Count.Add(1)
+		case <-app.Ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Replay runs the archived responses in dir through parsing, processing
+// and storage, without touching the network or following links. It
+// returns once every record was stored.
+func (app *App) Replay(dir string) error {
+	replayed, err := app.ReplayRoutine(dir)
+	if err != nil {
+		return err
+	}
+	parsed := app.ParserRoutine(replayed)
+	processed := app.ProcessorRoutine(parsed)
+	stored := app.StorageRoutine(processed)
+	app.runStage(1, stored, nil, func() func(*Task) bool {
+		return func(*Task) bool {
+			return false
+		}
+	})
+	return app.group.Wait()
+}
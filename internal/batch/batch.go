@@ -0,0 +1,144 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ERROR_BATCHER_CLOSED = errors.New("batcher is closed")
+
+// FlushFunc writes a batch and returns one error per item, in the same
+// order as items; a nil entry means the item was written.
+type FlushFunc[T any] func(ctx context.Context, items []T) []error
+
+type Options struct {
+	Size     int
+	Interval time.Duration
+	Retries  int
+	Backoff  time.Duration
+}
+
+// Batcher buffers items and writes them with a single FlushFunc call once
+// Size items are waiting or Interval has passed. Items that fail are
+// retried on their own up to Retries times before OnFailure is called;
+// OnSuccess is called for every item once it was written.
+type Batcher[T any] struct {
+	OnFailure func(item T, err error)
+	OnSuccess func(item T)
+
+	opts    Options
+	flush   FlushFunc[T]
+	in      chan T
+	done    chan struct{}
+	closeMu sync.RWMutex
+	closed  bool
+
+	Written atomic.Int64
+	Failed  atomic.Int64
+	Retried atomic.Int64
+}
+
+func NewBatcher[T any](opts Options, flush FlushFunc[T]) *Batcher[T] {
+	opts.Size = max(opts.Size, 1)
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	b := &Batcher[T]{
+		opts:  opts,
+		flush: flush,
+		in:    make(chan T, opts.Size),
+		done:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add queues item for the next flush. It blocks while a full batch is
+// waiting to be written, so slow storage pushes back on the caller.
+func (b *Batcher[T]) Add(ctx context.Context, item T) error {
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+	if b.closed {
+		return ERROR_BATCHER_CLOSED
+	}
+	select {
+	case b.in <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes what is buffered and waits for the last write to finish.
+func (b *Batcher[T]) Close() {
+	b.closeMu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.in)
+	}
+	b.closeMu.Unlock()
+	<-b.done
+}
+
+func (b *Batcher[T]) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	buf := make([]T, 0, b.opts.Size)
+	for {
+		select {
+		case item, ok := <-b.in:
+			if !ok {
+				b.write(buf)
+				return
+			}
+			buf = append(buf, item)
+			if len(buf) >= b.opts.Size {
+				b.write(buf)
+				buf = make([]T, 0, b.opts.Size)
+			}
+		case <-ticker.C:
+			if len(buf) > 0 {
+				b.write(buf)
+				buf = make([]T, 0, b.opts.Size)
+			}
+		}
+	}
+}
+
+func (b *Batcher[T]) write(items []T) {
+	for attempt := 0; len(items) > 0; attempt++ {
+		if attempt > 0 {
+			b.Retried.Add(int64(len(items)))
+			time.Sleep(b.opts.Backoff * time.Duration(attempt))
+		}
+		errs := b.flush(context.Background(), items)
+
+		failed := []T{}
+		for i, item := range items {
+			var err error
+			if i < len(errs) {
+				err = errs[i]
+			}
+			switch {
+			case err == nil:
+				b.Written.Add(1)
+				if b.OnSuccess != nil {
+					b.OnSuccess(item)
+				}
+			case attempt < b.opts.Retries:
+				failed = append(failed, item)
+			default:
+				b.Failed.Add(1)
+				if b.OnFailure != nil {
+					b.OnFailure(item, err)
+				}
+			}
+		}
+		items = failed
+	}
+}
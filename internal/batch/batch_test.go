@@ -0,0 +1,86 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlushBySize(t *testing.T) {
+	var mu sync.Mutex
+	batches := [][]int{}
+	b := NewBatcher(Options{Size: 3, Interval: time.Hour},
+		func(ctx context.Context, items []int) []error {
+			mu.Lock()
+			defer mu.Unlock()
+			batches = append(batches, items)
+			return make([]error, len(items))
+		})
+
+	for i := range 7 {
+		require.NoError(t, b.Add(context.Background(), i))
+	}
+	b.Close()
+
+	// Test: full batches are flushed right away and the rest on Close
+	assert.Equal(t, [][]int{{0, 1, 2}, {3, 4, 5}, {6}}, batches)
+	assert.Equal(t, int64(7), b.Written.Load())
+	assert.ErrorIs(t, b.Add(context.Background(), 8), ERROR_BATCHER_CLOSED)
+}
+
+func TestFlushByInterval(t *testing.T) {
+	flushed := make(chan []int, 1)
+	b := NewBatcher(Options{Size: 100, Interval: 10 * time.Millisecond},
+		func(ctx context.Context, items []int) []error {
+			flushed <- items
+			return nil
+		})
+	defer b.Close()
+
+	require.NoError(t, b.Add(context.Background(), 1))
+	select {
+	case items := <-flushed:
+		assert.Equal(t, []int{1}, items)
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed after the interval")
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	attempts := map[int]int{}
+	b := NewBatcher(Options{Size: 3, Interval: time.Hour, Retries: 2},
+		func(ctx context.Context, items []int) []error {
+			errs := make([]error, len(items))
+			for i, item := range items {
+				attempts[item]++
+				if item == 1 && attempts[item] < 3 || item == 2 {
+					errs[i] = errors.New("write failed")
+				}
+			}
+			return errs
+		})
+	failed := []int{}
+	b.OnFailure = func(item int, err error) {
+		failed = append(failed, item)
+	}
+	written := []int{}
+	b.OnSuccess = func(item int) {
+		written = append(written, item)
+	}
+
+	for i := range 3 {
+		require.NoError(t, b.Add(context.Background(), i))
+	}
+	b.Close()
+
+	// Test: only failed items are retried, until retries run out
+	assert.Equal(t, map[int]int{0: 1, 1: 3, 2: 3}, attempts)
+	assert.Equal(t, []int{2}, failed)
+	assert.Equal(t, []int{0, 1}, written)
+	assert.Equal(t, int64(2), b.Written.Load())
+	assert.Equal(t, int64(1), b.Failed.Load())
+}
@@ -7,17 +7,98 @@ import (
 )
 
 type Config struct {
-	Worker *WorkerConfig
-	DB     *DBConfig
-	Seed   []string
-	Log    *LogConfig
-	Index  *IndexConfig
+	Worker   *WorkerConfig
+	DB       *DBConfig
+	Seed     []string
+	Log      *LogConfig
+	Index    *IndexConfig
+	Sitemap  *SitemapConfig
+	Feed     *FeedConfig
+	Queue    *QueueConfig
+	Limit    *LimitConfig
+	Crawler  *CrawlerConfig
+	Pipeline *PipelineConfig
+	Batch    *BatchConfig
+	Warc     *WarcConfig
+	Rank     *RankConfig
+}
+
+type RankConfig struct {
+	Interval   time.Duration
+	Damping    float64
+	Iterations int
+	Tolerance  float64
+}
+
+type WarcConfig struct {
+	Enabled bool
+	Dir     string
+	Prefix  string
+	MaxSize int64
+}
+
+type BatchConfig struct {
+	Size     int
+	Interval time.Duration
+	Retries  int
+	Backoff  time.Duration
+}
+
+type PipelineConfig struct {
+	Buffer         int
+	ParseWorkers   int
+	ProcessWorkers int
+	StoreWorkers   int
+	FilterWorkers  int
+	Processors     []ProcessorConfig
+}
+
+type ProcessorConfig struct {
+	Name    string         `mapstructure:"name"`
+	Options map[string]any `mapstructure:"options"`
+}
+
+type CrawlerConfig struct {
+	Duration        time.Duration
+	ShutdownTimeout time.Duration
+}
+
+type LimitConfig struct {
+	GlobalRPS      float64
+	HostRPS        float64
+	MaxConcurrency int
+	PollInterval   time.Duration
+}
+
+type QueueConfig struct {
+	Size              int
+	SeedPollInterval  time.Duration
+	BlockPollInterval time.Duration
+	CrawlPollInterval time.Duration
+	CrawlClaimTimeout time.Duration
+	SpillInterval     time.Duration
+}
+
+type FeedConfig struct {
+	Enabled      bool
+	PollInterval time.Duration
+	MinInterval  time.Duration
+	MaxInterval  time.Duration
+	BatchSize    int
+}
+
+type SitemapConfig struct {
+	Enabled  bool
+	MaxDepth int
+	MaxURLs  int
 }
 
 type IndexConfig struct {
+	Enabled  bool
 	Addr     string
 	User     string
 	Pwd      string
+	Language string
 	Settings struct {
 		ShardsNum   int
 		ReplicasNum int
@@ -30,6 +111,8 @@ type LogConfig struct {
 
 type DBConfig struct {
 	ConnString string
+	Backend    string
+	DataDir    string
 }
 
 type WorkerConfig struct {
@@ -41,6 +124,53 @@ func setUpConfig(dir string) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(dir)
+	setDefaults()
+}
+
+func setDefaults() {
+	viper.SetDefault("sitemap.enabled", true)
+	viper.SetDefault("sitemap.max_depth", 3)
+	viper.SetDefault("sitemap.max_urls", 50000)
+	viper.SetDefault("feed.enabled", true)
+	viper.SetDefault("feed.poll_interval", "1m")
+	viper.SetDefault("feed.min_interval", "10m")
+	viper.SetDefault("feed.max_interval", "24h")
+	viper.SetDefault("feed.batch_size", 50)
+	viper.SetDefault("queue.size", 10000)
+	viper.SetDefault("queue.seed_poll_interval", "15s")
+	viper.SetDefault("queue.block_poll_interval", "1m")
+	viper.SetDefault("queue.crawl_poll_interval", "2s")
+	viper.SetDefault("queue.crawl_claim_timeout", "10m")
+	viper.SetDefault("queue.spill_interval", "5s")
+	viper.SetDefault("limit.global_rps", 0)
+	viper.SetDefault("limit.host_rps", 2)
+	viper.SetDefault("limit.max_concurrency", 100)
+	viper.SetDefault("limit.poll_interval", "2s")
+	viper.SetDefault("crawler.duration", "0s")
+	viper.SetDefault("crawler.shutdown_timeout", "30s")
+	viper.SetDefault("pipeline.buffer", 64)
+	viper.SetDefault("db.backend", "mongo")
+	viper.SetDefault("db.data_dir", "data")
+	viper.SetDefault("index.enabled", true)
+	viper.SetDefault("index.language", "english")
+	viper.SetDefault("index.settings.number_of_shards", 1)
+	viper.SetDefault("index.settings.number_of_replicas", 1)
+	viper.SetDefault("warc.enabled", false)
+	viper.SetDefault("warc.dir", "warc")
+	viper.SetDefault("warc.prefix", "jcrawler")
+	viper.SetDefault("warc.max_size", 1<<30)
+	viper.SetDefault("rank.interval", "1h")
+	viper.SetDefault("rank.damping", 0.85)
+	viper.SetDefault("rank.iterations", 50)
+	viper.SetDefault("rank.tolerance", 1e-6)
+	viper.SetDefault("batch.size", 100)
+	viper.SetDefault("batch.interval", "1s")
+	viper.SetDefault("batch.retries", 3)
+	viper.SetDefault("batch.backoff", "500ms")
+	viper.SetDefault("pipeline.parse_workers", 4)
+	viper.SetDefault("pipeline.process_workers", 4)
+	viper.SetDefault("pipeline.store_workers", 8)
+	viper.SetDefault("pipeline.filter_workers", 4)
 }
 
 func NewConfig(dirPath string) (*Config, error) {
@@ -50,10 +180,19 @@ func NewConfig(dirPath string) (*Config, error) {
 		return nil, fmt.Errorf("NewConfig: %s", err.Error())
 	}
 	var c = Config{
-		Worker: new(WorkerConfig),
-		DB:     new(DBConfig),
-		Log:    new(LogConfig),
-		Index:  new(IndexConfig),
+		Worker:   new(WorkerConfig),
+		DB:       new(DBConfig),
+		Log:      new(LogConfig),
+		Index:    new(IndexConfig),
+		Sitemap:  new(SitemapConfig),
+		Feed:     new(FeedConfig),
+		Queue:    new(QueueConfig),
+		Limit:    new(LimitConfig),
+		Crawler:  new(CrawlerConfig),
+		Pipeline: new(PipelineConfig),
+		Batch:    new(BatchConfig),
+		Warc:     new(WarcConfig),
+		Rank:     new(RankConfig),
 	}
 	err = extractValues(&c)
 	if err != nil {
@@ -71,6 +210,17 @@ func extractValues(c *Config) error {
 	extractSeed(c)
 	extractLogConfig(c)
 	extractIndexConfig(c)
+	extractSitemapConfig(c)
+	extractFeedConfig(c)
+	extractQueueConfig(c)
+	extractLimitConfig(c)
+	extractCrawlerConfig(c)
+	extractBatchConfig(c)
+	extractWarcConfig(c)
+	extractRankConfig(c)
+	if err := extractPipelineConfig(c); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -94,8 +244,16 @@ func extractDBConfig(c *Config) error {
 	if err != nil {
 		return fmt.Errorf("extractDBConfig: %s", err.Error())
 	}
+	if err := viper.BindEnv("data_dir"); err != nil {
+		return fmt.Errorf("extractDBConfig: %s", err.Error())
+	}
 	connString := viper.GetString("conn_string")
 	c.DB.ConnString = connString
+	c.DB.Backend = viper.GetString("db.backend")
+	c.DB.DataDir = viper.GetString("data_dir")
+	if c.DB.DataDir == "" {
+		c.DB.DataDir = viper.GetString("db.data_dir")
+	}
 	return nil
 }
 
@@ -108,11 +266,84 @@ func extractLogConfig(c *Config) {
 }
 
 func extractIndexConfig(c *Config) {
+	c.Index.Enabled = viper.GetBool("index.enabled")
 	c.Index.Addr = viper.GetString("index.address")
 	c.Index.User = viper.GetString("index.username")
 	c.Index.Pwd = viper.GetString("index.password")
-	shardsNum := viper.GetInt("index.settings.number_of_shards")
-	replicasNum := viper.GetInt("index.settings.number_of_replics")
-	c.Index.Settings.ReplicasNum = replicasNum
-	c.Index.Settings.ReplicasNum = shardsNum
+	c.Index.Language = viper.GetString("index.language")
+	c.Index.Settings.ShardsNum = viper.GetInt("index.settings.number_of_shards")
+	c.Index.Settings.ReplicasNum = viper.GetInt("index.settings.number_of_replicas")
+	// number_of_replics is the misspelled key older configs use.
+	if !viper.InConfig("index.settings.number_of_replicas") && viper.IsSet("index.settings.number_of_replics") {
+		c.Index.Settings.ReplicasNum = viper.GetInt("index.settings.number_of_replics")
+	}
+}
+
+func extractSitemapConfig(c *Config) {
+	c.Sitemap.Enabled = viper.GetBool("sitemap.enabled")
+	c.Sitemap.MaxDepth = viper.GetInt("sitemap.max_depth")
+	c.Sitemap.MaxURLs = viper.GetInt("sitemap.max_urls")
+}
+
+func extractFeedConfig(c *Config) {
+	c.Feed.Enabled = viper.GetBool("feed.enabled")
+	c.Feed.PollInterval = viper.GetDuration("feed.poll_interval")
+	c.Feed.MinInterval = viper.GetDuration("feed.min_interval")
+	c.Feed.MaxInterval = viper.GetDuration("feed.max_interval")
+	c.Feed.BatchSize = viper.GetInt("feed.batch_size")
+}
+
+func extractQueueConfig(c *Config) {
+	c.Queue.Size = viper.GetInt("queue.size")
+	c.Queue.SeedPollInterval = viper.GetDuration("queue.seed_poll_interval")
+	c.Queue.BlockPollInterval = viper.GetDuration("queue.block_poll_interval")
+	c.Queue.CrawlPollInterval = viper.GetDuration("queue.crawl_poll_interval")
+	c.Queue.CrawlClaimTimeout = viper.GetDuration("queue.crawl_claim_timeout")
+	c.Queue.SpillInterval = viper.GetDuration("queue.spill_interval")
+}
+
+func extractLimitConfig(c *Config) {
+	c.Limit.GlobalRPS = viper.GetFloat64("limit.global_rps")
+	c.Limit.HostRPS = viper.GetFloat64("limit.host_rps")
+	c.Limit.MaxConcurrency = viper.GetInt("limit.max_concurrency")
+	c.Limit.PollInterval = viper.GetDuration("limit.poll_interval")
+}
+
+func extractCrawlerConfig(c *Config) {
+	c.Crawler.Duration = viper.GetDuration("crawler.duration")
+	c.Crawler.ShutdownTimeout = viper.GetDuration("crawler.shutdown_timeout")
+}
+
+func extractBatchConfig(c *Config) {
+	c.Batch.Size = viper.GetInt("batch.size")
+	c.Batch.Interval = viper.GetDuration("batch.interval")
+	c.Batch.Retries = viper.GetInt("batch.retries")
+	c.Batch.Backoff = viper.GetDuration("batch.backoff")
+}
+
+func extractWarcConfig(c *Config) {
+	c.Warc.Enabled = viper.GetBool("warc.enabled")
+	c.Warc.Dir = viper.GetString("warc.dir")
+	c.Warc.Prefix = viper.GetString("warc.prefix")
+	c.Warc.MaxSize = viper.GetInt64("warc.max_size")
+}
+
+func extractRankConfig(c *Config) {
+	c.Rank.Interval = viper.GetDuration("rank.interval")
+	c.Rank.Damping = viper.GetFloat64("rank.damping")
+	c.Rank.Iterations = viper.GetInt("rank.iterations")
+	c.Rank.Tolerance = viper.GetFloat64("rank.tolerance")
+}
+
+func extractPipelineConfig(c *Config) error {
+	c.Pipeline.Buffer = viper.GetInt("pipeline.buffer")
+	c.Pipeline.ParseWorkers = viper.GetInt("pipeline.parse_workers")
+	c.Pipeline.ProcessWorkers = viper.GetInt("pipeline.process_workers")
+	c.Pipeline.StoreWorkers = viper.GetInt("pipeline.store_workers")
+	c.Pipeline.FilterWorkers = viper.GetInt("pipeline.filter_workers")
+	err := viper.UnmarshalKey("pipeline.processors", &c.Pipeline.Processors)
+	if err != nil {
+		return fmt.Errorf("extractPipelineConfig: %s", err.Error())
+	}
+	return nil
 }
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+// BlockedURL is a page that was removed through the API. The crawler
+// skips it, so a removed page does not come back with the next crawl.
+type BlockedURL struct {
+	URLHash   string    `bson:"_id" json:"id"`
+	URL       string    `bson:"url" json:"url"`
+	BlockedAt time.Time `bson:"blocked_at" json:"blocked_at"`
+}
+
+// BlockURL adds b to the blocklist. Blocking a URL twice keeps the first
+// entry.
+func (s *Storage) BlockURL(b *BlockedURL) error {
+	coll := s.DB.Database("crawler").Collection("blocklist")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	_, err := coll.UpdateOne(context,
+		bson.D{{Key: "_id", Value: b.URLHash}},
+		bson.D{{Key: "$setOnInsert", Value: b}},
+		options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("BlockURL: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetBlocked() ([]*BlockedURL, error) {
+	coll := s.DB.Database("crawler").Collection("blocklist")
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(context, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("GetBlocked: %w", err)
+	}
+	blocked := []*BlockedURL{}
+	if err := cursor.All(context, &blocked); err != nil {
+		return nil, fmt.Errorf("GetBlocked: %w", err)
+	}
+	return blocked, nil
+}
+
+// GetBlockedURL returns the blocklist entry of the page id.
+func (s *Storage) GetBlockedURL(id string) (*BlockedURL, error) {
+	coll := s.DB.Database("crawler").Collection("blocklist")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var b BlockedURL
+	if err := coll.FindOne(context, bson.D{{Key: "_id", Value: id}}).Decode(&b); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ERROR_INVALID_ID
+		}
+		return nil, fmt.Errorf("GetBlockedURL: %w", err)
+	}
+	return &b, nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+// BulkUpsertPages writes pages with one unordered BulkWrite. It returns
+// one error per page, so a caller can retry only the pages that failed.
+func (s *Storage) BulkUpsertPages(pages []*Page) []error {
+	errs := make([]error, len(pages))
+	if len(pages) == 0 {
+		return errs
+	}
+	coll := s.DB.Database("crawler").Collection("pages")
+
+	models := make([]mongo.WriteModel, 0, len(pages))
+	for _, p := range pages {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "url_hash_id", Value: p.URLHash}}).
+			SetUpdate(pageUpdate(p)).
+			SetUpsert(true))
+	}
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := coll.BulkWrite(context, models, options.BulkWrite().SetOrdered(false))
+	if err == nil {
+		return errs
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("BulkUpsertPages: %w", err)
+		}
+		return errs
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Index >= 0 && we.Index < len(errs) {
+			errs[we.Index] = fmt.Errorf("BulkUpsertPages: %s", we.Error())
+		}
+	}
+	return errs
+}
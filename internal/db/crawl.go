@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+// States of an on-demand crawl job and of its targets. A job is queued
+// until a crawler claims it and done once every target finished; a target
+// is running from its fetch until it is stored or fails.
+const (
+	CrawlQueued  = "queued"
+	CrawlRunning = "running"
+	CrawlDone    = "done"
+	CrawlFailed  = "failed"
+)
+
+// CrawlTarget is one URL of an on-demand crawl and what came of it.
+type CrawlTarget struct {
+	URL        string     `bson:"url" json:"url"`
+	State      string     `bson:"state" json:"state"`
+	StatusCode int        `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`
+	FetchedAt  *time.Time `bson:"fetched_at,omitempty" json:"fetched_at,omitempty"`
+	FetchMs    int64      `bson:"fetch_ms,omitempty" json:"fetch_ms,omitempty"`
+	PageID     string     `bson:"page_id,omitempty" json:"page_id,omitempty"`
+	// Changed is set once the page is stored: false when its content is
+	// the same as in the stored copy.
+	Changed *bool `bson:"changed,omitempty" json:"changed,omitempty"`
+}
+
+// CrawlJob is a request, usually from the API, to fetch some URLs now. It
+// is how the API server hands work to a running crawler.
+type CrawlJob struct {
+	ID        string         `bson:"_id" json:"id"`
+	State     string         `bson:"state" json:"state"`
+	Targets   []*CrawlTarget `bson:"targets" json:"targets"`
+	CreatedAt time.Time      `bson:"created_at" json:"created_at"`
+	ClaimedAt *time.Time     `bson:"claimed_at,omitempty" json:"claimed_at,omitempty"`
+}
+
+// NewCrawlJob creates a queued job for urls with a fresh ID.
+func NewCrawlJob(urls []string) *CrawlJob {
+	job := &CrawlJob{
+		ID:        bson.NewObjectID().Hex(),
+		State:     CrawlQueued,
+		Targets:   make([]*CrawlTarget, 0, len(urls)),
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, u := range urls {
+		job.Targets = append(job.Targets, &CrawlTarget{URL: u, State: CrawlQueued})
+	}
+	return job
+}
+
+// Finished reports whether a target reached a final state.
+func (t *CrawlTarget) Finished() bool {
+	return t.State == CrawlDone || t.State == CrawlFailed
+}
+
+func (s *Storage) InsertCrawlJob(job *CrawlJob) error {
+	coll := s.DB.Database("crawler").Collection("crawl_jobs")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	if _, err := coll.InsertOne(context, job); err != nil {
+		return fmt.Errorf("InsertCrawlJob: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetCrawlJob(id string) (*CrawlJob, error) {
+	coll := s.DB.Database("crawler").Collection("crawl_jobs")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var job CrawlJob
+	if err := coll.FindOne(context, bson.D{{Key: "_id", Value: id}}).Decode(&job); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ERROR_INVALID_ID
+		}
+		return nil, fmt.Errorf("GetCrawlJob: %w", err)
+	}
+	return &job, nil
+}
+
+// ClaimCrawlJobs moves up to limit queued jobs, oldest first, to running
+// and returns them. Jobs claimed before staleBefore that are still running
+// are claimed again, as the crawler that took them may have died. Every
+// job is claimed with its own atomic update, so two crawlers never pick
+// the same one.
+func (s *Storage) ClaimCrawlJobs(limit int, staleBefore time.Time) ([]*CrawlJob, error) {
+	coll := s.DB.Database("crawler").Collection("crawl_jobs")
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	jobs := []*CrawlJob{}
+	for len(jobs) < limit {
+		context, cancel := context.WithTimeout(s.ctx, time.Second)
+		var job CrawlJob
+		err := coll.FindOneAndUpdate(context,
+			bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "state", Value: CrawlQueued}},
+				bson.D{
+					{Key: "state", Value: CrawlRunning},
+					{Key: "claimed_at", Value: bson.D{{Key: "$lt", Value: staleBefore}}},
+				},
+			}}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "state", Value: CrawlRunning},
+				{Key: "claimed_at", Value: time.Now().UTC()},
+			}}},
+			opts).Decode(&job)
+		cancel()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return jobs, fmt.Errorf("ClaimCrawlJobs: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// UpdateCrawlTarget replaces the target at position i of job id and marks
+// the job done once no target is left unfinished.
+func (s *Storage) UpdateCrawlTarget(id string, i int, t *CrawlTarget) error {
+	coll := s.DB.Database("crawler").Collection("crawl_jobs")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	res, err := coll.UpdateOne(context,
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: fmt.Sprintf("targets.%d", i), Value: t}}}})
+	if err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ERROR_INVALID_ID
+	}
+	_, err = coll.UpdateOne(context,
+		bson.D{
+			{Key: "_id", Value: id},
+			{Key: "targets.state", Value: bson.D{{Key: "$nin", Value: bson.A{CrawlQueued, CrawlRunning}}}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "state", Value: CrawlDone}}}})
+	if err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	return nil
+}
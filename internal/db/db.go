@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -9,6 +10,8 @@ import (
 	"time"
 )
 
+var collections = []string{"pages", "feeds", "seeds", "settings", "frontier", "migrations", "versions", "links", "queries", "blocklist", "crawl_jobs"}
+
 type Storage struct {
 	DB  *mongo.Client
 	ctx context.Context
@@ -17,7 +20,7 @@ type Storage struct {
 func NewStorage(uri string) (*Storage, error) {
 	client, err := connect(uri)
 	if err != nil {
-		return nil, fmt.Errorf("NewStorage: %s", err.Error())
+		return nil, fmt.Errorf("NewStorage: %w", err)
 	}
 	return &Storage{
 		DB:  client,
@@ -31,7 +34,7 @@ func connect(uri string) (*mongo.Client, error) {
 
 	client, err := mongo.Connect(opts)
 	if err != nil {
-		return nil, fmt.Errorf("connect: %s", err.Error())
+		return nil, fmt.Errorf("connect: %w", err)
 	}
 	return client, nil
 }
@@ -41,15 +44,28 @@ func (s *Storage) Init() error {
 	context, cancel := context.WithTimeout(s.ctx, time.Second)
 	defer cancel()
 	if err := s.DB.Database("admin").RunCommand(context, bson.D{{Key: "ping", Value: 1}}).Decode(&result); err != nil {
-		return fmt.Errorf("Init: %s", err.Error())
+		return fmt.Errorf("Init: %w", err)
+	}
+	for _, name := range collections {
+		if err := s.CreateCollection(name); err != nil {
+			return fmt.Errorf("Init: %w", err)
+		}
 	}
-	return s.CreateCollection("pages")
+	if _, err := s.MigrateUp(); err != nil {
+		return fmt.Errorf("Init: %w", err)
+	}
+	return nil
 }
 
 func (s *Storage) CreateCollection(name string) error {
 	context, cancel := context.WithTimeout(s.ctx, time.Second)
 	defer cancel()
-	return s.DB.Database("crawler").CreateCollection(context, name)
+	err := s.DB.Database("crawler").CreateCollection(context, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists" {
+		return nil
+	}
+	return err
 }
 
 func (s *Storage) CloseConnection() error {
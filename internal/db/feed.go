@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"slices"
+	"time"
+)
+
+const MAX_SEEN_FEED_ITEMS = 500
+
+type Feed struct {
+	URLHash      string        `bson:"url_hash_id"`
+	URL          string        `bson:"url"`
+	SourceURL    string        `bson:"source_url"`
+	ETag         string        `bson:"etag"`
+	LastModified string        `bson:"last_modified"`
+	Interval     time.Duration `bson:"interval"`
+	NextPollAt   time.Time     `bson:"next_poll_at"`
+	LastPolledAt time.Time     `bson:"last_polled_at"`
+	SeenItems    []string      `bson:"seen_items"`
+	CreatedAt    time.Time     `bson:"created_at"`
+}
+
+// HasSeen reports whether an item id was already present in an earlier
+// poll of the feed.
+func (f *Feed) HasSeen(id string) bool {
+	return slices.Contains(f.SeenItems, id)
+}
+
+// MarkSeen prepends ids to the seen list, keeping only the most recent
+// MAX_SEEN_FEED_ITEMS entries.
+func (f *Feed) MarkSeen(ids []string) {
+	f.SeenItems = append(ids, f.SeenItems...)
+	if len(f.SeenItems) > MAX_SEEN_FEED_ITEMS {
+		f.SeenItems = f.SeenItems[:MAX_SEEN_FEED_ITEMS]
+	}
+}
+
+func (s *Storage) InsertFeed(f *Feed) error {
+	coll := s.DB.Database("crawler").Collection("feeds")
+	filter := bson.D{{Key: "url_hash_id", Value: f.URLHash}}
+	update := bson.D{{Key: "$setOnInsert", Value: bson.D{
+		{Key: "url_hash_id", Value: f.URLHash},
+		{Key: "url", Value: f.URL},
+		{Key: "source_url", Value: f.SourceURL},
+		{Key: "interval", Value: f.Interval},
+		{Key: "next_poll_at", Value: f.NextPollAt},
+		{Key: "seen_items", Value: []string{}},
+		{Key: "created_at", Value: time.Now().UTC()},
+	}}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	_, err := coll.UpdateOne(context, filter, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("InsertFeed: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetDueFeeds(now time.Time, limit int) ([]*Feed, error) {
+	coll := s.DB.Database("crawler").Collection("feeds")
+	filter := bson.D{{Key: "next_poll_at", Value: bson.D{{Key: "$lte", Value: now}}}}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "next_poll_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(context, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("GetDueFeeds: %w", err)
+	}
+	defer cursor.Close(context)
+
+	feeds := []*Feed{}
+	if err := cursor.All(context, &feeds); err != nil {
+		return nil, fmt.Errorf("GetDueFeeds: %w", err)
+	}
+	return feeds, nil
+}
+
+func (s *Storage) UpdateFeed(f *Feed) error {
+	coll := s.DB.Database("crawler").Collection("feeds")
+	filter := bson.D{{Key: "url_hash_id", Value: f.URLHash}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "etag", Value: f.ETag},
+		{Key: "last_modified", Value: f.LastModified},
+		{Key: "interval", Value: f.Interval},
+		{Key: "next_poll_at", Value: f.NextPollAt},
+		{Key: "last_polled_at", Value: f.LastPolledAt},
+		{Key: "seen_items", Value: f.SeenItems},
+	}}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	res, err := coll.UpdateOne(context, filter, update)
+	if err != nil {
+		return fmt.Errorf("UpdateFeed: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ERROR_INVALID_ID
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+// FrontierEntry is a queued job saved between runs. CrawlID and
+// CrawlTarget are set for URLs of an on-demand crawl, so their progress
+// is still reported once they are restored.
+type FrontierEntry struct {
+	ID          bson.ObjectID `bson:"_id,omitempty"`
+	URL         string        `bson:"url"`
+	Priority    float64       `bson:"priority"`
+	LastMod     time.Time     `bson:"lastmod"`
+	ChangeFreq  string        `bson:"changefreq"`
+	SeedID      string        `bson:"seed_id"`
+	Depth       int           `bson:"depth"`
+	CrawlID     string        `bson:"crawl_id,omitempty"`
+	CrawlTarget int           `bson:"crawl_target,omitempty"`
+	SavedAt     time.Time     `bson:"saved_at"`
+}
+
+func (s *Storage) SaveFrontier(entries []*FrontierEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	coll := s.DB.Database("crawler").Collection("frontier")
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	if _, err := coll.InsertMany(context, entries); err != nil {
+		return fmt.Errorf("SaveFrontier: %w", err)
+	}
+	return nil
+}
+
+// LoadFrontier returns up to limit saved entries, highest priority first,
+// and removes them from the collection, so a restored entry is never
+// handed out twice. A limit of 0 loads the whole frontier.
+func (s *Storage) LoadFrontier(limit int) ([]*FrontierEntry, error) {
+	coll := s.DB.Database("crawler").Collection("frontier")
+	findOptions := options.Find().SetSort(bson.D{{Key: "priority", Value: -1}})
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(context, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+	defer cursor.Close(context)
+
+	entries := []*FrontierEntry{}
+	if err := cursor.All(context, &entries); err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+	if len(entries) == 0 {
+		return entries, nil
+	}
+
+	ids := make(bson.A, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if _, err := coll.DeleteMany(context, filter); err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+// RANK_BATCH is how many pages SetRanks updates per round trip.
+const RANK_BATCH = 1000
+
+// Link is one edge of the link graph, seen from its source page.
+type Link struct {
+	TargetHash string `bson:"target_hash" json:"target_hash"`
+	TargetURL  string `bson:"target_url" json:"target_url"`
+	Anchor     string `bson:"anchor" json:"anchor"`
+	Context    string `bson:"context" json:"context"`
+}
+
+// Anchor is one link to a page, seen from its target: who links to it
+// and with which words.
+type Anchor struct {
+	SourceHash string `bson:"url_hash_id" json:"source_id"`
+	SourceURL  string `bson:"url" json:"source_url"`
+	Text       string `bson:"anchor" json:"text"`
+	Context    string `bson:"context" json:"context"`
+}
+
+// PageLinks holds every outgoing link of one page. They are replaced as a
+// whole each time the page is stored, so links that disappeared from the
+// page also disappear from the graph.
+type PageLinks struct {
+	URLHash   string    `bson:"url_hash_id" json:"id"`
+	URL       string    `bson:"url" json:"url"`
+	Links     []Link    `bson:"links" json:"links"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// PageRank is the link score of a page as computed by the rank job.
+type PageRank struct {
+	URLHash  string
+	Rank     float64
+	InDegree int
+}
+
+// SaveLinks replaces the outgoing links of every page in ls with one
+// unordered BulkWrite and returns one error per page.
+func (s *Storage) SaveLinks(ls []*PageLinks) []error {
+	errs := make([]error, len(ls))
+	if len(ls) == 0 {
+		return errs
+	}
+	coll := s.DB.Database("crawler").Collection("links")
+
+	models := make([]mongo.WriteModel, 0, len(ls))
+	for _, l := range ls {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "url_hash_id", Value: l.URLHash}}).
+			SetReplacement(l).
+			SetUpsert(true))
+	}
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := coll.BulkWrite(context, models, options.BulkWrite().SetOrdered(false))
+	if err == nil {
+		return errs
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("SaveLinks: %w", err)
+		}
+		return errs
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Index >= 0 && we.Index < len(errs) {
+			errs[we.Index] = fmt.Errorf("SaveLinks: %s", we.Error())
+		}
+	}
+	return errs
+}
+
+// IterateLinks calls fn with the outgoing links of every page that was
+// stored and stops at the first error fn returns.
+func (s *Storage) IterateLinks(fn func(*PageLinks) error) error {
+	coll := s.DB.Database("crawler").Collection("links")
+
+	cursor, err := coll.Find(s.ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("IterateLinks: %w", err)
+	}
+	defer cursor.Close(s.ctx)
+
+	for cursor.Next(s.ctx) {
+		var l PageLinks
+		if err := cursor.Decode(&l); err != nil {
+			return fmt.Errorf("IterateLinks: %w", err)
+		}
+		if err := fn(&l); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("IterateLinks: %w", err)
+	}
+	return nil
+}
+
+// GetAnchors returns up to limit links that point at the page id from
+// other pages.
+func (s *Storage) GetAnchors(id string, limit int) ([]*Anchor, error) {
+	coll := s.DB.Database("crawler").Collection("links")
+	match := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "links.target_hash", Value: id},
+		{Key: "url_hash_id", Value: bson.D{{Key: "$ne", Value: id}}},
+	}}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	cursor, err := coll.Aggregate(context, mongo.Pipeline{
+		match,
+		{{Key: "$unwind", Value: "$links"}},
+		match,
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "url_hash_id", Value: 1},
+			{Key: "url", Value: 1},
+			{Key: "anchor", Value: "$links.anchor"},
+			{Key: "context", Value: "$links.context"},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetAnchors: %w", err)
+	}
+	anchors := []*Anchor{}
+	if err := cursor.All(context, &anchors); err != nil {
+		return nil, fmt.Errorf("GetAnchors: %w", err)
+	}
+	return anchors, nil
+}
+
+// SetRanks writes link scores onto stored pages. Scores of pages that were
+// linked to but never stored are skipped.
+func (s *Storage) SetRanks(ranks []*PageRank) error {
+	coll := s.DB.Database("crawler").Collection("pages")
+	for start := 0; start < len(ranks); start += RANK_BATCH {
+		batch := ranks[start:min(start+RANK_BATCH, len(ranks))]
+		models := make([]mongo.WriteModel, 0, len(batch))
+		for _, r := range batch {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "url_hash_id", Value: r.URLHash}}).
+				SetUpdate(bson.D{{Key: "$set", Value: bson.D{
+					{Key: "rank", Value: r.Rank},
+					{Key: "in_degree", Value: r.InDegree},
+				}}}))
+		}
+
+		context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+		_, err := coll.BulkWrite(context, models, options.BulkWrite().SetOrdered(false))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("SetRanks: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteLinks removes the outgoing links of a page, so it no longer lends
+// rank or anchor text to the pages it linked to. A page without links is
+// not an error.
+func (s *Storage) DeleteLinks(id string) error {
+	coll := s.DB.Database("crawler").Collection("links")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	if _, err := coll.DeleteMany(context, bson.D{{Key: "url_hash_id", Value: id}}); err != nil {
+		return fmt.Errorf("DeleteLinks: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,565 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const LOCAL_DB_FILE = "jcrawler.db"
+
+// TITLE_WEIGHT is how many content occurrences of a term one in the title
+// is worth in the local search index.
+const TITLE_WEIGHT = 5
+
+// SQLITE_BUSY and SQLITE_LOCKED are the primary result codes SQLite
+// returns when another connection holds the lock for too long.
+const (
+	SQLITE_BUSY   = 5
+	SQLITE_LOCKED = 6
+)
+
+var ERROR_EMPTY_DATA_DIR = errors.New("empty data directory")
+
+// localMigrations are applied in order and tracked in PRAGMA user_version,
+// the embedded counterpart of the Mongo migrations. Like those, they must
+// only be appended to.
+//
+// The inverted index lives next to the pages: postings holds one row per
+// term and page with the term's weight, so a search is a single grouped
+// lookup over the query terms.
+var localMigrations = [][]string{{
+	`CREATE TABLE IF NOT EXISTS pages (
+		url_hash_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		title TEXT NOT NULL,
+		page_content TEXT NOT NULL,
+		updated_at INTEGER NOT NULL,
+		meta TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS postings (
+		term TEXT NOT NULL,
+		url_hash_id TEXT NOT NULL,
+		weight INTEGER NOT NULL,
+		PRIMARY KEY (term, url_hash_id)
+	) WITHOUT ROWID`,
+	`CREATE INDEX IF NOT EXISTS postings_url_hash_id ON postings (url_hash_id)`,
+	`CREATE TABLE IF NOT EXISTS seeds (
+		seed_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL UNIQUE,
+		depth INTEGER NOT NULL,
+		budget INTEGER NOT NULL,
+		tags TEXT NOT NULL,
+		paused INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS feeds (
+		url_hash_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		source_url TEXT NOT NULL,
+		etag TEXT NOT NULL,
+		last_modified TEXT NOT NULL,
+		interval INTEGER NOT NULL,
+		next_poll_at INTEGER NOT NULL,
+		last_polled_at INTEGER NOT NULL,
+		seen_items TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS feeds_next_poll_at ON feeds (next_poll_at)`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		id TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS frontier (
+		url TEXT NOT NULL,
+		priority REAL NOT NULL,
+		lastmod INTEGER NOT NULL,
+		changefreq TEXT NOT NULL,
+		seed_id TEXT NOT NULL,
+		depth INTEGER NOT NULL,
+		saved_at INTEGER NOT NULL
+	)`,
+}, {
+	`ALTER TABLE pages ADD COLUMN content_hash TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE versions (
+		url_hash_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		content_hash TEXT NOT NULL,
+		title TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		snapshot BLOB NOT NULL,
+		PRIMARY KEY (url_hash_id, version)
+	)`,
+}, {
+	`ALTER TABLE pages ADD COLUMN rank REAL NOT NULL DEFAULT 0`,
+	`ALTER TABLE pages ADD COLUMN in_degree INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE link_sources (
+		url_hash_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE links (
+		url_hash_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		target_hash TEXT NOT NULL,
+		target_url TEXT NOT NULL,
+		anchor TEXT NOT NULL,
+		PRIMARY KEY (url_hash_id, position)
+	) WITHOUT ROWID`,
+}, {
+	`ALTER TABLE links ADD COLUMN context TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX links_target_hash ON links (target_hash)`,
+}, {
+	`ALTER TABLE pages ADD COLUMN language TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN content_type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN keywords TEXT`,
+}, {
+	`CREATE TABLE queries (
+		query TEXT PRIMARY KEY,
+		count INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL
+	) WITHOUT ROWID`,
+}, {
+	`CREATE TABLE blocklist (
+		url_hash_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		blocked_at INTEGER NOT NULL
+	) WITHOUT ROWID`,
+}, {
+	`CREATE TABLE crawl_jobs (
+		job_id TEXT PRIMARY KEY,
+		state TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		claimed_at INTEGER
+	)`,
+	`CREATE INDEX crawl_jobs_state ON crawl_jobs (state, created_at)`,
+	`CREATE TABLE crawl_targets (
+		job_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		state TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		fetched_at INTEGER,
+		fetch_ms INTEGER NOT NULL DEFAULT 0,
+		page_id TEXT NOT NULL DEFAULT '',
+		changed INTEGER,
+		PRIMARY KEY (job_id, position)
+	) WITHOUT ROWID`,
+}, {
+	`ALTER TABLE pages ADD COLUMN crawled_at INTEGER NOT NULL DEFAULT 0`,
+}, {
+	`ALTER TABLE frontier ADD COLUMN crawl_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE frontier ADD COLUMN crawl_target INTEGER NOT NULL DEFAULT 0`,
+}, {
+	`CREATE INDEX queries_last_seen ON queries (last_seen)`,
+	`CREATE INDEX queries_count ON queries (count DESC, query)`,
+}}
+
+// LocalStore keeps everything in a single SQLite file inside a data
+// directory, so a crawl needs neither MongoDB nor OpenSearch. WAL mode and
+// a busy timeout let the crawler and the API server use the same file.
+type LocalStore struct {
+	db *sql.DB
+}
+
+// isBusy reports whether err is SQLite giving up on a locked database
+// after the busy timeout.
+func isBusy(err error) bool {
+	var serr *sqlite.Error
+	if !errors.As(err, &serr) {
+		return false
+	}
+	code := serr.Code() & 0xff
+	return code == SQLITE_BUSY || code == SQLITE_LOCKED
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, ERROR_EMPTY_DATA_DIR
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("NewLocalStore: %w", err)
+	}
+	dsn := "file:" + filepath.Join(dir, LOCAL_DB_FILE) +
+		"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_txlock=immediate"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("NewLocalStore: %w", err)
+	}
+	l := &LocalStore{db: conn}
+	if err := l.migrate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("NewLocalStore: %w", err)
+	}
+	return l, nil
+}
+
+func (l *LocalStore) migrate() error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(localMigrations); version++ {
+		for _, stmt := range localMigrations[version] {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %d: %w", version+1, err)
+			}
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (l *LocalStore) CloseConnection() error {
+	return l.db.Close()
+}
+
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnix(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPage(row rowScanner) (*Page, error) {
+	var p Page
+	var updatedAt, crawledAt int64
+	var meta, keywords sql.NullString
+	err := row.Scan(&p.URLHash, &p.URL, &p.Title, &p.Content, &updatedAt, &meta, &p.ContentHash,
+		&p.Rank, &p.InDegree, &p.Language, &p.ContentType, &keywords, &crawledAt)
+	if err != nil {
+		return nil, err
+	}
+	if keywords.Valid && keywords.String != "" {
+		if err := json.Unmarshal([]byte(keywords.String), &p.Keywords); err != nil {
+			return nil, err
+		}
+	}
+	p.UpdatedAt = fromUnix(updatedAt)
+	p.CrawledAt = fromUnix(crawledAt)
+	if meta.Valid && meta.String != "" {
+		if err := json.Unmarshal([]byte(meta.String), &p.Meta); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+const pageColumns = "url_hash_id, url, title, page_content, updated_at, meta, content_hash, rank, in_degree, " +
+	"language, content_type, keywords, crawled_at"
+
+func (l *LocalStore) GetPageByID(id string) (*Page, error) {
+	row := l.db.QueryRow("SELECT "+pageColumns+" FROM pages WHERE url_hash_id = ?", id)
+	p, err := scanPage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ERROR_INVALID_ID
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetPageByID: %w", err)
+	}
+	return p, nil
+}
+
+func (l *LocalStore) GetPagesByIDs(ids []string) ([]*Page, error) {
+	if len(ids) == 0 {
+		return []*Page{}, nil
+	}
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := l.db.Query("SELECT "+pageColumns+" FROM pages WHERE url_hash_id IN (?"+
+		strings.Repeat(", ?", len(ids)-1)+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetPagesByIDs: %w", err)
+	}
+	defer rows.Close()
+
+	found := []*Page{}
+	for rows.Next() {
+		p, err := scanPage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetPagesByIDs: %w", err)
+		}
+		found = append(found, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetPagesByIDs: %w", err)
+	}
+	return orderPages(ids, found), nil
+}
+
+func (l *LocalStore) InsertPage(p *Page) (PageStatus, error) {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return PageUnchanged, fmt.Errorf("InsertPage: %w", err)
+	}
+	defer tx.Rollback()
+
+	status, err := upsertLocalPage(tx, p)
+	if err != nil {
+		return PageUnchanged, fmt.Errorf("InsertPage: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return PageUnchanged, fmt.Errorf("InsertPage: %w", err)
+	}
+	return status, nil
+}
+
+// BulkUpsertPages writes all pages in one transaction. A page that fails
+// is rolled back to a savepoint, so it does not take the others with it.
+func (l *LocalStore) BulkUpsertPages(pages []*Page) []error {
+	errs := make([]error, len(pages))
+	failAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = fmt.Errorf("BulkUpsertPages: %w", err)
+		}
+		return errs
+	}
+	if len(pages) == 0 {
+		return errs
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return failAll(err)
+	}
+	defer tx.Rollback()
+
+	for i, p := range pages {
+		if _, err := tx.Exec("SAVEPOINT page"); err != nil {
+			return failAll(err)
+		}
+		if _, err := upsertLocalPage(tx, p); err != nil {
+			errs[i] = fmt.Errorf("BulkUpsertPages: %w", err)
+			if _, err := tx.Exec("ROLLBACK TO page"); err != nil {
+				return failAll(err)
+			}
+		}
+		if _, err := tx.Exec("RELEASE page"); err != nil {
+			return failAll(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return failAll(err)
+	}
+	return errs
+}
+
+// upsertLocalPage follows the Mongo upsert: updated_at only moves when the
+// title or content changed, and only then are the postings rebuilt.
+func upsertLocalPage(tx *sql.Tx, p *Page) (PageStatus, error) {
+	var meta []byte
+	if len(p.Meta) > 0 {
+		var err error
+		if meta, err = json.Marshal(p.Meta); err != nil {
+			return PageUnchanged, err
+		}
+	}
+	var keywords []byte
+	if len(p.Keywords) > 0 {
+		var err error
+		if keywords, err = json.Marshal(p.Keywords); err != nil {
+			return PageUnchanged, err
+		}
+	}
+	updatedAt := p.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now().UTC()
+	}
+	crawledAt := p.CrawledAt
+	if crawledAt.IsZero() {
+		crawledAt = updatedAt
+	}
+
+	old, err := scanPage(tx.QueryRow("SELECT "+pageColumns+" FROM pages WHERE url_hash_id = ?", p.URLHash))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err := tx.Exec("INSERT INTO pages ("+pageColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			p.URLHash, p.URL, p.Title, p.Content, toUnix(updatedAt), nullString(meta), p.ContentHash,
+			p.Rank, p.InDegree, p.Language, p.ContentType, nullString(keywords), toUnix(crawledAt))
+		if err != nil {
+			return PageUnchanged, err
+		}
+		return PageCreated, indexLocalPage(tx, p)
+	case err != nil:
+		return PageUnchanged, err
+	}
+
+	if pageStatus(old, p) == PageUnchanged {
+		_, err := tx.Exec("UPDATE pages SET crawled_at = ? WHERE url_hash_id = ?", toUnix(crawledAt), p.URLHash)
+		return PageUnchanged, err
+	}
+	changed := textChanged(old, p)
+	if !changed {
+		updatedAt = old.UpdatedAt
+	}
+	_, err = tx.Exec(`UPDATE pages SET url = ?, title = ?, page_content = ?, updated_at = ?, meta = ?,
+		content_hash = ?, language = ?, content_type = ?, keywords = ?, crawled_at = ? WHERE url_hash_id = ?`,
+		p.URL, p.Title, p.Content, toUnix(updatedAt), nullString(meta), p.ContentHash,
+		p.Language, p.ContentType, nullString(keywords), toUnix(crawledAt), p.URLHash)
+	if err != nil {
+		return PageUnchanged, err
+	}
+	if changed {
+		if err := indexLocalPage(tx, p); err != nil {
+			return PageUnchanged, err
+		}
+	}
+	return PageModified, nil
+}
+
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// termWeights counts how often every term occurs in a page, with a title
+// occurrence worth TITLE_WEIGHT content ones like in the Mongo text index.
+func termWeights(p *Page) map[string]int {
+	weights := make(map[string]int)
+	for _, term := range tokenize(p.Title) {
+		weights[term] += TITLE_WEIGHT
+	}
+	for _, term := range tokenize(p.Content) {
+		weights[term]++
+	}
+	return weights
+}
+
+func indexLocalPage(tx *sql.Tx, p *Page) error {
+	if _, err := tx.Exec("DELETE FROM postings WHERE url_hash_id = ?", p.URLHash); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO postings (term, url_hash_id, weight) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for term, weight := range termWeights(p) {
+		if _, err := stmt.Exec(term, p.URLHash, weight); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LocalStore) DeletePageByID(id string) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("DeletePageByID: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM pages WHERE url_hash_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("DeletePageByID: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ERROR_INVALID_ID
+	}
+	if _, err := tx.Exec("DELETE FROM postings WHERE url_hash_id = ?", id); err != nil {
+		return fmt.Errorf("DeletePageByID: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("DeletePageByID: %w", err)
+	}
+	return nil
+}
+
+// GetPagesByIndex ranks pages by the summed weights of the query terms
+// and breaks ties by link rank. It returns the best limit of them.
+func (l *LocalStore) GetPagesByIndex(query string, limit int) ([]*PageServe, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []*PageServe{}, nil
+	}
+	args := make([]any, 0, len(terms)+1)
+	for _, term := range terms {
+		args = append(args, term)
+	}
+	args = append(args, limit)
+
+	rows, err := l.db.Query(`SELECT p.url_hash_id, p.url, p.title, p.updated_at, SUM(t.weight) AS score
+		FROM postings t JOIN pages p ON p.url_hash_id = t.url_hash_id
+		WHERE t.term IN (?`+strings.Repeat(", ?", len(terms)-1)+`)
+		GROUP BY p.url_hash_id
+		ORDER BY score DESC, p.rank DESC, p.url
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetPagesByIndex: %w", err)
+	}
+	defer rows.Close()
+
+	res := []*PageServe{}
+	for rows.Next() {
+		var ps PageServe
+		var updatedAt, score int64
+		if err := rows.Scan(&ps.ID, &ps.URL, &ps.Title, &updatedAt, &score); err != nil {
+			return nil, fmt.Errorf("GetPagesByIndex: %w", err)
+		}
+		t := fromUnix(updatedAt)
+		ps.UpdatedAt = &t
+		res = append(res, &ps)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetPagesByIndex: %w", err)
+	}
+	return res, nil
+}
+
+func (l *LocalStore) IteratePages(fn func(*Page) error) error {
+	rows, err := l.db.Query("SELECT " + pageColumns + " FROM pages ORDER BY url")
+	if err != nil {
+		return fmt.Errorf("IteratePages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPage(rows)
+		if err != nil {
+			return fmt.Errorf("IteratePages: %w", err)
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("IteratePages: %w", err)
+	}
+	return nil
+}
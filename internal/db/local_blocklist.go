@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (l *LocalStore) BlockURL(b *BlockedURL) error {
+	_, err := l.db.Exec(`INSERT INTO blocklist (url_hash_id, url, blocked_at) VALUES (?, ?, ?)
+		ON CONFLICT (url_hash_id) DO NOTHING`, b.URLHash, b.URL, toUnix(b.BlockedAt))
+	if err != nil {
+		return fmt.Errorf("BlockURL: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStore) GetBlocked() ([]*BlockedURL, error) {
+	rows, err := l.db.Query("SELECT url_hash_id, url, blocked_at FROM blocklist ORDER BY blocked_at")
+	if err != nil {
+		return nil, fmt.Errorf("GetBlocked: %w", err)
+	}
+	defer rows.Close()
+
+	blocked := []*BlockedURL{}
+	for rows.Next() {
+		var b BlockedURL
+		var blockedAt int64
+		if err := rows.Scan(&b.URLHash, &b.URL, &blockedAt); err != nil {
+			return nil, fmt.Errorf("GetBlocked: %w", err)
+		}
+		b.BlockedAt = fromUnix(blockedAt)
+		blocked = append(blocked, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetBlocked: %w", err)
+	}
+	return blocked, nil
+}
+
+func (l *LocalStore) GetBlockedURL(id string) (*BlockedURL, error) {
+	var b BlockedURL
+	var blockedAt int64
+	err := l.db.QueryRow("SELECT url_hash_id, url, blocked_at FROM blocklist WHERE url_hash_id = ?", id).
+		Scan(&b.URLHash, &b.URL, &blockedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ERROR_INVALID_ID
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetBlockedURL: %w", err)
+	}
+	b.BlockedAt = fromUnix(blockedAt)
+	return &b, nil
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const crawlTargetColumns = "url, state, status_code, error, fetched_at, fetch_ms, page_id, changed"
+
+func (l *LocalStore) InsertCrawlJob(job *CrawlJob) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("InsertCrawlJob: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO crawl_jobs (job_id, state, created_at) VALUES (?, ?, ?)",
+		job.ID, job.State, toUnix(job.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("InsertCrawlJob: %w", err)
+	}
+	for i, t := range job.Targets {
+		if err := putCrawlTarget(tx, job.ID, i, t); err != nil {
+			return fmt.Errorf("InsertCrawlJob: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("InsertCrawlJob: %w", err)
+	}
+	return nil
+}
+
+func putCrawlTarget(tx *sql.Tx, id string, i int, t *CrawlTarget) error {
+	var fetchedAt sql.NullInt64
+	if t.FetchedAt != nil {
+		fetchedAt = sql.NullInt64{Int64: toUnix(*t.FetchedAt), Valid: true}
+	}
+	var changed sql.NullBool
+	if t.Changed != nil {
+		changed = sql.NullBool{Bool: *t.Changed, Valid: true}
+	}
+	_, err := tx.Exec(`INSERT OR REPLACE INTO crawl_targets (job_id, position, `+crawlTargetColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, i, t.URL, t.State, t.StatusCode, t.Error, fetchedAt, t.FetchMs, t.PageID, changed)
+	return err
+}
+
+func (l *LocalStore) GetCrawlJob(id string) (*CrawlJob, error) {
+	job, err := l.getCrawlJob(id)
+	if errors.Is(err, ERROR_INVALID_ID) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetCrawlJob: %w", err)
+	}
+	return job, nil
+}
+
+func (l *LocalStore) getCrawlJob(id string) (*CrawlJob, error) {
+	job := &CrawlJob{ID: id}
+	var createdAt int64
+	var claimedAt sql.NullInt64
+	err := l.db.QueryRow("SELECT state, created_at, claimed_at FROM crawl_jobs WHERE job_id = ?", id).
+		Scan(&job.State, &createdAt, &claimedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ERROR_INVALID_ID
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.CreatedAt = fromUnix(createdAt)
+	if claimedAt.Valid {
+		t := fromUnix(claimedAt.Int64)
+		job.ClaimedAt = &t
+	}
+
+	rows, err := l.db.Query("SELECT "+crawlTargetColumns+" FROM crawl_targets WHERE job_id = ? ORDER BY position", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	job.Targets = []*CrawlTarget{}
+	for rows.Next() {
+		var t CrawlTarget
+		var fetchedAt sql.NullInt64
+		var changed sql.NullBool
+		err := rows.Scan(&t.URL, &t.State, &t.StatusCode, &t.Error, &fetchedAt, &t.FetchMs, &t.PageID, &changed)
+		if err != nil {
+			return nil, err
+		}
+		if fetchedAt.Valid {
+			at := fromUnix(fetchedAt.Int64)
+			t.FetchedAt = &at
+		}
+		if changed.Valid {
+			t.Changed = &changed.Bool
+		}
+		job.Targets = append(job.Targets, &t)
+	}
+	return job, rows.Err()
+}
+
+// claimable matches the jobs ClaimCrawlJobs may take: queued ones and
+// running ones whose claim went stale.
+const claimable = "(state = ? OR state = ? AND claimed_at < ?)"
+
+// ClaimCrawlJobs moves up to limit queued jobs, oldest first, to running,
+// along with running jobs claimed before staleBefore. The state check in
+// the update keeps a second process sharing the file from claiming the
+// same job.
+func (l *LocalStore) ClaimCrawlJobs(limit int, staleBefore time.Time) ([]*CrawlJob, error) {
+	stale := toUnix(staleBefore)
+	rows, err := l.db.Query("SELECT job_id FROM crawl_jobs WHERE "+claimable+" ORDER BY created_at LIMIT ?",
+		CrawlQueued, CrawlRunning, stale, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimCrawlJobs: %w", err)
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ClaimCrawlJobs: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ClaimCrawlJobs: %w", err)
+	}
+
+	jobs := []*CrawlJob{}
+	for _, id := range ids {
+		res, err := l.db.Exec("UPDATE crawl_jobs SET state = ?, claimed_at = ? WHERE job_id = ? AND "+claimable,
+			CrawlRunning, toUnix(time.Now().UTC()), id, CrawlQueued, CrawlRunning, stale)
+		if err != nil {
+			return jobs, fmt.Errorf("ClaimCrawlJobs: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		job, err := l.getCrawlJob(id)
+		if err != nil {
+			return jobs, fmt.Errorf("ClaimCrawlJobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (l *LocalStore) UpdateCrawlTarget(id string, i int, t *CrawlTarget) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow("SELECT COUNT(*) FROM crawl_jobs WHERE job_id = ?", id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	if exists == 0 {
+		return ERROR_INVALID_ID
+	}
+	if err := putCrawlTarget(tx, id, i, t); err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE crawl_jobs SET state = ? WHERE job_id = ? AND NOT EXISTS
+		(SELECT 1 FROM crawl_targets WHERE job_id = ? AND state IN (?, ?))`,
+		CrawlDone, id, id, CrawlQueued, CrawlRunning)
+	if err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UpdateCrawlTarget: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SaveLinks replaces the outgoing links of every page in ls in one
+// transaction, with a savepoint per page like BulkUpsertPages.
+func (l *LocalStore) SaveLinks(ls []*PageLinks) []error {
+	errs := make([]error, len(ls))
+	failAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = fmt.Errorf("SaveLinks: %w", err)
+		}
+		return errs
+	}
+	if len(ls) == 0 {
+		return errs
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return failAll(err)
+	}
+	defer tx.Rollback()
+
+	for i, pl := range ls {
+		if _, err := tx.Exec("SAVEPOINT links"); err != nil {
+			return failAll(err)
+		}
+		if err := replaceLocalLinks(tx, pl); err != nil {
+			errs[i] = fmt.Errorf("SaveLinks: %w", err)
+			if _, err := tx.Exec("ROLLBACK TO links"); err != nil {
+				return failAll(err)
+			}
+		}
+		if _, err := tx.Exec("RELEASE links"); err != nil {
+			return failAll(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return failAll(err)
+	}
+	return errs
+}
+
+func replaceLocalLinks(tx *sql.Tx, pl *PageLinks) error {
+	_, err := tx.Exec(`INSERT INTO link_sources (url_hash_id, url, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (url_hash_id) DO UPDATE SET url = excluded.url, updated_at = excluded.updated_at`,
+		pl.URLHash, pl.URL, toUnix(pl.UpdatedAt))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM links WHERE url_hash_id = ?", pl.URLHash); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO links (url_hash_id, position, target_hash, target_url, anchor, context)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, link := range pl.Links {
+		_, err := stmt.Exec(pl.URLHash, i, link.TargetHash, link.TargetURL, link.Anchor, link.Context)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IterateLinks reads the graph in source order and hands fn one page's
+// links at a time.
+func (l *LocalStore) IterateLinks(fn func(*PageLinks) error) error {
+	rows, err := l.db.Query(`SELECT s.url_hash_id, s.url, s.updated_at,
+		t.target_hash, t.target_url, t.anchor, t.context
+		FROM link_sources s LEFT JOIN links t ON t.url_hash_id = s.url_hash_id
+		ORDER BY s.url_hash_id, t.position`)
+	if err != nil {
+		return fmt.Errorf("IterateLinks: %w", err)
+	}
+	defer rows.Close()
+
+	var curr *PageLinks
+	for rows.Next() {
+		var id, url string
+		var updatedAt int64
+		var targetHash, targetURL, anchor, context sql.NullString
+		err := rows.Scan(&id, &url, &updatedAt, &targetHash, &targetURL, &anchor, &context)
+		if err != nil {
+			return fmt.Errorf("IterateLinks: %w", err)
+		}
+		if curr == nil || curr.URLHash != id {
+			if curr != nil {
+				if err := fn(curr); err != nil {
+					return err
+				}
+			}
+			curr = &PageLinks{URLHash: id, URL: url, UpdatedAt: fromUnix(updatedAt), Links: []Link{}}
+		}
+		if targetHash.Valid {
+			curr.Links = append(curr.Links, Link{
+				TargetHash: targetHash.String,
+				TargetURL:  targetURL.String,
+				Anchor:     anchor.String,
+				Context:    context.String,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("IterateLinks: %w", err)
+	}
+	if curr != nil {
+		return fn(curr)
+	}
+	return nil
+}
+
+func (l *LocalStore) GetAnchors(id string, limit int) ([]*Anchor, error) {
+	rows, err := l.db.Query(`SELECT s.url_hash_id, s.url, t.anchor, t.context
+		FROM links t JOIN link_sources s ON s.url_hash_id = t.url_hash_id
+		WHERE t.target_hash = ? AND t.url_hash_id != ?
+		ORDER BY s.url, t.position
+		LIMIT ?`, id, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetAnchors: %w", err)
+	}
+	defer rows.Close()
+
+	anchors := []*Anchor{}
+	for rows.Next() {
+		var a Anchor
+		if err := rows.Scan(&a.SourceHash, &a.SourceURL, &a.Text, &a.Context); err != nil {
+			return nil, fmt.Errorf("GetAnchors: %w", err)
+		}
+		anchors = append(anchors, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetAnchors: %w", err)
+	}
+	return anchors, nil
+}
+
+func (l *LocalStore) SetRanks(ranks []*PageRank) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("SetRanks: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE pages SET rank = ?, in_degree = ? WHERE url_hash_id = ?")
+	if err != nil {
+		return fmt.Errorf("SetRanks: %w", err)
+	}
+	defer stmt.Close()
+	for _, r := range ranks {
+		if _, err := stmt.Exec(r.Rank, r.InDegree, r.URLHash); err != nil {
+			return fmt.Errorf("SetRanks: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SetRanks: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStore) DeleteLinks(id string) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("DeleteLinks: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM links WHERE url_hash_id = ?", id); err != nil {
+		return fmt.Errorf("DeleteLinks: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM link_sources WHERE url_hash_id = ?", id); err != nil {
+		return fmt.Errorf("DeleteLinks: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("DeleteLinks: %w", err)
+	}
+	return nil
+}
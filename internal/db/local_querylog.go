@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordQuery counts the query and drops the queries nobody ran for
+// QUERY_TTL, the pruning Mongo leaves to a TTL index. The last_seen index
+// keeps that to the expired rows.
+func (l *LocalStore) RecordQuery(query string, at time.Time) error {
+	_, err := l.db.Exec(`INSERT INTO queries (query, count, last_seen) VALUES (?, 1, ?)
+		ON CONFLICT (query) DO UPDATE SET count = count + 1, last_seen = MAX(last_seen, excluded.last_seen)`,
+		query, toUnix(at))
+	if err != nil {
+		return fmt.Errorf("RecordQuery: %w", err)
+	}
+	if _, err := l.db.Exec("DELETE FROM queries WHERE last_seen < ?", toUnix(at.Add(-QUERY_TTL))); err != nil {
+		return fmt.Errorf("RecordQuery: %w", err)
+	}
+	return nil
+}
+
+// PopularQueries scans the primary key range of the prefix. No valid UTF-8
+// continuation sorts above the largest rune, so it closes the range.
+// Without a prefix the count index is read from the top instead.
+func (l *LocalStore) PopularQueries(prefix string, minCount int64, limit int) ([]*PopularQuery, error) {
+	where, args := "count >= ?", []any{minCount}
+	if prefix != "" {
+		where += " AND query >= ? AND query < ?"
+		args = append(args, prefix, prefix+string(utf8.MaxRune))
+	}
+	rows, err := l.db.Query(`SELECT query, count, last_seen FROM queries
+		WHERE `+where+`
+		ORDER BY count DESC, query
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("PopularQueries: %w", err)
+	}
+	defer rows.Close()
+
+	queries := []*PopularQuery{}
+	for rows.Next() {
+		var q PopularQuery
+		var lastSeen int64
+		if err := rows.Scan(&q.Query, &q.Count, &lastSeen); err != nil {
+			return nil, fmt.Errorf("PopularQueries: %w", err)
+		}
+		q.LastSeen = fromUnix(lastSeen)
+		queries = append(queries, &q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("PopularQueries: %w", err)
+	}
+	return queries, nil
+}
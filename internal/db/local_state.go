@@ -0,0 +1,309 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/limiter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"time"
+)
+
+const seedColumns = "seed_id, url, depth, budget, tags, paused, created_at, updated_at"
+
+func scanSeed(row rowScanner) (*Seed, error) {
+	var seed Seed
+	var tags string
+	var createdAt, updatedAt int64
+	err := row.Scan(&seed.ID, &seed.URL, &seed.Depth, &seed.Budget,
+		&tags, &seed.Paused, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &seed.Tags); err != nil {
+		return nil, err
+	}
+	seed.CreatedAt = fromUnix(createdAt)
+	seed.UpdatedAt = fromUnix(updatedAt)
+	return &seed, nil
+}
+
+func (l *LocalStore) getSeed(where string, arg any) (*Seed, error) {
+	seed, err := scanSeed(l.db.QueryRow("SELECT "+seedColumns+" FROM seeds WHERE "+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ERROR_INVALID_ID
+	}
+	return seed, err
+}
+
+// upsertSeed inserts the seed, or runs onConflict against the existing seed
+// with the same URL, mirroring the Mongo upserts keyed on url.
+func (l *LocalStore) upsertSeed(seed *Seed, onConflict string) (*Seed, error) {
+	tags, err := json.Marshal(seedTags(seed))
+	if err != nil {
+		return nil, err
+	}
+	now := toUnix(time.Now().UTC())
+	_, err = l.db.Exec(`INSERT INTO seeds (`+seedColumns+`) VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+		ON CONFLICT (url) `+onConflict,
+		bson.NewObjectID().Hex(), seed.URL, seed.Depth, seed.Budget, string(tags), now, now)
+	if err != nil {
+		return nil, err
+	}
+	return l.getSeed("url = ?", seed.URL)
+}
+
+func (l *LocalStore) InsertSeed(seed *Seed) (*Seed, error) {
+	res, err := l.upsertSeed(seed, "DO NOTHING")
+	if err != nil {
+		return nil, fmt.Errorf("InsertSeed: %w", err)
+	}
+	return res, nil
+}
+
+func (l *LocalStore) UpsertSeed(seed *Seed) (*Seed, error) {
+	res, err := l.upsertSeed(seed, `DO UPDATE SET depth = excluded.depth,
+		budget = excluded.budget, tags = excluded.tags, updated_at = excluded.updated_at`)
+	if err != nil {
+		return nil, fmt.Errorf("UpsertSeed: %w", err)
+	}
+	return res, nil
+}
+
+func (l *LocalStore) GetSeeds() ([]*Seed, error) {
+	rows, err := l.db.Query("SELECT " + seedColumns + " FROM seeds ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("GetSeeds: %w", err)
+	}
+	defer rows.Close()
+
+	seeds := []*Seed{}
+	for rows.Next() {
+		seed, err := scanSeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetSeeds: %w", err)
+		}
+		seeds = append(seeds, seed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetSeeds: %w", err)
+	}
+	return seeds, nil
+}
+
+func (l *LocalStore) GetSeedByID(id string) (*Seed, error) {
+	seed, err := l.getSeed("seed_id = ?", id)
+	if err != nil && !errors.Is(err, ERROR_INVALID_ID) {
+		return nil, fmt.Errorf("GetSeedByID: %w", err)
+	}
+	return seed, err
+}
+
+func (l *LocalStore) SetSeedPaused(id string, paused bool) (*Seed, error) {
+	res, err := l.db.Exec("UPDATE seeds SET paused = ?, updated_at = ? WHERE seed_id = ?",
+		paused, toUnix(time.Now().UTC()), id)
+	if err != nil {
+		return nil, fmt.Errorf("SetSeedPaused: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ERROR_INVALID_ID
+	}
+	return l.GetSeedByID(id)
+}
+
+func (l *LocalStore) DeleteSeedByID(id string) error {
+	res, err := l.db.Exec("DELETE FROM seeds WHERE seed_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("DeleteSeedByID: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ERROR_INVALID_ID
+	}
+	return nil
+}
+
+func (l *LocalStore) InsertFeed(f *Feed) error {
+	_, err := l.db.Exec(`INSERT INTO feeds (url_hash_id, url, source_url, etag, last_modified,
+		interval, next_poll_at, last_polled_at, seen_items, created_at)
+		VALUES (?, ?, ?, '', '', ?, ?, 0, '[]', ?)
+		ON CONFLICT (url_hash_id) DO NOTHING`,
+		f.URLHash, f.URL, f.SourceURL, int64(f.Interval), toUnix(f.NextPollAt),
+		toUnix(time.Now().UTC()))
+	if err != nil {
+		return fmt.Errorf("InsertFeed: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStore) GetDueFeeds(now time.Time, limit int) ([]*Feed, error) {
+	rows, err := l.db.Query(`SELECT url_hash_id, url, source_url, etag, last_modified,
+		interval, next_poll_at, last_polled_at, seen_items, created_at
+		FROM feeds WHERE next_poll_at <= ? ORDER BY next_poll_at LIMIT ?`,
+		toUnix(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetDueFeeds: %w", err)
+	}
+	defer rows.Close()
+
+	feeds := []*Feed{}
+	for rows.Next() {
+		var f Feed
+		var interval, nextPollAt, lastPolledAt, createdAt int64
+		var seen string
+		err := rows.Scan(&f.URLHash, &f.URL, &f.SourceURL, &f.ETag, &f.LastModified,
+			&interval, &nextPollAt, &lastPolledAt, &seen, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("GetDueFeeds: %w", err)
+		}
+		if err := json.Unmarshal([]byte(seen), &f.SeenItems); err != nil {
+			return nil, fmt.Errorf("GetDueFeeds: %w", err)
+		}
+		f.Interval = time.Duration(interval)
+		f.NextPollAt = fromUnix(nextPollAt)
+		f.LastPolledAt = fromUnix(lastPolledAt)
+		f.CreatedAt = fromUnix(createdAt)
+		feeds = append(feeds, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetDueFeeds: %w", err)
+	}
+	return feeds, nil
+}
+
+func (l *LocalStore) UpdateFeed(f *Feed) error {
+	seen, err := json.Marshal(f.SeenItems)
+	if err != nil {
+		return fmt.Errorf("UpdateFeed: %w", err)
+	}
+	res, err := l.db.Exec(`UPDATE feeds SET etag = ?, last_modified = ?, interval = ?,
+		next_poll_at = ?, last_polled_at = ?, seen_items = ? WHERE url_hash_id = ?`,
+		f.ETag, f.LastModified, int64(f.Interval), toUnix(f.NextPollAt),
+		toUnix(f.LastPolledAt), string(seen), f.URLHash)
+	if err != nil {
+		return fmt.Errorf("UpdateFeed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ERROR_INVALID_ID
+	}
+	return nil
+}
+
+func (l *LocalStore) GetLimits() (*limiter.Limits, error) {
+	var value string
+	err := l.db.QueryRow("SELECT value FROM settings WHERE id = ?", LIMITS_SETTING_ID).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ERROR_INVALID_ID
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetLimits: %w", err)
+	}
+	var res limiter.Limits
+	if err := json.Unmarshal([]byte(value), &res); err != nil {
+		return nil, fmt.Errorf("GetLimits: %w", err)
+	}
+	return &res, nil
+}
+
+func (l *LocalStore) putLimits(lim *limiter.Limits, onConflict string) error {
+	value, err := json.Marshal(lim)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec("INSERT INTO settings (id, value) VALUES (?, ?) ON CONFLICT (id) "+onConflict,
+		LIMITS_SETTING_ID, string(value))
+	return err
+}
+
+func (l *LocalStore) InsertLimits(lim *limiter.Limits) error {
+	if err := l.putLimits(lim, "DO NOTHING"); err != nil {
+		return fmt.Errorf("InsertLimits: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStore) SetLimits(lim *limiter.Limits) error {
+	if err := l.putLimits(lim, "DO UPDATE SET value = excluded.value"); err != nil {
+		return fmt.Errorf("SetLimits: %w", err)
+	}
+	return nil
+}
+
+func (l *LocalStore) SaveFrontier(entries []*FrontierEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("SaveFrontier: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO frontier
+		(url, priority, lastmod, changefreq, seed_id, depth, crawl_id, crawl_target, saved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("SaveFrontier: %w", err)
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		_, err := stmt.Exec(e.URL, e.Priority, toUnix(e.LastMod), e.ChangeFreq,
+			e.SeedID, e.Depth, e.CrawlID, e.CrawlTarget, toUnix(e.SavedAt))
+		if err != nil {
+			return fmt.Errorf("SaveFrontier: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SaveFrontier: %w", err)
+	}
+	return nil
+}
+
+// LoadFrontier returns up to limit saved entries and removes them in the
+// same transaction, like the Mongo backend does.
+func (l *LocalStore) LoadFrontier(limit int) ([]*FrontierEntry, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	tx, err := l.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT rowid, url, priority, lastmod, changefreq, seed_id, depth,
+		crawl_id, crawl_target, saved_at FROM frontier ORDER BY priority DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+	entries := []*FrontierEntry{}
+	rowids := []int64{}
+	for rows.Next() {
+		var e FrontierEntry
+		var rowid, lastMod, savedAt int64
+		err := rows.Scan(&rowid, &e.URL, &e.Priority, &lastMod, &e.ChangeFreq, &e.SeedID, &e.Depth,
+			&e.CrawlID, &e.CrawlTarget, &savedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("LoadFrontier: %w", err)
+		}
+		e.LastMod = fromUnix(lastMod)
+		e.SavedAt = fromUnix(savedAt)
+		entries = append(entries, &e)
+		rowids = append(rowids, rowid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+
+	for _, rowid := range rowids {
+		if _, err := tx.Exec("DELETE FROM frontier WHERE rowid = ?", rowid); err != nil {
+			return nil, fmt.Errorf("LoadFrontier: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("LoadFrontier: %w", err)
+	}
+	return entries, nil
+}
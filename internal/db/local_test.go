@@ -0,0 +1,342 @@
+package db
+
+import (
+	"github.com/evok02/jcrawler/internal/limiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	s, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { s.CloseConnection() })
+	return s
+}
+
+func TestLocalStorePages(t *testing.T) {
+	s := newTestLocalStore(t)
+	p := &Page{URLHash: "a", URL: "https://a.com", Title: "Go crawler", Content: "fast",
+		Meta: map[string]any{"lang": "en"}}
+
+	status, err := s.InsertPage(p)
+	require.NoError(t, err)
+	assert.Equal(t, PageCreated, status)
+
+	first, err := s.GetPageByID("a")
+	require.NoError(t, err)
+
+	// Test: an unchanged refetch moves crawled_at but not updated_at
+	p.CrawledAt = first.CrawledAt.Add(time.Hour)
+	status, err = s.InsertPage(p)
+	require.NoError(t, err)
+	assert.Equal(t, PageUnchanged, status)
+
+	stored, err := s.GetPageByID("a")
+	require.NoError(t, err)
+	assert.Equal(t, "Go crawler", stored.Title)
+	assert.Equal(t, first.UpdatedAt, stored.UpdatedAt)
+	assert.Equal(t, p.CrawledAt, stored.CrawledAt)
+	assert.Equal(t, "en", stored.Meta["lang"])
+
+	errs := s.BulkUpsertPages([]*Page{
+		{URLHash: "a", URL: "https://a.com", Title: "Renamed", Content: "fast"},
+		{URLHash: "b", URL: "https://b.com", Title: "Other", Content: "a crawler written in go, go go"},
+	})
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Test: the inverted index follows updates
+	res, err := s.GetPagesByIndex("go", 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "https://b.com", res[0].URL)
+
+	res, err = s.GetPagesByIndex("renamed crawler", 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "https://a.com", res[0].URL)
+
+	// Test: only the best matches up to the limit come back
+	res, err = s.GetPagesByIndex("renamed crawler", 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "https://a.com", res[0].URL)
+
+	// Test: pages are loaded in the order of their ids, without unknown ones
+	pages, err := s.GetPagesByIDs([]string{"b", "missing", "a"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(pages))
+	assert.Equal(t, []string{"https://b.com", "https://a.com"}, []string{pages[0].URL, pages[1].URL})
+
+	require.NoError(t, s.DeletePageByID("a"))
+	assert.ErrorIs(t, s.DeletePageByID("a"), ERROR_INVALID_ID)
+	res, err = s.GetPagesByIndex("renamed", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+}
+
+func TestLocalStoreState(t *testing.T) {
+	s := newTestLocalStore(t)
+
+	seed, err := s.InsertSeed(&Seed{URL: "https://a.com", Depth: 2})
+	require.NoError(t, err)
+	assert.NotEqual(t, "", seed.ID)
+
+	// Test: inserting a known seed keeps the stored one
+	again, err := s.InsertSeed(&Seed{URL: "https://a.com", Depth: 5})
+	require.NoError(t, err)
+	assert.Equal(t, seed.ID, again.ID)
+	assert.Equal(t, 2, again.Depth)
+
+	updated, err := s.UpsertSeed(&Seed{URL: "https://a.com", Depth: 5, Tags: []string{"news"}})
+	require.NoError(t, err)
+	assert.Equal(t, 5, updated.Depth)
+	assert.Equal(t, []string{"news"}, updated.Tags)
+
+	paused, err := s.SetSeedPaused(seed.ID, true)
+	require.NoError(t, err)
+	assert.True(t, paused.Paused)
+
+	_, err = s.GetLimits()
+	assert.ErrorIs(t, err, ERROR_INVALID_ID)
+	require.NoError(t, s.InsertLimits(&limiter.Limits{HostRPS: 2}))
+	require.NoError(t, s.InsertLimits(&limiter.Limits{HostRPS: 5}))
+	limits, err := s.GetLimits()
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, limits.HostRPS)
+
+	now := time.Now().UTC()
+	require.NoError(t, s.InsertFeed(&Feed{URLHash: "f", URL: "https://a.com/feed", Interval: time.Hour, NextPollAt: now}))
+	feeds, err := s.GetDueFeeds(now, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(feeds))
+	feeds[0].NextPollAt = now.Add(time.Hour)
+	require.NoError(t, s.UpdateFeed(feeds[0]))
+	feeds, err = s.GetDueFeeds(now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(feeds))
+
+	require.NoError(t, s.SaveFrontier([]*FrontierEntry{
+		{URL: "https://a.com/low", Priority: 0.1},
+		{URL: "https://a.com/high", Priority: 1, CrawlID: "job", CrawlTarget: 2},
+		{URL: "https://a.com/mid", Priority: 0.5},
+	}))
+	// Test: a limited load takes the highest priorities and leaves the rest
+	entries, err := s.LoadFrontier(1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "https://a.com/high", entries[0].URL)
+	// Test: entries of crawl jobs keep their job and target
+	assert.Equal(t, "job", entries[0].CrawlID)
+	assert.Equal(t, 2, entries[0].CrawlTarget)
+	entries, err = s.LoadFrontier(0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "https://a.com/mid", entries[0].URL)
+	entries, err = s.LoadFrontier(0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
+
+func TestLocalStoreVersions(t *testing.T) {
+	s := newTestLocalStore(t)
+	newVersion := func(content string) *PageVersion {
+		v, err := NewPageVersion(&Page{URLHash: "a", Title: "A", Content: content})
+		require.NoError(t, err)
+		return v
+	}
+
+	// Test: a version is only added when the content changed
+	errs := s.AddVersions([]*PageVersion{newVersion("one"), newVersion("one"), newVersion("two")})
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	errs = s.AddVersions([]*PageVersion{newVersion("two"), newVersion("one")})
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	versions, err := s.GetVersions("a")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(versions))
+	assert.Equal(t, []int{1, 2, 3}, []int{versions[0].Version, versions[1].Version, versions[2].Version})
+	assert.Nil(t, versions[0].Snapshot)
+
+	v, err := s.GetVersion("a", 2)
+	require.NoError(t, err)
+	content, err := v.Content()
+	require.NoError(t, err)
+	assert.Equal(t, "two", content)
+
+	_, err = s.GetVersion("a", 4)
+	assert.ErrorIs(t, err, ERROR_INVALID_ID)
+
+	// Test: deleting the versions of a page can be repeated
+	require.NoError(t, s.DeleteVersions("a"))
+	require.NoError(t, s.DeleteVersions("a"))
+	versions, err = s.GetVersions("a")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestLocalStoreLinks(t *testing.T) {
+	s := newTestLocalStore(t)
+	_, err := s.InsertPage(&Page{URLHash: "a", URL: "https://a.com", Title: "A"})
+	require.NoError(t, err)
+
+	errs := s.SaveLinks([]*PageLinks{
+		{URLHash: "a", URL: "https://a.com", Links: []Link{
+			{TargetHash: "b", TargetURL: "https://b.com", Anchor: "bee"},
+			{TargetHash: "c", TargetURL: "https://c.com"},
+		}},
+		{URLHash: "b", URL: "https://b.com", Links: []Link{}},
+	})
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	// Test: saving a page again replaces its links
+	errs = s.SaveLinks([]*PageLinks{{URLHash: "a", URL: "https://a.com", Links: []Link{
+		{TargetHash: "b", TargetURL: "https://b.com", Anchor: "bee"},
+	}}})
+	require.NoError(t, errs[0])
+
+	graph := map[string][]Link{}
+	require.NoError(t, s.IterateLinks(func(pl *PageLinks) error {
+		graph[pl.URLHash] = pl.Links
+		return nil
+	}))
+	assert.Equal(t, map[string][]Link{
+		"a": {{TargetHash: "b", TargetURL: "https://b.com", Anchor: "bee"}},
+		"b": {},
+	}, graph)
+
+	// Test: anchors are looked up by target, without self links
+	errs = s.SaveLinks([]*PageLinks{{URLHash: "b", URL: "https://b.com", Links: []Link{
+		{TargetHash: "b", TargetURL: "https://b.com", Anchor: "top"},
+		{TargetHash: "c", TargetURL: "https://c.com", Anchor: "see", Context: "also"},
+	}}})
+	require.NoError(t, errs[0])
+	anchors, err := s.GetAnchors("b", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*Anchor{{SourceHash: "a", SourceURL: "https://a.com", Text: "bee"}}, anchors)
+	anchors, err = s.GetAnchors("c", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*Anchor{{SourceHash: "b", SourceURL: "https://b.com", Text: "see", Context: "also"}}, anchors)
+
+	// Test: a deleted page no longer lends its anchors
+	require.NoError(t, s.DeleteLinks("b"))
+	anchors, err = s.GetAnchors("c", 10)
+	require.NoError(t, err)
+	assert.Empty(t, anchors)
+
+	// Test: ranks survive a later upsert of the page
+	require.NoError(t, s.SetRanks([]*PageRank{{URLHash: "a", Rank: 1.5, InDegree: 2}, {URLHash: "x", Rank: 1}}))
+	_, err = s.InsertPage(&Page{URLHash: "a", URL: "https://a.com", Title: "A2"})
+	require.NoError(t, err)
+	p, err := s.GetPageByID("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, p.Rank)
+	assert.Equal(t, 2, p.InDegree)
+}
+
+func TestLocalStoreQueries(t *testing.T) {
+	s := newTestLocalStore(t)
+	now := time.Now()
+	for _, q := range []string{"go crawler", "go crawler", "go", "gopher", "rust"} {
+		require.NoError(t, s.RecordQuery(q, now))
+	}
+
+	// Test: queries with the prefix come back most frequent first
+	queries, err := s.PopularQueries("go", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, queries, 3)
+	assert.Equal(t, "go crawler", queries[0].Query)
+	assert.Equal(t, int64(2), queries[0].Count)
+	assert.Equal(t, []string{"go", "gopher"}, []string{queries[1].Query, queries[2].Query})
+
+	queries, err = s.PopularQueries("", 1, 1)
+	require.NoError(t, err)
+	assert.Len(t, queries, 1)
+
+	// Test: rare queries are not suggested
+	queries, err = s.PopularQueries("", 2, 10)
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "go crawler", queries[0].Query)
+
+	// Test: queries nobody ran for longer than the TTL are dropped
+	require.NoError(t, s.RecordQuery("rust", now.Add(QUERY_TTL+time.Hour)))
+	queries, err = s.PopularQueries("", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "rust", queries[0].Query)
+}
+
+func TestLocalStoreBlocklist(t *testing.T) {
+	s := newTestLocalStore(t)
+	first := time.Unix(1700000000, 0)
+	require.NoError(t, s.BlockURL(&BlockedURL{URLHash: "a", URL: "https://a.com", BlockedAt: first}))
+
+	// Test: blocking again keeps the first entry
+	require.NoError(t, s.BlockURL(&BlockedURL{URLHash: "a", URL: "https://a.com", BlockedAt: first.Add(time.Hour)}))
+	blocked, err := s.GetBlocked()
+	require.NoError(t, err)
+	require.Len(t, blocked, 1)
+	assert.Equal(t, "https://a.com", blocked[0].URL)
+	assert.True(t, first.Equal(blocked[0].BlockedAt))
+
+	b, err := s.GetBlockedURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", b.URL)
+	_, err = s.GetBlockedURL("missing")
+	assert.ErrorIs(t, err, ERROR_INVALID_ID)
+}
+
+func TestLocalStoreCrawlJobs(t *testing.T) {
+	s := newTestLocalStore(t)
+	job := NewCrawlJob([]string{"https://a.com", "https://b.com"})
+	require.NoError(t, s.InsertCrawlJob(job))
+
+	// Test: a queued job is claimed once
+	stale := time.Now().Add(-time.Hour)
+	claimed, err := s.ClaimCrawlJobs(10, stale)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, CrawlRunning, claimed[0].State)
+	assert.Equal(t, "https://b.com", claimed[0].Targets[1].URL)
+	claimed, err = s.ClaimCrawlJobs(10, stale)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	// Test: a job whose claim went stale is claimed again
+	claimed, err = s.ClaimCrawlJobs(10, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, job.ID, claimed[0].ID)
+
+	// Test: the job is done once every target finished
+	changed := true
+	now := time.Unix(1700000000, 0)
+	require.NoError(t, s.UpdateCrawlTarget(job.ID, 0, &CrawlTarget{
+		URL: "https://a.com", State: CrawlDone, StatusCode: 200, FetchedAt: &now, FetchMs: 12, Changed: &changed,
+	}))
+	stored, err := s.GetCrawlJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CrawlRunning, stored.State)
+	assert.Equal(t, 200, stored.Targets[0].StatusCode)
+	require.NotNil(t, stored.Targets[0].Changed)
+	assert.True(t, *stored.Targets[0].Changed)
+	assert.Nil(t, stored.Targets[1].Changed)
+
+	require.NoError(t, s.UpdateCrawlTarget(job.ID, 1, &CrawlTarget{URL: "https://b.com", State: CrawlFailed, Error: "timeout"}))
+	stored, err = s.GetCrawlJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CrawlDone, stored.State)
+
+	_, err = s.GetCrawlJob("missing")
+	assert.ErrorIs(t, err, ERROR_INVALID_ID)
+	assert.ErrorIs(t, s.UpdateCrawlTarget("missing", 0, &CrawlTarget{}), ERROR_INVALID_ID)
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (l *LocalStore) AddVersions(vs []*PageVersion) []error {
+	errs := make([]error, len(vs))
+	failAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = fmt.Errorf("AddVersions: %w", err)
+		}
+		return errs
+	}
+	if len(vs) == 0 {
+		return errs
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return failAll(err)
+	}
+	defer tx.Rollback()
+
+	latest := make(map[string]latestVersion)
+	for _, v := range vs {
+		if _, ok := latest[v.URLHash]; ok {
+			continue
+		}
+		var last latestVersion
+		err := tx.QueryRow(`SELECT url_hash_id, version, content_hash FROM versions
+			WHERE url_hash_id = ? ORDER BY version DESC LIMIT 1`, v.URLHash).
+			Scan(&last.URLHash, &last.Version, &last.ContentHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return failAll(err)
+		}
+		latest[v.URLHash] = last
+	}
+
+	for _, i := range numberVersions(vs, latest) {
+		v := vs[i]
+		_, err := tx.Exec(`INSERT INTO versions
+			(url_hash_id, version, content_hash, title, size, created_at, snapshot)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			v.URLHash, v.Version, v.ContentHash, v.Title, v.Size, toUnix(v.CreatedAt), v.Snapshot)
+		if err != nil {
+			return failAll(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return failAll(err)
+	}
+	return errs
+}
+
+func (l *LocalStore) GetVersions(id string) ([]*PageVersion, error) {
+	rows, err := l.db.Query(`SELECT url_hash_id, version, content_hash, title, size, created_at
+		FROM versions WHERE url_hash_id = ? ORDER BY version`, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetVersions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*PageVersion{}
+	for rows.Next() {
+		var v PageVersion
+		var createdAt int64
+		if err := rows.Scan(&v.URLHash, &v.Version, &v.ContentHash, &v.Title, &v.Size, &createdAt); err != nil {
+			return nil, fmt.Errorf("GetVersions: %w", err)
+		}
+		v.CreatedAt = fromUnix(createdAt)
+		versions = append(versions, &v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetVersions: %w", err)
+	}
+	return versions, nil
+}
+
+func (l *LocalStore) GetVersion(id string, version int) (*PageVersion, error) {
+	var v PageVersion
+	var createdAt int64
+	err := l.db.QueryRow(`SELECT url_hash_id, version, content_hash, title, size, created_at, snapshot
+		FROM versions WHERE url_hash_id = ? AND version = ?`, id, version).
+		Scan(&v.URLHash, &v.Version, &v.ContentHash, &v.Title, &v.Size, &createdAt, &v.Snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ERROR_INVALID_ID
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetVersion: %w", err)
+	}
+	v.CreatedAt = fromUnix(createdAt)
+	return &v, nil
+}
+
+func (l *LocalStore) DeleteVersions(id string) error {
+	if _, err := l.db.Exec("DELETE FROM versions WHERE url_hash_id = ?", id); err != nil {
+		return fmt.Errorf("DeleteVersions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+var ERROR_MIGRATION_ORDER = errors.New("migration versions must be unique and increasing")
+
+// FRONTIER_TTL bounds how long a saved frontier survives. A frontier that
+// was not restored within it belongs to a crawl nobody resumed.
+const FRONTIER_TTL = 30 * 24 * time.Hour
+
+// QUERY_TTL bounds how long a search is remembered for suggestions after
+// it was last run, so the query log does not grow without end.
+const QUERY_TTL = 90 * 24 * time.Hour
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+type MigrationStatus struct {
+	Version   int        `bson:"_id" json:"version"`
+	Name      string     `bson:"name" json:"name"`
+	AppliedAt *time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+// migrations must only be appended to: a version that was applied
+// somewhere is never run again, even if its Up changes. Duplicated pages
+// are removed first, as the unique index of version 2 cannot be built
+// over pages stored twice.
+var migrations = []Migration{
+	{1, "pages_dedupe_url_hash", dedupePages},
+	{2, "pages_url_hash_unique", createIndex("pages", mongo.IndexModel{
+		Keys:    bson.D{{Key: "url_hash_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("url_hash_id_unique"),
+	})},
+	{3, "pages_text", createIndex("pages", mongo.IndexModel{
+		Keys: bson.D{{Key: "title", Value: "text"}, {Key: "page_content", Value: "text"}},
+		Options: options.Index().SetName("pages_text").
+			SetWeights(bson.D{{Key: "title", Value: 5}, {Key: "page_content", Value: 1}}),
+	})},
+	{4, "pages_updated_at", createIndex("pages", mongo.IndexModel{
+		Keys:    bson.D{{Key: "updated_at", Value: -1}},
+		Options: options.Index().SetName("updated_at"),
+	})},
+	{5, "seeds_url_unique", createIndex("seeds", mongo.IndexModel{
+		Keys:    bson.D{{Key: "url", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("url_unique"),
+	})},
+	{6, "feeds_due", createIndex("feeds", mongo.IndexModel{
+		Keys:    bson.D{{Key: "next_poll_at", Value: 1}, {Key: "url_hash_id", Value: 1}},
+		Options: options.Index().SetName("next_poll_at_url_hash_id"),
+	})},
+	{7, "frontier_priority", createIndex("frontier", mongo.IndexModel{
+		Keys:    bson.D{{Key: "priority", Value: -1}, {Key: "saved_at", Value: 1}},
+		Options: options.Index().SetName("priority_saved_at"),
+	})},
+	{8, "frontier_ttl", createIndex("frontier", mongo.IndexModel{
+		Keys: bson.D{{Key: "saved_at", Value: 1}},
+		Options: options.Index().SetName("saved_at_ttl").
+			SetExpireAfterSeconds(int32(FRONTIER_TTL.Seconds())),
+	})},
+	{9, "versions_unique", createIndex("versions", mongo.IndexModel{
+		Keys:    bson.D{{Key: "url_hash_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("url_hash_id_version_unique"),
+	})},
+	{10, "links_source_unique", createIndex("links", mongo.IndexModel{
+		Keys:    bson.D{{Key: "url_hash_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("url_hash_id_unique"),
+	})},
+	{11, "links_target", createIndex("links", mongo.IndexModel{
+		Keys:    bson.D{{Key: "links.target_hash", Value: 1}},
+		Options: options.Index().SetName("links_target_hash"),
+	})},
+	{12, "crawl_jobs_state", createIndex("crawl_jobs", mongo.IndexModel{
+		Keys:    bson.D{{Key: "state", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("state_created_at"),
+	})},
+	{13, "queries_ttl", createIndex("queries", mongo.IndexModel{
+		Keys: bson.D{{Key: "last_seen", Value: 1}},
+		Options: options.Index().SetName("last_seen_ttl").
+			SetExpireAfterSeconds(int32(QUERY_TTL.Seconds())),
+	})},
+	{14, "queries_count", createIndex("queries", mongo.IndexModel{
+		Keys:    bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("count_id"),
+	})},
+}
+
+// pageCopy is one stored copy of a page that dedupePages looks at.
+type pageCopy struct {
+	ID        any       `bson:"id"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// dedupePages keeps the most recently updated page of every url_hash_id
+// and deletes the other copies, which concurrent upserts could insert
+// before the id was unique.
+func dedupePages(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection("pages")
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$url_hash_id"},
+			{Key: "copies", Value: bson.D{{Key: "$push", Value: bson.D{
+				{Key: "id", Value: "$_id"},
+				{Key: "updated_at", Value: "$updated_at"},
+			}}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}
+	cursor, err := coll.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var dup struct {
+			Copies []pageCopy `bson:"copies"`
+		}
+		if err := cursor.Decode(&dup); err != nil {
+			return err
+		}
+		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: staleCopies(dup.Copies)}}}}
+		if _, err := coll.DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// staleCopies returns the ids of every copy but the most recently updated
+// one. Of copies updated at the same time the first one is kept.
+func staleCopies(copies []pageCopy) bson.A {
+	keep := 0
+	for i, c := range copies {
+		if c.UpdatedAt.After(copies[keep].UpdatedAt) {
+			keep = i
+		}
+	}
+	stale := make(bson.A, 0, len(copies)-1)
+	for i, c := range copies {
+		if i != keep {
+			stale = append(stale, c.ID)
+		}
+	}
+	return stale
+}
+
+func createIndex(coll string, model mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).Indexes().CreateOne(ctx, model)
+		return err
+	}
+}
+
+func (s *Storage) appliedMigrations(ctx context.Context) (map[int]*MigrationStatus, error) {
+	coll := s.DB.Database("crawler").Collection("migrations")
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	statuses := []*MigrationStatus{}
+	if err := cursor.All(ctx, &statuses); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]*MigrationStatus, len(statuses))
+	for _, st := range statuses {
+		applied[st.Version] = st
+	}
+	return applied, nil
+}
+
+// MigrationStatus lists every known migration; AppliedAt is nil for the
+// ones that are still pending.
+func (s *Storage) MigrationStatus() ([]*MigrationStatus, error) {
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	applied, err := s.appliedMigrations(context)
+	if err != nil {
+		return nil, fmt.Errorf("MigrationStatus: %w", err)
+	}
+	return migrationStatuses(migrations, applied), nil
+}
+
+func migrationStatuses(ms []Migration, applied map[int]*MigrationStatus) []*MigrationStatus {
+	res := make([]*MigrationStatus, 0, len(ms))
+	for _, m := range ms {
+		st := &MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			st.AppliedAt = a.AppliedAt
+		}
+		res = append(res, st)
+	}
+	return res
+}
+
+// pendingMigrations returns the migrations of ms that were not applied,
+// in version order.
+func pendingMigrations(ms []Migration, applied map[int]*MigrationStatus) []Migration {
+	pending := []Migration{}
+	for _, m := range ms {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// MigrateUp applies pending migrations in version order and returns the
+// ones it applied. It stops at the first failure, so later migrations can
+// rely on earlier ones.
+func (s *Storage) MigrateUp() ([]*MigrationStatus, error) {
+	coll := s.DB.Database("crawler").Collection("migrations")
+	context, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	if err := checkMigrations(migrations); err != nil {
+		return nil, fmt.Errorf("MigrateUp: %w", err)
+	}
+	applied, err := s.appliedMigrations(context)
+	if err != nil {
+		return nil, fmt.Errorf("MigrateUp: %w", err)
+	}
+
+	done := []*MigrationStatus{}
+	for _, m := range pendingMigrations(migrations, applied) {
+		if err := m.Up(context, s.DB.Database("crawler")); err != nil {
+			return done, fmt.Errorf("MigrateUp: %d_%s: %w", m.Version, m.Name, err)
+		}
+		now := time.Now().UTC()
+		st := &MigrationStatus{Version: m.Version, Name: m.Name, AppliedAt: &now}
+		_, err := coll.InsertOne(context, st)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return done, fmt.Errorf("MigrateUp: %w", err)
+		}
+		done = append(done, st)
+	}
+	return done, nil
+}
+
+func checkMigrations(ms []Migration) error {
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Version <= ms[i-1].Version {
+			return fmt.Errorf("%w: %d after %d", ERROR_MIGRATION_ORDER, ms[i].Version, ms[i-1].Version)
+		}
+	}
+	return nil
+}
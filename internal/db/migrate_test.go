@@ -0,0 +1,61 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"testing"
+	"time"
+)
+
+func TestMigrationOrder(t *testing.T) {
+	// Test: the registered migrations are in order
+	assert.NoError(t, checkMigrations(migrations))
+
+	// Test: duplicates are removed before the unique index is built
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "pages_dedupe_url_hash", migrations[0].Name)
+	assert.Equal(t, "pages_url_hash_unique", migrations[1].Name)
+
+	// Test: duplicated and decreasing versions are rejected
+	assert.ErrorIs(t, checkMigrations([]Migration{{Version: 1}, {Version: 1}}), ERROR_MIGRATION_ORDER)
+	assert.ErrorIs(t, checkMigrations([]Migration{{Version: 2}, {Version: 1}}), ERROR_MIGRATION_ORDER)
+}
+
+func TestStaleCopies(t *testing.T) {
+	now := time.Now()
+
+	// Test: the most recently updated copy is kept wherever it is
+	copies := []pageCopy{
+		{ID: "old", UpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: "new", UpdatedAt: now},
+		{ID: "older", UpdatedAt: now.Add(-3 * time.Hour)},
+	}
+	assert.Equal(t, bson.A{"old", "older"}, staleCopies(copies))
+
+	// Test: of copies updated at the same time the first is kept
+	copies = []pageCopy{{ID: "a", UpdatedAt: now}, {ID: "b", UpdatedAt: now}, {ID: "c"}}
+	assert.Equal(t, bson.A{"b", "c"}, staleCopies(copies))
+}
+
+func TestMigrationBookkeeping(t *testing.T) {
+	ms := []Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}}
+	at := time.Now()
+	applied := map[int]*MigrationStatus{
+		1: {Version: 1, Name: "a", AppliedAt: &at},
+		3: {Version: 3, Name: "c", AppliedAt: &at},
+	}
+
+	// Test: only migrations without a record are run
+	pending := pendingMigrations(ms, applied)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 2, pending[0].Version)
+	assert.Len(t, pendingMigrations(ms, nil), 3)
+
+	// Test: the status lists every migration and when it was applied
+	statuses := migrationStatuses(ms, applied)
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, &at, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.Equal(t, "b", statuses[1].Name)
+	assert.Equal(t, &at, statuses[2].AppliedAt)
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"regexp"
+	"time"
+)
+
+// PopularQuery is a search users ran, with how often they ran it.
+type PopularQuery struct {
+	Query    string    `bson:"_id" json:"query"`
+	Count    int64     `bson:"count" json:"count"`
+	LastSeen time.Time `bson:"last_seen" json:"last_seen"`
+}
+
+// RecordQuery counts one more search for query. The query is the
+// collection key, so counting needs no lookup first.
+func (s *Storage) RecordQuery(query string, at time.Time) error {
+	coll := s.DB.Database("crawler").Collection("queries")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	_, err := coll.UpdateOne(context,
+		bson.D{{Key: "_id", Value: query}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+			{Key: "$max", Value: bson.D{{Key: "last_seen", Value: at}}},
+		},
+		options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("RecordQuery: %w", err)
+	}
+	return nil
+}
+
+// PopularQueries returns the most frequent queries that start with
+// prefix and were run at least minCount times. An anchored regex on _id
+// is answered from its index; without a prefix the count index is walked
+// from the top. Queries not run for QUERY_TTL expire.
+func (s *Storage) PopularQueries(prefix string, minCount int64, limit int) ([]*PopularQuery, error) {
+	coll := s.DB.Database("crawler").Collection("queries")
+	filter := bson.D{{Key: "count", Value: bson.D{{Key: "$gte", Value: minCount}}}}
+	if prefix != "" {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)}})
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(context, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("PopularQueries: %w", err)
+	}
+	queries := []*PopularQuery{}
+	if err := cursor.All(context, &queries); err != nil {
+		return nil, fmt.Errorf("PopularQueries: %w", err)
+	}
+	return queries, nil
+}
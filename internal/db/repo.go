@@ -2,11 +2,14 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+	"slices"
 	"time"
 )
 
@@ -15,17 +18,41 @@ var ERROR_INVALID_ID = errors.New("couldn't find entry with this id")
 var ERROR_EMPTY_COLLECION = errors.New("empty collection of documents")
 var ERROR_UNSUCCESSFUL_TRANSACTION = errors.New("couldnt execute transaction")
 
+// IsUnavailable reports whether err means the store could not be reached
+// or did not answer in time, rather than that the request was wrong. The
+// request may succeed when it is retried later.
+func IsUnavailable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) || mongo.IsNetworkError(err) {
+		return true
+	}
+	if errors.As(err, &topology.ServerSelectionError{}) {
+		return true
+	}
+	return isBusy(err)
+}
+
 type Page struct {
-	Content   string    `bson:"page_content"`
-	UpdatedAt time.Time `bson:"updated_at"`
-	Title     string    `bson:"title"`
-	URLHash   string    `bson:"url_hash_id"`
-	URL       string    `bson:"url"`
+	Content     string         `bson:"page_content" json:"content"`
+	UpdatedAt   time.Time      `bson:"updated_at" json:"updated_at"`
+	Title       string         `bson:"title" json:"title"`
+	URLHash     string         `bson:"url_hash_id" json:"id"`
+	URL         string         `bson:"url" json:"url"`
+	Meta        map[string]any `bson:"meta,omitempty" json:"meta,omitempty"`
+	ContentHash string         `bson:"content_hash" json:"content_hash"`
+	Language    string         `bson:"language" json:"language,omitempty"`
+	ContentType string         `bson:"content_type" json:"content_type,omitempty"`
+	Keywords    []string       `bson:"keywords,omitempty" json:"keywords,omitempty"`
+	Rank        float64        `bson:"rank" json:"rank"`
+	InDegree    int            `bson:"in_degree" json:"in_degree"`
+	// CrawledAt is when the page was last fetched. Unlike UpdatedAt it
+	// moves on every crawl, whether the page changed or not.
+	CrawledAt time.Time `bson:"crawled_at" json:"crawled_at"`
 }
 
 type PageServe struct {
-	URL string `bson:"url" json:"url"`
-	Title string `bson:"title" json:"title"`
+	ID        string     `bson:"url_hash_id" json:"id"`
+	URL       string     `bson:"url" json:"url"`
+	Title     string     `bson:"title" json:"title"`
 	UpdatedAt *time.Time `bson:"updated_at" json:"updated_at"`
 }
 
@@ -41,67 +68,182 @@ func (s *Storage) GetPageByID(id string) (*Page, error) {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ERROR_INVALID_ID
 		}
-		return nil, fmt.Errorf("GetPageByID: %s", err.Error())
+		return nil, fmt.Errorf("GetPageByID: %w", err)
 	}
 
 	var res Page
 	if err := cursor.Decode(&res); err != nil {
-		return nil, fmt.Errorf("GetPageByID: %s", err.Error())
+		return nil, fmt.Errorf("GetPageByID: %w", err)
 	}
 
 	return &res, nil
 }
 
-func (s *Storage) GetAllPages() ([]Page, error) {
-	coll := s.DB.Database("cralwer").Collection("pages")
-	context, cancel := context.WithTimeout(s.ctx, time.Second)
+// GetPagesByIDs loads the pages of ids with one query, in the order of
+// ids and without their meta tags. Unknown ids are left out.
+func (s *Storage) GetPagesByIDs(ids []string) ([]*Page, error) {
+	coll := s.DB.Database("crawler").Collection("pages")
+	filter := bson.D{{Key: "url_hash_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	findOptions := options.Find().SetProjection(bson.D{{Key: "meta", Value: 0}})
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
 	defer cancel()
 
-	cursor, err := coll.Find(context, bson.M{})
+	cursor, err := coll.Find(context, filter, findOptions)
 	if err != nil {
-		return nil, fmt.Errorf("GetAllPages: %s", err)
+		return nil, fmt.Errorf("GetPagesByIDs: %w", err)
+	}
+	found := []*Page{}
+	if err := cursor.All(context, &found); err != nil {
+		return nil, fmt.Errorf("GetPagesByIDs: %w", err)
 	}
+	return orderPages(ids, found), nil
+}
 
-	if err := cursor.Err(); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, ERROR_EMPTY_COLLECION
+// orderPages sorts pages into the order of ids.
+func orderPages(ids []string, pages []*Page) []*Page {
+	byID := make(map[string]*Page, len(pages))
+	for _, p := range pages {
+		byID[p.URLHash] = p
+	}
+	res := make([]*Page, 0, len(pages))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			res = append(res, p)
+			delete(byID, id)
 		}
-		return nil, fmt.Errorf("GetAllPages: %s", err.Error())
 	}
+	return res
+}
+
+// IteratePages calls fn for every stored page and stops at the first
+// error fn returns.
+func (s *Storage) IteratePages(fn func(*Page) error) error {
+	coll := s.DB.Database("crawler").Collection("pages")
 
-	var pages []Page
-	if err := cursor.All(context, &pages); err != nil {
-		return nil, fmt.Errorf("GetAllPages: %s", err.Error())
+	cursor, err := coll.Find(s.ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("IteratePages: %w", err)
+	}
+	defer cursor.Close(s.ctx)
+
+	for cursor.Next(s.ctx) {
+		var p Page
+		if err := cursor.Decode(&p); err != nil {
+			return fmt.Errorf("IteratePages: %w", err)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("IteratePages: %w", err)
+	}
+	return nil
+}
+
+type PageStatus int
+
+const (
+	PageUnchanged PageStatus = iota
+	PageCreated
+	PageModified
+)
+
+func (ps PageStatus) String() string {
+	switch ps {
+	case PageCreated:
+		return "created"
+	case PageModified:
+		return "modified"
+	default:
+		return "unchanged"
+	}
+}
+
+// pageUpdate builds the update pipeline shared by single and bulk upserts.
+// updated_at only moves when the title or content changed, while
+// crawled_at is set on every upsert. Values are wrapped in $literal
+// because pipeline stages read strings starting with $ as paths.
+func pageUpdate(p *Page) bson.A {
+	updatedAt := p.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now().UTC()
+	}
+	crawledAt := p.CrawledAt
+	if crawledAt.IsZero() {
+		crawledAt = updatedAt
+	}
+	unchanged := bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$eq", Value: bson.A{"$title", bson.D{{Key: "$literal", Value: p.Title}}}}},
+		bson.D{{Key: "$eq", Value: bson.A{"$page_content", bson.D{{Key: "$literal", Value: p.Content}}}}},
+	}}}
+	return bson.A{
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "updated_at", Value: bson.D{{Key: "$cond", Value: bson.A{
+				unchanged, "$updated_at", updatedAt,
+			}}}},
+		}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "url", Value: bson.D{{Key: "$literal", Value: p.URL}}},
+			{Key: "title", Value: bson.D{{Key: "$literal", Value: p.Title}}},
+			{Key: "page_content", Value: bson.D{{Key: "$literal", Value: p.Content}}},
+			{Key: "meta", Value: bson.D{{Key: "$literal", Value: p.Meta}}},
+			{Key: "content_hash", Value: bson.D{{Key: "$literal", Value: p.ContentHash}}},
+			{Key: "language", Value: bson.D{{Key: "$literal", Value: p.Language}}},
+			{Key: "content_type", Value: bson.D{{Key: "$literal", Value: p.ContentType}}},
+			{Key: "keywords", Value: bson.D{{Key: "$literal", Value: p.Keywords}}},
+			{Key: "crawled_at", Value: bson.D{{Key: "$literal", Value: crawledAt}}},
+		}}},
 	}
-	return pages, nil
 }
 
-func (s *Storage) InsertPage(p *Page) error {
+// InsertPage creates or updates the page stored under p.URLHash in a
+// single atomic upsert and reports which of the two happened. The status
+// comes from comparing the page with the one it replaced, as crawled_at
+// moves on every upsert and the update never leaves a page untouched.
+func (s *Storage) InsertPage(p *Page) (PageStatus, error) {
 	coll := s.DB.Database("crawler").Collection("pages")
+	filter := bson.D{{Key: "url_hash_id", Value: p.URLHash}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
 
 	context, cancel := context.WithTimeout(s.ctx, time.Second)
 	defer cancel()
 
-	if _, err := s.GetPageByID(p.URLHash); err == nil {
-		s.UpdatePageByID(p.URLHash, p)
-		return nil
+	var old Page
+	err := coll.FindOneAndUpdate(context, filter, pageUpdate(p), opts).Decode(&old)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return PageCreated, nil
 	}
-
-	doc, err := bson.Marshal(p)
 	if err != nil {
-		return fmt.Errorf("InsertPage: %s", err.Error())
+		return PageUnchanged, fmt.Errorf("InsertPage: %w", err)
 	}
+	return pageStatus(&old, p), nil
+}
 
-	res, err := coll.InsertOne(context, doc)
-	if err != nil {
-		return fmt.Errorf("InsertPage: %s", err.Error())
-	}
+// textChanged reports whether p has a different title or content than
+// old, which is what moves updated_at.
+func textChanged(old, p *Page) bool {
+	return old.Title != p.Title || old.Content != p.Content
+}
 
-	if res.InsertedID == 0 {
-		return ERROR_UNSUCCESSFUL_TRANSACTION
+// pageStatus tells what storing p over old does to the stored page. A
+// refetch that only moves crawled_at leaves it unchanged.
+func pageStatus(old, p *Page) PageStatus {
+	if old == nil {
+		return PageCreated
 	}
-
-	return nil
+	oldMeta, _ := json.Marshal(old.Meta)
+	newMeta, _ := json.Marshal(p.Meta)
+	if len(old.Meta) == 0 && len(p.Meta) == 0 {
+		oldMeta, newMeta = nil, nil
+	}
+	sameFields := old.URL == p.URL && string(oldMeta) == string(newMeta) && old.Language == p.Language &&
+		old.ContentType == p.ContentType && slices.Equal(old.Keywords, p.Keywords)
+	if textChanged(old, p) || !sameFields {
+		return PageModified
+	}
+	return PageUnchanged
 }
 
 func (s *Storage) DeletePageByID(id string) error {
@@ -113,7 +255,7 @@ func (s *Storage) DeletePageByID(id string) error {
 
 	res, err := coll.DeleteMany(context, filter)
 	if err != nil {
-		return fmt.Errorf("DeletePageByID: %s", err.Error())
+		return fmt.Errorf("DeletePageByID: %w", err)
 	}
 
 	if res.DeletedCount == 0 {
@@ -129,6 +271,7 @@ func (s *Storage) UpdatePageByID(id string, newPage *Page) (*Page, error) {
 		{Key: "title", Value: newPage.Title},
 		{Key: "updated_at", Value: time.Now().UTC()},
 		{Key: "page_content", Value: newPage.Content},
+		{Key: "meta", Value: newPage.Meta},
 	}}}
 	coll := s.DB.Database("crawler").Collection("pages")
 
@@ -137,7 +280,7 @@ func (s *Storage) UpdatePageByID(id string, newPage *Page) (*Page, error) {
 
 	res, err := coll.UpdateOne(context, filter, update)
 	if err != nil {
-		return nil, fmt.Errorf("ReplacePageByID: %s", err.Error())
+		return nil, fmt.Errorf("ReplacePageByID: %w", err)
 	}
 
 	if res.MatchedCount == 0 {
@@ -146,28 +289,34 @@ func (s *Storage) UpdatePageByID(id string, newPage *Page) (*Page, error) {
 
 	replaced, err := s.GetPageByID(id)
 	if err != nil {
-		return nil, fmt.Errorf("ReplacePageByID: %s", err.Error())
+		return nil, fmt.Errorf("ReplacePageByID: %w", err)
 	}
 
 	return replaced, nil
 }
 
-func (s *Storage) GetPagesByIndex(query string) ([]*PageServe, error) {
+// GetPagesByIndex returns the limit pages that match query best, by the
+// score of the text index.
+func (s *Storage) GetPagesByIndex(query string, limit int) ([]*PageServe, error) {
 	servedPages := []*PageServe{}
 	collection := s.DB.Database("crawler").Collection("pages")
 
-	filter := bson.M{"$text":bson.M{"$search":query}}
-	project := bson.M{"page_content": 0}
-	findOptions := options.Find().SetProjection(project)
+	score := bson.M{"$meta": "textScore"}
+	filter := bson.M{"$text": bson.M{"$search": query}}
+	project := bson.M{"page_content": 0, "score": score}
+	findOptions := options.Find().
+		SetProjection(project).
+		SetSort(bson.M{"score": score}).
+		SetLimit(int64(limit))
 
 	cursor, err := collection.Find(s.ctx, filter, findOptions)
 	if err != nil {
-		return nil, fmt.Errorf("GetPagesByIndex: %s", err)
+		return nil, fmt.Errorf("GetPagesByIndex: %w", err)
 	}
 	defer cursor.Close(s.ctx)
 
-	if err := cursor.All(s.ctx, servedPages); err != nil {
-		return nil, fmt.Errorf("GetPagesByIndex: %s", err)
+	if err := cursor.All(s.ctx, &servedPages); err != nil {
+		return nil, fmt.Errorf("GetPagesByIndex: %w", err)
 	}
 	return servedPages, nil
 }
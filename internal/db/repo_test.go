@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+	"testing"
+	"time"
+)
+
+func TestPageUpdateLiterals(t *testing.T) {
+	p := &Page{URL: "https://a.com", Title: "$title", Content: "$$ROOT", Language: "$title", ContentType: "$$ROOT"}
+	update := pageUpdate(p)
+	require.Len(t, update, 2)
+
+	// Test: crawled values never reach the pipeline as expressions
+	set := update[1].(bson.D)[0].Value.(bson.D)
+	for _, field := range set {
+		value, ok := field.Value.(bson.D)
+		require.True(t, ok, field.Key)
+		assert.Equal(t, "$literal", value[0].Key, field.Key)
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	// Test: timeouts and unreachable servers survive wrapping
+	assert.True(t, IsUnavailable(fmt.Errorf("GetPageByID: %w", context.DeadlineExceeded)))
+	assert.True(t, IsUnavailable(fmt.Errorf("GetPages: %w", topology.ServerSelectionError{})))
+
+	// Test: errors of the request itself are not
+	assert.False(t, IsUnavailable(fmt.Errorf("GetPageByID: %w", ERROR_INVALID_ID)))
+	assert.False(t, IsUnavailable(errors.New("boom")))
+}
+
+func TestPageStatus(t *testing.T) {
+	old := &Page{URLHash: "a", URL: "https://a.com", Title: "A", Content: "alpha",
+		ContentHash: ContentHash("A", "alpha"), Meta: map[string]any{"k": "v"},
+		UpdatedAt: time.Now().Add(-time.Hour), CrawledAt: time.Now().Add(-time.Hour)}
+	refetch := *old
+	refetch.Meta = map[string]any{"k": "v"}
+	refetch.UpdatedAt, refetch.CrawledAt = time.Now(), time.Now()
+
+	// Test: a refetch with identical content is unchanged
+	assert.Equal(t, PageUnchanged, pageStatus(old, &refetch))
+	assert.Equal(t, PageCreated, pageStatus(nil, &refetch))
+
+	// Test: new text or metadata modify the page
+	changed := refetch
+	changed.Content = "beta"
+	assert.Equal(t, PageModified, pageStatus(old, &changed))
+	changed = refetch
+	changed.Language = "de"
+	assert.Equal(t, PageModified, pageStatus(old, &changed))
+	changed = refetch
+	changed.Meta = nil
+	assert.Equal(t, PageModified, pageStatus(old, &changed))
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+type Seed struct {
+	ID        string    `bson:"seed_id" json:"id"`
+	URL       string    `bson:"url" json:"url"`
+	Depth     int       `bson:"depth" json:"depth"`
+	Budget    int       `bson:"budget" json:"budget"`
+	Tags      []string  `bson:"tags" json:"tags"`
+	Paused    bool      `bson:"paused" json:"paused"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func seedDefaults() bson.D {
+	return bson.D{
+		{Key: "seed_id", Value: bson.NewObjectID().Hex()},
+		{Key: "paused", Value: false},
+		{Key: "created_at", Value: time.Now().UTC()},
+	}
+}
+
+func seedTags(seed *Seed) []string {
+	if seed.Tags == nil {
+		return []string{}
+	}
+	return seed.Tags
+}
+
+func (s *Storage) upsertSeed(seed *Seed, update bson.D) (*Seed, error) {
+	coll := s.DB.Database("crawler").Collection("seeds")
+	filter := bson.D{{Key: "url", Value: seed.URL}}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var res Seed
+	if err := coll.FindOneAndUpdate(context, filter, update, opts).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// InsertSeed adds the seed unless one with the same URL already exists,
+// in which case the stored seed is returned untouched.
+func (s *Storage) InsertSeed(seed *Seed) (*Seed, error) {
+	onInsert := append(seedDefaults(),
+		bson.E{Key: "depth", Value: seed.Depth},
+		bson.E{Key: "budget", Value: seed.Budget},
+		bson.E{Key: "tags", Value: seedTags(seed)},
+		bson.E{Key: "updated_at", Value: time.Now().UTC()},
+	)
+	res, err := s.upsertSeed(seed, bson.D{{Key: "$setOnInsert", Value: onInsert}})
+	if err != nil {
+		return nil, fmt.Errorf("InsertSeed: %w", err)
+	}
+	return res, nil
+}
+
+// UpsertSeed adds the seed or overwrites depth, budget and tags of the
+// existing seed with the same URL.
+func (s *Storage) UpsertSeed(seed *Seed) (*Seed, error) {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "depth", Value: seed.Depth},
+			{Key: "budget", Value: seed.Budget},
+			{Key: "tags", Value: seedTags(seed)},
+			{Key: "updated_at", Value: time.Now().UTC()},
+		}},
+		{Key: "$setOnInsert", Value: seedDefaults()},
+	}
+	res, err := s.upsertSeed(seed, update)
+	if err != nil {
+		return nil, fmt.Errorf("UpsertSeed: %w", err)
+	}
+	return res, nil
+}
+
+func (s *Storage) GetSeeds() ([]*Seed, error) {
+	coll := s.DB.Database("crawler").Collection("seeds")
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(context, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("GetSeeds: %w", err)
+	}
+	defer cursor.Close(context)
+
+	seeds := []*Seed{}
+	if err := cursor.All(context, &seeds); err != nil {
+		return nil, fmt.Errorf("GetSeeds: %w", err)
+	}
+	return seeds, nil
+}
+
+func (s *Storage) GetSeedByID(id string) (*Seed, error) {
+	coll := s.DB.Database("crawler").Collection("seeds")
+	filter := bson.D{{Key: "seed_id", Value: id}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var res Seed
+	if err := coll.FindOne(context, filter).Decode(&res); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ERROR_INVALID_ID
+		}
+		return nil, fmt.Errorf("GetSeedByID: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *Storage) SetSeedPaused(id string, paused bool) (*Seed, error) {
+	coll := s.DB.Database("crawler").Collection("seeds")
+	filter := bson.D{{Key: "seed_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "paused", Value: paused},
+		{Key: "updated_at", Value: time.Now().UTC()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var res Seed
+	if err := coll.FindOneAndUpdate(context, filter, update, opts).Decode(&res); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ERROR_INVALID_ID
+		}
+		return nil, fmt.Errorf("SetSeedPaused: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *Storage) DeleteSeedByID(id string) error {
+	coll := s.DB.Database("crawler").Collection("seeds")
+	filter := bson.D{{Key: "seed_id", Value: id}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	res, err := coll.DeleteOne(context, filter)
+	if err != nil {
+		return fmt.Errorf("DeleteSeedByID: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ERROR_INVALID_ID
+	}
+	return nil
+}
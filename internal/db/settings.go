@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/limiter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+const LIMITS_SETTING_ID = "limits"
+
+func (s *Storage) GetLimits() (*limiter.Limits, error) {
+	coll := s.DB.Database("crawler").Collection("settings")
+	filter := bson.D{{Key: "_id", Value: LIMITS_SETTING_ID}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var res limiter.Limits
+	if err := coll.FindOne(context, filter).Decode(&res); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ERROR_INVALID_ID
+		}
+		return nil, fmt.Errorf("GetLimits: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *Storage) upsertLimits(update bson.D) error {
+	coll := s.DB.Database("crawler").Collection("settings")
+	filter := bson.D{{Key: "_id", Value: LIMITS_SETTING_ID}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	_, err := coll.UpdateOne(context, filter, update, options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+// InsertLimits stores l only when no limits were saved before, so the
+// values from config never override the ones changed at runtime.
+func (s *Storage) InsertLimits(l *limiter.Limits) error {
+	if err := s.upsertLimits(bson.D{{Key: "$setOnInsert", Value: l}}); err != nil {
+		return fmt.Errorf("InsertLimits: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) SetLimits(l *limiter.Limits) error {
+	if err := s.upsertLimits(bson.D{{Key: "$set", Value: l}}); err != nil {
+		return fmt.Errorf("SetLimits: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"github.com/evok02/jcrawler/internal/limiter"
+	"time"
+)
+
+// PageStore is what the crawler, the filter and the API need from page
+// storage. Storage is the MongoDB backend and LocalStore keeps pages in
+// an embedded database.
+type PageStore interface {
+	GetPageByID(id string) (*Page, error)
+	GetPagesByIDs(ids []string) ([]*Page, error)
+	InsertPage(p *Page) (PageStatus, error)
+	BulkUpsertPages(pages []*Page) []error
+	DeletePageByID(id string) error
+	GetPagesByIndex(query string, limit int) ([]*PageServe, error)
+	IteratePages(fn func(*Page) error) error
+	SetRanks(ranks []*PageRank) error
+}
+
+type SeedStore interface {
+	InsertSeed(seed *Seed) (*Seed, error)
+	UpsertSeed(seed *Seed) (*Seed, error)
+	GetSeeds() ([]*Seed, error)
+	GetSeedByID(id string) (*Seed, error)
+	SetSeedPaused(id string, paused bool) (*Seed, error)
+	DeleteSeedByID(id string) error
+}
+
+type FeedStore interface {
+	InsertFeed(f *Feed) error
+	GetDueFeeds(now time.Time, limit int) ([]*Feed, error)
+	UpdateFeed(f *Feed) error
+}
+
+type SettingsStore interface {
+	GetLimits() (*limiter.Limits, error)
+	InsertLimits(l *limiter.Limits) error
+	SetLimits(l *limiter.Limits) error
+}
+
+type FrontierStore interface {
+	SaveFrontier(entries []*FrontierEntry) error
+	LoadFrontier(limit int) ([]*FrontierEntry, error)
+}
+
+type VersionStore interface {
+	AddVersions(vs []*PageVersion) []error
+	GetVersions(id string) ([]*PageVersion, error)
+	GetVersion(id string, version int) (*PageVersion, error)
+	DeleteVersions(id string) error
+}
+
+// LinkStore keeps the link graph the rank job runs on and the anchors
+// pages are indexed with.
+type LinkStore interface {
+	SaveLinks(ls []*PageLinks) []error
+	IterateLinks(fn func(*PageLinks) error) error
+	GetAnchors(id string, limit int) ([]*Anchor, error)
+	DeleteLinks(id string) error
+}
+
+// QueryStore counts the searches users run, to suggest popular ones.
+type QueryStore interface {
+	RecordQuery(query string, at time.Time) error
+	PopularQueries(prefix string, minCount int64, limit int) ([]*PopularQuery, error)
+}
+
+// BlockStore keeps the URLs the crawler must not fetch again.
+type BlockStore interface {
+	BlockURL(b *BlockedURL) error
+	GetBlocked() ([]*BlockedURL, error)
+	GetBlockedURL(id string) (*BlockedURL, error)
+}
+
+// CrawlStore is the queue of on-demand crawls the API server adds to and
+// the crawler works off.
+type CrawlStore interface {
+	InsertCrawlJob(job *CrawlJob) error
+	GetCrawlJob(id string) (*CrawlJob, error)
+	ClaimCrawlJobs(limit int, staleBefore time.Time) ([]*CrawlJob, error)
+	UpdateCrawlTarget(id string, i int, t *CrawlTarget) error
+}
+
+// Store is everything the crawler and the API keep between runs.
+type Store interface {
+	PageStore
+	SeedStore
+	FeedStore
+	SettingsStore
+	FrontierStore
+	VersionStore
+	LinkStore
+	QueryStore
+	BlockStore
+	CrawlStore
+	CloseConnection() error
+}
+
+var _ Store = (*Storage)(nil)
+var _ Store = (*LocalStore)(nil)
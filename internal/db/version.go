@@ -0,0 +1,216 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"io"
+	"time"
+)
+
+// PageVersion is a snapshot of a page taken whenever its content hash
+// changed. Versions of a page are numbered from 1.
+type PageVersion struct {
+	URLHash     string    `bson:"url_hash_id" json:"id"`
+	Version     int       `bson:"version" json:"version"`
+	ContentHash string    `bson:"content_hash" json:"content_hash"`
+	Title       string    `bson:"title" json:"title"`
+	Size        int       `bson:"size" json:"size"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	Snapshot    []byte    `bson:"snapshot,omitempty" json:"-"`
+}
+
+func ContentHash(title, content string) string {
+	sum := sha256.Sum256([]byte(title + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewPageVersion(p *Page) (*PageVersion, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(p.Content)); err != nil {
+		return nil, fmt.Errorf("NewPageVersion: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("NewPageVersion: %w", err)
+	}
+	hash := p.ContentHash
+	if hash == "" {
+		hash = ContentHash(p.Title, p.Content)
+	}
+	createdAt := p.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+	return &PageVersion{
+		URLHash:     p.URLHash,
+		ContentHash: hash,
+		Title:       p.Title,
+		Size:        len(p.Content),
+		CreatedAt:   createdAt,
+		Snapshot:    buf.Bytes(),
+	}, nil
+}
+
+func (v *PageVersion) Content() (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(v.Snapshot))
+	if err != nil {
+		return "", fmt.Errorf("Content: %w", err)
+	}
+	defer zr.Close()
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("Content: %w", err)
+	}
+	return string(content), nil
+}
+
+type latestVersion struct {
+	URLHash     string `bson:"_id"`
+	Version     int    `bson:"version"`
+	ContentHash string `bson:"content_hash"`
+}
+
+// numberVersions assigns version numbers to vs and returns the indexes of
+// the ones whose content differs from the latest stored version.
+func numberVersions(vs []*PageVersion, latest map[string]latestVersion) []int {
+	changed := []int{}
+	for i, v := range vs {
+		last := latest[v.URLHash]
+		if last.Version > 0 && last.ContentHash == v.ContentHash {
+			continue
+		}
+		v.Version = last.Version + 1
+		latest[v.URLHash] = latestVersion{URLHash: v.URLHash, Version: v.Version, ContentHash: v.ContentHash}
+		changed = append(changed, i)
+	}
+	return changed
+}
+
+// AddVersions stores the versions whose content hash differs from the
+// latest stored version of their page and skips the rest. The unique
+// (url_hash_id, version) index turns a race between two writers into a
+// per-version error that can be retried.
+func (s *Storage) AddVersions(vs []*PageVersion) []error {
+	errs := make([]error, len(vs))
+	failAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = fmt.Errorf("AddVersions: %w", err)
+		}
+		return errs
+	}
+	if len(vs) == 0 {
+		return errs
+	}
+	coll := s.DB.Database("crawler").Collection("versions")
+
+	context, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	ids := make([]string, 0, len(vs))
+	for _, v := range vs {
+		ids = append(ids, v.URLHash)
+	}
+	cursor, err := coll.Aggregate(context, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "url_hash_id", Value: bson.D{{Key: "$in", Value: ids}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "version", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$url_hash_id"},
+			{Key: "version", Value: bson.D{{Key: "$first", Value: "$version"}}},
+			{Key: "content_hash", Value: bson.D{{Key: "$first", Value: "$content_hash"}}},
+		}}},
+	})
+	if err != nil {
+		return failAll(err)
+	}
+	found := []latestVersion{}
+	if err := cursor.All(context, &found); err != nil {
+		return failAll(err)
+	}
+	latest := make(map[string]latestVersion, len(found))
+	for _, l := range found {
+		latest[l.URLHash] = l
+	}
+
+	changed := numberVersions(vs, latest)
+	if len(changed) == 0 {
+		return errs
+	}
+	docs := make([]any, 0, len(changed))
+	for _, i := range changed {
+		docs = append(docs, vs[i])
+	}
+	_, err = coll.InsertMany(context, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return errs
+	}
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) {
+		return failAll(err)
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Index >= 0 && we.Index < len(changed) {
+			errs[changed[we.Index]] = fmt.Errorf("AddVersions: %s", we.Error())
+		}
+	}
+	return errs
+}
+
+// GetVersions lists the versions of a page without their snapshots.
+func (s *Storage) GetVersions(id string) ([]*PageVersion, error) {
+	coll := s.DB.Database("crawler").Collection("versions")
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "version", Value: 1}}).
+		SetProjection(bson.D{{Key: "snapshot", Value: 0}})
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(context, bson.D{{Key: "url_hash_id", Value: id}}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("GetVersions: %w", err)
+	}
+	versions := []*PageVersion{}
+	if err := cursor.All(context, &versions); err != nil {
+		return nil, fmt.Errorf("GetVersions: %w", err)
+	}
+	return versions, nil
+}
+
+func (s *Storage) GetVersion(id string, version int) (*PageVersion, error) {
+	coll := s.DB.Database("crawler").Collection("versions")
+	filter := bson.D{{Key: "url_hash_id", Value: id}, {Key: "version", Value: version}}
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	var res PageVersion
+	if err := coll.FindOne(context, filter).Decode(&res); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ERROR_INVALID_ID
+		}
+		return nil, fmt.Errorf("GetVersion: %w", err)
+	}
+	return &res, nil
+}
+
+// DeleteVersions removes every version of a page. A page without versions
+// is not an error.
+func (s *Storage) DeleteVersions(id string) error {
+	coll := s.DB.Database("crawler").Collection("versions")
+
+	context, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	if _, err := coll.DeleteMany(context, bson.D{{Key: "url_hash_id", Value: id}}); err != nil {
+		return fmt.Errorf("DeleteVersions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Insert
+	Delete
+)
+
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// MAX_EDIT_DISTANCE bounds the work spent on a diff. Inputs that differ
+// more are reported as a full replacement.
+const MAX_EDIT_DISTANCE = 4000
+
+// Lines returns the shortest edit script turning a into b, computed with
+// Myers' O(ND) algorithm.
+func Lines(a, b []string) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] keeps the diagonals -d-1..d+1 of v as they were before
+	// round d, which is all the backtracking needs.
+	trace := [][]int{}
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		if d > MAX_EDIT_DISTANCE {
+			return replaceAll(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	ops := []Op{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int {
+			return trace[d][k+d+1]
+		}
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, Op{Equal, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, Op{Insert, b[y]})
+			} else {
+				x--
+				ops = append(ops, Op{Delete, a[x]})
+			}
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func replaceAll(a, b []string) []Op {
+	ops := make([]Op, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, Op{Delete, line})
+	}
+	for _, line := range b {
+		ops = append(ops, Op{Insert, line})
+	}
+	return ops
+}
+
+// Sentences breaks extracted page text, which has no line structure, into
+// one sentence per line so that diffs point at the sentences that changed.
+func Sentences(text string) string {
+	var sb strings.Builder
+	for _, word := range strings.Fields(text) {
+		sb.WriteString(word)
+		if strings.ContainsAny(word[len(word)-1:], ".!?") {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString(" ")
+		}
+	}
+	out := strings.TrimSpace(sb.String())
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+// Unified renders the difference between a and b as a unified diff with
+// context lines around every change. It is empty when a equals b.
+func Unified(fromName, toName, a, b string, context int) string {
+	ops := Lines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	header := false
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].Kind == Equal {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// extend the hunk while changes are closer than 2*context apart
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].Kind != Equal {
+				end = i + 1
+			} else if i-end >= 2*context {
+				break
+			}
+		}
+		from := max(start-context, 0)
+		to := min(end+context, len(ops))
+
+		if !header {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+			header = true
+		}
+		aStart, bStart := position(ops, from)
+		aLen, bLen := 0, 0
+		for _, op := range ops[from:to] {
+			if op.Kind != Insert {
+				aLen++
+			}
+			if op.Kind != Delete {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunkStart(aStart, aLen), aLen, hunkStart(bStart, bLen), bLen)
+		for _, op := range ops[from:to] {
+			switch op.Kind {
+			case Equal:
+				sb.WriteString(" ")
+			case Insert:
+				sb.WriteString("+")
+			case Delete:
+				sb.WriteString("-")
+			}
+			sb.WriteString(op.Line)
+			sb.WriteString("\n")
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+func position(ops []Op, upTo int) (int, int) {
+	a, b := 0, 0
+	for _, op := range ops[:upTo] {
+		if op.Kind != Insert {
+			a++
+		}
+		if op.Kind != Delete {
+			b++
+		}
+	}
+	return a, b
+}
+
+// hunkStart converts a zero-based line position to the one-based start of
+// a hunk; empty ranges point at the line before them, as in GNU diff.
+func hunkStart(pos, length int) int {
+	if length == 0 {
+		return pos
+	}
+	return pos + 1
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func apply(ops []Op) ([]string, []string) {
+	a, b := []string{}, []string{}
+	for _, op := range ops {
+		if op.Kind != Insert {
+			a = append(a, op.Line)
+		}
+		if op.Kind != Delete {
+			b = append(b, op.Line)
+		}
+	}
+	return a, b
+}
+
+func TestLines(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	ops := Lines(a, b)
+
+	// Test: the script reproduces both inputs
+	gotA, gotB := apply(ops)
+	assert.Equal(t, a, gotA)
+	assert.Equal(t, b, gotB)
+
+	// Test: the script is minimal (D = 5 for this classic example)
+	edits := 0
+	for _, op := range ops {
+		if op.Kind != Equal {
+			edits++
+		}
+	}
+	assert.Equal(t, 5, edits)
+
+	assert.Equal(t, 0, len(Lines(nil, nil)))
+}
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	expected := `--- v1
++++ v2
+@@ -1,6 +1,6 @@
+ one
+ two
+-three
++THREE
+ four
+ five
+ six
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`
+	assert.Equal(t, expected, Unified("v1", "v2", a, b, 3))
+	assert.Equal(t, "", Unified("v1", "v2", a, a, 3))
+}
+
+func TestSentences(t *testing.T) {
+	assert.Equal(t, "Hello there.\nHow are you?\nFine\n", Sentences("  Hello  there. How are\nyou? Fine"))
+}
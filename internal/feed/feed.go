@@ -0,0 +1,248 @@
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/worker"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const MAX_FEED_SIZE = 10 << 20
+
+var ERROR_BAD_STATUS = errors.New("unexpected response status")
+var ERROR_UNKNOWN_FORMAT = errors.New("unknown feed format")
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2006-01-02",
+}
+
+type Item struct {
+	ID        string
+	Link      string
+	Published time.Time
+}
+
+type Feed struct {
+	Title string
+	Items []*Item
+}
+
+type rssItem struct {
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"`
+}
+
+type rss struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rdf struct {
+	Channel struct {
+		Title string `xml:"title"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atom struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		ID        string     `xml:"id"`
+		Links     []atomLink `xml:"link"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+	} `xml:"entry"`
+}
+
+func Parse(r io.Reader) (*Feed, error) {
+	dec := xml.NewDecoder(io.LimitReader(r, MAX_FEED_SIZE))
+	dec.Strict = false
+	dec.CharsetReader = func(_ string, in io.Reader) (io.Reader, error) {
+		return in, nil
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ERROR_UNKNOWN_FORMAT
+			}
+			return nil, fmt.Errorf("Parse: %s", err.Error())
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(start.Name.Local) {
+		case "rss":
+			return decodeRSS(dec, &start)
+		case "rdf":
+			return decodeRDF(dec, &start)
+		case "feed":
+			return decodeAtom(dec, &start)
+		default:
+			return nil, ERROR_UNKNOWN_FORMAT
+		}
+	}
+}
+
+func decodeRSS(dec *xml.Decoder, start *xml.StartElement) (*Feed, error) {
+	var raw rss
+	if err := dec.DecodeElement(&raw, start); err != nil {
+		return nil, fmt.Errorf("decodeRSS: %s", err.Error())
+	}
+	return &Feed{
+		Title: strings.TrimSpace(raw.Channel.Title),
+		Items: convertRSSItems(raw.Channel.Items),
+	}, nil
+}
+
+func decodeRDF(dec *xml.Decoder, start *xml.StartElement) (*Feed, error) {
+	var raw rdf
+	if err := dec.DecodeElement(&raw, start); err != nil {
+		return nil, fmt.Errorf("decodeRDF: %s", err.Error())
+	}
+	return &Feed{
+		Title: strings.TrimSpace(raw.Channel.Title),
+		Items: convertRSSItems(raw.Items),
+	}, nil
+}
+
+func convertRSSItems(raw []rssItem) []*Item {
+	items := make([]*Item, 0, len(raw))
+	for _, i := range raw {
+		link := strings.TrimSpace(i.Link)
+		if link == "" {
+			continue
+		}
+		id := strings.TrimSpace(i.GUID)
+		if id == "" {
+			id = link
+		}
+		published := parseDate(i.PubDate)
+		if published.IsZero() {
+			published = parseDate(i.Date)
+		}
+		items = append(items, &Item{ID: id, Link: link, Published: published})
+	}
+	return items
+}
+
+func decodeAtom(dec *xml.Decoder, start *xml.StartElement) (*Feed, error) {
+	var raw atom
+	if err := dec.DecodeElement(&raw, start); err != nil {
+		return nil, fmt.Errorf("decodeAtom: %s", err.Error())
+	}
+	f := &Feed{Title: strings.TrimSpace(raw.Title)}
+	for _, e := range raw.Entries {
+		link := atomAlternate(e.Links)
+		if link == "" {
+			continue
+		}
+		id := strings.TrimSpace(e.ID)
+		if id == "" {
+			id = link
+		}
+		published := parseDate(e.Published)
+		if published.IsZero() {
+			published = parseDate(e.Updated)
+		}
+		f.Items = append(f.Items, &Item{ID: id, Link: link, Published: published})
+	}
+	return f, nil
+}
+
+func atomAlternate(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+type PollResult struct {
+	NotModified  bool
+	ETag         string
+	LastModified string
+	Feed         *Feed
+}
+
+type Poller struct {
+	worker  *worker.Worker
+	timeout time.Duration
+}
+
+func NewPoller(w *worker.Worker, timeout time.Duration) *Poller {
+	return &Poller{
+		worker:  w,
+		timeout: timeout,
+	}
+}
+
+// Poll issues a conditional GET for the feed, so unchanged feeds cost a
+// 304 instead of a full download.
+func (p *Poller) Poll(ctx context.Context, url, etag, lastModified string) (*PollResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+
+	res, err := p.worker.FetchWithHeader(ctx, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("Poll: %s", err.Error())
+	}
+	defer res.Response.Body.Close()
+
+	switch res.Response.StatusCode {
+	case http.StatusNotModified:
+		return &PollResult{NotModified: true, ETag: etag, LastModified: lastModified}, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("Poll: %w: %s", ERROR_BAD_STATUS, res.Response.Status)
+	}
+
+	f, err := Parse(res.Response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Poll: %w", err)
+	}
+	return &PollResult{
+		ETag:         res.Response.Header.Get("ETag"),
+		LastModified: res.Response.Header.Get("Last-Modified"),
+		Feed:         f,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package feed
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rssXML = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Example Blog</title>
+    <item>
+      <title>First</title>
+      <link>https://example.com/first</link>
+      <guid>first-post</guid>
+      <pubDate>Mon, 06 May 2024 10:00:00 +0000</pubDate>
+    </item>
+    <item>
+      <title>Second</title>
+      <link>https://example.com/second</link>
+    </item>
+    <item>
+      <title>No link</title>
+    </item>
+  </channel>
+</rss>`
+
+const atomXML = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example News</title>
+  <entry>
+    <id>urn:uuid:1</id>
+    <link rel="self" href="https://example.com/api/1"/>
+    <link href="https://example.com/news/1"/>
+    <updated>2024-05-06T10:00:00Z</updated>
+  </entry>
+</feed>`
+
+func TestParseRSS(t *testing.T) {
+	f, err := Parse(strings.NewReader(rssXML))
+	require.NoError(t, err)
+	assert.Equal(t, "Example Blog", f.Title)
+	require.Equal(t, 2, len(f.Items))
+
+	assert.Equal(t, "first-post", f.Items[0].ID)
+	assert.Equal(t, "https://example.com/first", f.Items[0].Link)
+	assert.Equal(t, time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC), f.Items[0].Published)
+
+	// Test: missing guid falls back to the link
+	assert.Equal(t, "https://example.com/second", f.Items[1].ID)
+}
+
+func TestParseAtom(t *testing.T) {
+	f, err := Parse(strings.NewReader(atomXML))
+	require.NoError(t, err)
+	assert.Equal(t, "Example News", f.Title)
+	require.Equal(t, 1, len(f.Items))
+	assert.Equal(t, "urn:uuid:1", f.Items[0].ID)
+	assert.Equal(t, "https://example.com/news/1", f.Items[0].Link)
+	assert.False(t, f.Items[0].Published.IsZero())
+}
+
+func TestParseUnknown(t *testing.T) {
+	_, err := Parse(strings.NewReader("<html></html>"))
+	assert.ErrorIs(t, err, ERROR_UNKNOWN_FORMAT)
+}
@@ -28,7 +28,7 @@ func NewFilter(t time.Duration) *Filter {
 	}
 }
 
-func (f *Filter) IsValid(link *url.URL, s *db.Storage) (bool, error) {
+func (f *Filter) IsValid(link *url.URL, s db.PageStore) (bool, error) {
 	parsedURLStr := link.String()
 
 	if ok, err := filterLink(parsedURLStr); err != nil {
@@ -80,13 +80,18 @@ func (f *Filter) HashLink(link string) (string, error) {
 	return hex.EncodeToString(f.hash.Sum(nil)), nil
 }
 
-func (f *Filter) checkTimeout(s *db.Storage, id string) bool {
+func (f *Filter) checkTimeout(s db.PageStore, id string) bool {
 	p, err := s.GetPageByID(id)
 	if err != nil {
 		return true
 	}
 
-	if time.Since(p.UpdatedAt) < f.timeout {
+	// Pages stored before crawled_at existed only have updated_at.
+	crawledAt := p.CrawledAt
+	if crawledAt.IsZero() {
+		crawledAt = p.UpdatedAt
+	}
+	if time.Since(crawledAt) < f.timeout {
 		return false
 	}
 
@@ -1,8 +1,10 @@
 package filter
 
 import (
+	"github.com/evok02/jcrawler/internal/db"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -52,3 +54,39 @@ func TestFilterLink(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, ok)
 }
+
+func TestIsValid(t *testing.T) {
+	s, err := db.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	defer s.CloseConnection()
+	link, err := url.Parse("https://netflix.com/")
+	require.NoError(t, err)
+
+	ok, err := f.IsValid(link, s)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	hash, err := f.HashLink(normalizeURL(link.String()))
+	require.NoError(t, err)
+
+	// Test: recently stored pages are not crawled again
+	_, err = s.InsertPage(&db.Page{URLHash: hash, URL: link.String(), UpdatedAt: time.Now()})
+	require.NoError(t, err)
+	ok, err = f.IsValid(link, s)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = s.InsertPage(&db.Page{URLHash: hash, URL: link.String(), Title: "new", UpdatedAt: time.Now().Add(-time.Hour * 7)})
+	require.NoError(t, err)
+	ok, err = f.IsValid(link, s)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Test: a page that did not change for long but was just crawled waits
+	_, err = s.InsertPage(&db.Page{URLHash: hash, URL: link.String(), Title: "new",
+		UpdatedAt: time.Now().Add(-time.Hour * 24 * 7), CrawledAt: time.Now()})
+	require.NoError(t, err)
+	ok, err = f.IsValid(link, s)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
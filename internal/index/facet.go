@@ -0,0 +1,222 @@
+package index
+
+import (
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FACET_SIZE is how many values a facet lists, most frequent first.
+const FACET_SIZE = 10
+
+var ERROR_INVALID_DATE = errors.New("dates must be RFC 3339 timestamps or YYYY-MM-DD")
+
+// Filters narrow a search. Values of one filter are alternatives, and a
+// page has to pass every filter that is set.
+type Filters struct {
+	Hosts         []string
+	Domains       []string
+	Languages     []string
+	ContentTypes  []string
+	Keywords      []string
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+}
+
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// updatedRanges are the buckets of the updated facet, as OpenSearch date
+// math and as the age they stand for.
+var updatedRanges = []struct {
+	Key  string
+	From string
+	Age  time.Duration
+}{
+	{"day", "now-1d", 24 * time.Hour},
+	{"week", "now-7d", 7 * 24 * time.Hour},
+	{"month", "now-30d", 30 * 24 * time.Hour},
+	{"year", "now-365d", 365 * 24 * time.Hour},
+}
+
+// ParseDate reads a filter date. A bare day means its start in UTC.
+func ParseDate(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, ERROR_INVALID_DATE
+}
+
+// domains lists a host and its parent domains down to the registrable
+// part, so a filter on example.com also matches blog.example.com.
+func domains(host string) []string {
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	labels := strings.Split(host, ".")
+	res := []string{}
+	for i := 0; i < max(len(labels)-1, 1); i++ {
+		res = append(res, strings.Join(labels[i:], "."))
+	}
+	return res
+}
+
+func termsClause(field string, values []string) map[string]any {
+	return map[string]any{"terms": map[string]any{field: values}}
+}
+
+// clauses turns the filters into the filter context of a bool query, so
+// they narrow the hits without changing their scores.
+func (f *Filters) clauses() []any {
+	clauses := []any{}
+	for _, filter := range []struct {
+		field  string
+		values []string
+	}{
+		{"host", f.Hosts},
+		{"domains", f.Domains},
+		{"language", f.Languages},
+		{"content_type", f.ContentTypes},
+		{"keywords", f.Keywords},
+	} {
+		if len(filter.values) > 0 {
+			clauses = append(clauses, termsClause(filter.field, filter.values))
+		}
+	}
+	if !f.UpdatedAfter.IsZero() || !f.UpdatedBefore.IsZero() {
+		r := map[string]any{}
+		if !f.UpdatedAfter.IsZero() {
+			r["gte"] = f.UpdatedAfter.Format(time.RFC3339)
+		}
+		if !f.UpdatedBefore.IsZero() {
+			r["lt"] = f.UpdatedBefore.Format(time.RFC3339)
+		}
+		clauses = append(clauses, map[string]any{"range": map[string]any{"updated_at": r}})
+	}
+	return clauses
+}
+
+func anyOf(values []string, got ...string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range got {
+		if slices.Contains(values, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match applies the filters to a stored page, for backends that search
+// without OpenSearch.
+func (f *Filters) Match(p *db.Page) bool {
+	host := hostOf(p.URL)
+	switch {
+	case !anyOf(f.Hosts, host),
+		!anyOf(f.Domains, domains(host)...),
+		!anyOf(f.Languages, p.Language),
+		!anyOf(f.ContentTypes, p.ContentType),
+		!anyOf(f.Keywords, p.Keywords...):
+		return false
+	case !f.UpdatedAfter.IsZero() && p.UpdatedAt.Before(f.UpdatedAfter),
+		!f.UpdatedBefore.IsZero() && !p.UpdatedAt.Before(f.UpdatedBefore):
+		return false
+	}
+	return true
+}
+
+func aggregations() map[string]any {
+	terms := func(field string) map[string]any {
+		return map[string]any{"terms": map[string]any{"field": field, "size": FACET_SIZE}}
+	}
+	ranges := []any{}
+	for _, r := range updatedRanges {
+		ranges = append(ranges, map[string]any{"key": r.Key, "from": r.From})
+	}
+	ranges = append(ranges, map[string]any{"key": "older", "to": updatedRanges[len(updatedRanges)-1].From})
+	return map[string]any{
+		"host":         terms("host"),
+		"language":     terms("language"),
+		"content_type": terms("content_type"),
+		"keywords":     terms("keywords"),
+		"updated":      map[string]any{"date_range": map[string]any{"field": "updated_at", "ranges": ranges}},
+	}
+}
+
+type aggregationResult struct {
+	Buckets []struct {
+		Key      any   `json:"key"`
+		DocCount int64 `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+func (a *aggregationResult) facet() []*FacetBucket {
+	buckets := make([]*FacetBucket, 0, len(a.Buckets))
+	for _, b := range a.Buckets {
+		key, _ := b.Key.(string)
+		buckets = append(buckets, &FacetBucket{Value: key, Count: b.DocCount})
+	}
+	return buckets
+}
+
+// CountFacets computes the same facets OpenSearch returns over pages that
+// were searched without it.
+func CountFacets(pages []*db.Page, now time.Time) map[string][]*FacetBucket {
+	counts := map[string]map[string]int64{
+		"host": {}, "language": {}, "content_type": {}, "keywords": {},
+	}
+	add := func(facet, value string) {
+		if value != "" {
+			counts[facet][value]++
+		}
+	}
+	updated := make([]*FacetBucket, 0, len(updatedRanges)+1)
+	for _, r := range updatedRanges {
+		updated = append(updated, &FacetBucket{Value: r.Key})
+	}
+	updated = append(updated, &FacetBucket{Value: "older"})
+
+	for _, p := range pages {
+		add("host", hostOf(p.URL))
+		add("language", p.Language)
+		add("content_type", p.ContentType)
+		for _, k := range p.Keywords {
+			add("keywords", k)
+		}
+		age := now.Sub(p.UpdatedAt)
+		for i, r := range updatedRanges {
+			if age <= r.Age {
+				updated[i].Count++
+			}
+		}
+		if age > updatedRanges[len(updatedRanges)-1].Age {
+			updated[len(updated)-1].Count++
+		}
+	}
+
+	facets := map[string][]*FacetBucket{"updated": updated}
+	for facet, values := range counts {
+		buckets := make([]*FacetBucket, 0, len(values))
+		for v, n := range values {
+			buckets = append(buckets, &FacetBucket{Value: v, Count: n})
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			if buckets[i].Count != buckets[j].Count {
+				return buckets[i].Count > buckets[j].Count
+			}
+			return buckets[i].Value < buckets[j].Value
+		})
+		facets[facet] = buckets[:min(len(buckets), FACET_SIZE)]
+	}
+	return facets
+}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDomains(t *testing.T) {
+	assert.Equal(t, []string{"blog.example.com", "example.com"}, domains("blog.example.com"))
+	assert.Equal(t, []string{"example.com"}, domains("example.com"))
+	assert.Equal(t, []string{"localhost"}, domains("localhost"))
+	assert.Equal(t, []string{"127.0.0.1"}, domains("127.0.0.1"))
+}
+
+func TestFilters(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	p := &db.Page{
+		URL:         "https://blog.example.com/post",
+		UpdatedAt:   day.Add(12 * time.Hour),
+		Language:    "en",
+		ContentType: "text/html",
+		Keywords:    []string{"go", "crawler"},
+	}
+	assert.True(t, (&Filters{}).Match(p))
+
+	// Test: values of one filter are alternatives
+	assert.True(t, (&Filters{Hosts: []string{"a.com", "blog.example.com"}}).Match(p))
+	assert.True(t, (&Filters{Domains: []string{"example.com"}}).Match(p))
+	assert.True(t, (&Filters{Keywords: []string{"rust", "go"}}).Match(p))
+	assert.False(t, (&Filters{Hosts: []string{"example.com"}}).Match(p))
+
+	// Test: every filter that is set has to match
+	assert.False(t, (&Filters{Languages: []string{"en"}, ContentTypes: []string{"application/pdf"}}).Match(p))
+
+	// Test: the date range includes its start and excludes its end
+	assert.True(t, (&Filters{UpdatedAfter: day, UpdatedBefore: day.Add(24 * time.Hour)}).Match(p))
+	assert.False(t, (&Filters{UpdatedBefore: p.UpdatedAt}).Match(p))
+
+	// Test: set filters become terms and range clauses
+	clauses := (&Filters{Hosts: []string{"a.com"}, UpdatedAfter: day}).clauses()
+	require.Len(t, clauses, 2)
+	assert.Equal(t, termsClause("host", []string{"a.com"}), clauses[0])
+	assert.Empty(t, (&Filters{}).clauses())
+}
+
+func TestParseDate(t *testing.T) {
+	d, err := ParseDate("2024-05-01")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), d)
+	_, err = ParseDate("2024-05-01T10:00:00+02:00")
+	require.NoError(t, err)
+	_, err = ParseDate("yesterday")
+	assert.ErrorIs(t, err, ERROR_INVALID_DATE)
+}
+
+func TestCountFacets(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	pages := []*db.Page{
+		{URL: "https://a.com/1", UpdatedAt: now.Add(-time.Hour), Language: "en", Keywords: []string{"go"}},
+		{URL: "https://a.com/2", UpdatedAt: now.Add(-48 * time.Hour), Language: "de"},
+		{URL: "https://b.com/", UpdatedAt: now.Add(-400 * 24 * time.Hour), Language: "en"},
+	}
+	facets := CountFacets(pages, now)
+
+	// Test: values are counted most frequent first, empty ones are skipped
+	assert.Equal(t, []*FacetBucket{{"a.com", 2}, {"b.com", 1}}, facets["host"])
+	assert.Equal(t, []*FacetBucket{{"en", 2}, {"de", 1}}, facets["language"])
+	assert.Empty(t, facets["content_type"])
+
+	// Test: age buckets overlap like the OpenSearch date ranges do
+	assert.Equal(t, []*FacetBucket{
+		{"day", 1}, {"week", 2}, {"month", 2}, {"year", 2}, {"older", 1},
+	}, facets["updated"])
+}
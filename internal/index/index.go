@@ -1,32 +1,93 @@
 package index
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
-	opensearch "github.com/opensearch-project/opensearch-go"
-	"strings"
-	//opensearchapi "github.com/opensearch-project/opensearch-go/opensearchapi"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/evok02/jcrawler/internal/config"
 	"github.com/evok02/jcrawler/internal/db"
+	opensearch "github.com/opensearch-project/opensearch-go"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
-const IndexName = "page_content"
+// IndexName is the alias every read and write goes through. The documents
+// live in versioned indexes behind it, see VersionedName.
+const IndexName = "pages"
+
+// BOOTSTRAP_TIMEOUT bounds the requests Init makes to set up the index.
+const BOOTSTRAP_TIMEOUT = 30 * time.Second
+
+// MAX_ANCHORS bounds how many inbound links a document is built from.
+const MAX_ANCHORS = 100
 
 var ERROR_UNSUPPORTED_DOC_TYPE = errors.New("unsupported doc type")
 
+// SearchFields are the fields a query matches, with anchor text that
+// other pages used for a page counting more than its own body.
+var SearchFields = []string{"title^5", "anchors^3", "anchor_context", "content"}
+
+// Document is what a page is indexed as: the page itself plus the anchor
+// text and context of the links pointing at it, kept in separate fields
+// so queries can boost them.
+type Document struct {
+	*db.Page
+	Host          string      `json:"host"`
+	Domains       []string    `json:"domains"`
+	Anchors       []string    `json:"anchors,omitempty"`
+	AnchorContext []string    `json:"anchor_context,omitempty"`
+	Suggest       *Completion `json:"suggest,omitempty"`
+}
+
+// NewDocument aggregates the anchors of a page's inbound links. Repeated
+// texts are indexed once, so a site-wide menu link does not drown out the
+// rest.
+func NewDocument(p *db.Page, anchors []*db.Anchor) *Document {
+	doc := &Document{Page: p, Host: hostOf(p.URL)}
+	doc.Domains = domains(doc.Host)
+	doc.Suggest = titleCompletion(p)
+	texts := make(map[string]bool)
+	contexts := make(map[string]bool)
+	for _, a := range anchors {
+		if text := strings.ToLower(a.Text); text != "" && !texts[text] {
+			texts[text] = true
+			doc.Anchors = append(doc.Anchors, a.Text)
+		}
+		if ctx := strings.ToLower(a.Context); ctx != "" && !contexts[ctx] {
+			contexts[ctx] = true
+			doc.AnchorContext = append(doc.AnchorContext, a.Context)
+		}
+	}
+	return doc
+}
+
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
 type Index struct {
-	osClient *opensearch.Client
+	osClient  *opensearch.Client
+	transport *http.Transport
+	cfg       *config.IndexConfig
 }
 
-func Init(cfg *config.IndexConfig) (*Index, error) {
+// Connect opens a client without touching the cluster, for readers that
+// expect the index to be set up already.
+func Connect(cfg *config.IndexConfig) (*Index, error) {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
 	client, err := opensearch.NewClient(opensearch.Config{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Transport: transport,
 		Addresses: []string{cfg.Addr},
 		Username:  cfg.User,
 		Password:  cfg.Pwd,
@@ -35,7 +96,27 @@ func Init(cfg *config.IndexConfig) (*Index, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Index{osClient: client}, nil
+	return &Index{osClient: client, transport: transport, cfg: cfg}, nil
+}
+
+// Init connects and bootstraps the index, so writers can start right away.
+func Init(cfg *config.IndexConfig) (*Index, error) {
+	i, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), BOOTSTRAP_TIMEOUT)
+	defer cancel()
+	if err := i.Bootstrap(ctx); err != nil {
+		i.Close()
+		return nil, err
+	}
+	return i, nil
+}
+
+func (i *Index) Close() {
+	i.transport.CloseIdleConnections()
 }
 
 func (i *Index) HandleEntry(ctx context.Context, doc any) error {
@@ -44,17 +125,171 @@ func (i *Index) HandleEntry(ctx context.Context, doc any) error {
 		return fmt.Errorf("HandleEntry: %s", err.Error())
 	}
 
+	var id string
 	switch doc := doc.(type) {
 	case *db.Page:
-		_, err := i.osClient.Index(
-			"pages_index",
-			strings.NewReader(string(data)),
-			i.osClient.Index.WithDocumentID(doc.URLHash))
-		if err != nil {
-			return fmt.Errorf("HandleEntry: %s", err.Error())
-		}
+		id = doc.URLHash
+	case *Document:
+		id = doc.URLHash
 	default:
 		return ERROR_UNSUPPORTED_DOC_TYPE
 	}
+	_, err = i.osClient.Index(
+		IndexName,
+		strings.NewReader(string(data)),
+		i.osClient.Index.WithDocumentID(id),
+		i.osClient.Index.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("HandleEntry: %s", err.Error())
+	}
 	return nil
 }
+
+// DeleteDocument removes a page from the index and refreshes it, so the
+// page is gone from the next search. A page that was never indexed is
+// not an error.
+func (i *Index) DeleteDocument(ctx context.Context, id string) error {
+	res, err := i.osClient.Delete(IndexName, id,
+		i.osClient.Delete.WithRefresh("true"),
+		i.osClient.Delete.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("DeleteDocument: %w: %s", ERROR_UNAVAILABLE, err.Error())
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil
+	}
+	if res, err = checkResponse(res, nil); err != nil {
+		return fmt.Errorf("DeleteDocument: %w", err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+type bulkTarget struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Version     int64  `json:"version,omitempty"`
+	VersionType string `json:"version_type,omitempty"`
+}
+
+type bulkAction struct {
+	Index  *bulkTarget `json:"index,omitempty"`
+	Update *bulkTarget `json:"update,omitempty"`
+	Delete *bulkTarget `json:"delete,omitempty"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// BulkIndex sends documents in a single _bulk request. It returns one
+// error per document, so a caller can retry only the ones that were
+// rejected. A document is versioned with its crawl time, so a stale copy
+// never replaces a newer one; writing it is skipped instead.
+func (i *Index) BulkIndex(ctx context.Context, docs []*Document) []error {
+	errs := make([]error, len(docs))
+	if len(docs) == 0 {
+		return errs
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		target := &bulkTarget{Index: IndexName, ID: doc.URLHash}
+		if !doc.CrawledAt.IsZero() {
+			target.Version = doc.CrawledAt.UnixMilli()
+			target.VersionType = "external_gte"
+		}
+		if err := enc.Encode(bulkAction{Index: target}); err != nil {
+			return failAll(errs, "BulkIndex", err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return failAll(errs, "BulkIndex", err)
+		}
+	}
+	return i.bulk(ctx, "BulkIndex", &body, errs, http.StatusConflict)
+}
+
+type rankUpdate struct {
+	Doc struct {
+		Rank     float64 `json:"rank"`
+		InDegree int     `json:"in_degree"`
+	} `json:"doc"`
+}
+
+// UpdateRanks writes link scores onto indexed pages with partial updates.
+// Pages that are not in the index yet are skipped; the crawler sets the
+// score of a page from the last rank run or its stored copy before it
+// indexes the page.
+func (i *Index) UpdateRanks(ctx context.Context, ranks []*db.PageRank) []error {
+	errs := make([]error, len(ranks))
+	if len(ranks) == 0 {
+		return errs
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range ranks {
+		action := bulkAction{Update: &bulkTarget{Index: IndexName, ID: r.URLHash}}
+		if err := enc.Encode(action); err != nil {
+			return failAll(errs, "UpdateRanks", err)
+		}
+		var update rankUpdate
+		update.Doc.Rank = r.Rank
+		update.Doc.InDegree = r.InDegree
+		if err := enc.Encode(update); err != nil {
+			return failAll(errs, "UpdateRanks", err)
+		}
+	}
+	return i.bulk(ctx, "UpdateRanks", &body, errs, http.StatusNotFound)
+}
+
+func failAll(errs []error, name string, err error) []error {
+	for n := range errs {
+		errs[n] = fmt.Errorf("%s: %s", name, err.Error())
+	}
+	return errs
+}
+
+// bulk sends a _bulk body and fills errs with the error of every rejected
+// item. Items that failed with the status skip, such as a document that
+// does not exist, are not errors.
+func (i *Index) bulk(ctx context.Context, name string, body *bytes.Buffer, errs []error, skip int) []error {
+	res, err := i.osClient.Bulk(body, i.osClient.Bulk.WithContext(ctx))
+	if err != nil {
+		return failAll(errs, name, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return failAll(errs, name, fmt.Errorf("bulk request failed: %s", res.Status()))
+	}
+
+	var parsed bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return failAll(errs, name, err)
+	}
+	if !parsed.Errors {
+		return errs
+	}
+	for n, item := range parsed.Items {
+		if n >= len(errs) {
+			break
+		}
+		for _, result := range item {
+			if result.Error == nil || result.Status == skip {
+				continue
+			}
+			errs[n] = fmt.Errorf("%s: %s: %s", name, result.Error.Type, result.Error.Reason)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,326 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDocument(t *testing.T) {
+	p := &db.Page{URLHash: "a", URL: "https://a.com", Title: "A"}
+	doc := NewDocument(p, []*db.Anchor{
+		{SourceHash: "b", Text: "Go crawler", Context: "a fast"},
+		{SourceHash: "c", Text: "go crawler", Context: "a fast"},
+		{SourceHash: "d", Text: "", Context: "see the docs"},
+	})
+
+	// Test: repeated anchors are indexed once
+	assert.Equal(t, []string{"Go crawler"}, doc.Anchors)
+	assert.Equal(t, []string{"a fast", "see the docs"}, doc.AnchorContext)
+
+	// Test: the page fields stay at the top level of the document
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "A", fields["title"])
+	assert.Equal(t, "a.com", fields["host"])
+	assert.Equal(t, []any{"Go crawler"}, fields["anchors"])
+
+	// Test: pages nobody links to have no anchor fields
+	data, err = json.Marshal(NewDocument(p, nil))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "anchors")
+}
+
+func TestIndexBody(t *testing.T) {
+	cfg := &config.IndexConfig{Language: "german"}
+	cfg.Settings.ShardsNum = 3
+	cfg.Settings.ReplicasNum = 2
+	body := indexBody(cfg)
+
+	// Test: the configured shard and replica counts are applied
+	settings := body["settings"].(map[string]any)["index"].(map[string]any)
+	assert.Equal(t, 3, settings["number_of_shards"])
+	assert.Equal(t, 2, settings["number_of_replicas"])
+
+	// Test: every indexed document field has a mapping
+	props := body["mappings"].(map[string]any)["properties"].(map[string]any)
+	data, err := json.Marshal(NewDocument(&db.Page{URL: "https://a.com"}, []*db.Anchor{{Text: "a", Context: "b"}}))
+	require.NoError(t, err)
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(data, &fields))
+	for field := range fields {
+		assert.Contains(t, props, field)
+	}
+	assert.Equal(t, "german", props["content"].(map[string]any)["analyzer"])
+	assert.Equal(t, "keyword", props["host"].(map[string]any)["type"])
+}
+
+func TestIndexVersion(t *testing.T) {
+	assert.Equal(t, "pages_v3", VersionedName(3))
+	assert.Equal(t, 3, indexVersion("pages_v3"))
+	assert.Equal(t, 0, indexVersion("pages_index"))
+	assert.Equal(t, 0, indexVersion(""))
+}
+
+// fakeCluster answers the alias, index, reindex and bulk calls of the
+// index lifecycle and document deletes, and records them along with the
+// bodies of the reindex requests and the ids bulk requests delete. With
+// failCopy set every reindex fails.
+type fakeCluster struct {
+	alias    string
+	indices  map[string]bool
+	failCopy bool
+	calls    []string
+	copies   []map[string]any
+	deleted  []string
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/" {
+		w.Write([]byte(`{"version":{"number":"2.11.0","distribution":"opensearch"}}`))
+		return
+	}
+	if f.indices == nil {
+		f.indices = make(map[string]bool)
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/_alias/"+IndexName:
+		if f.alias == "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"alias [pages] missing","status":404}`))
+			return
+		}
+		fmt.Fprintf(w, `{%q:{"aliases":{%q:{}}}}`, f.alias, IndexName)
+	case r.Method == http.MethodPost && r.URL.Path == "/_aliases":
+		var body struct {
+			Actions []map[string]struct {
+				Index string `json:"index"`
+			} `json:"actions"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, action := range body.Actions {
+			if add, ok := action["add"]; ok {
+				f.alias = add.Index
+			}
+		}
+		w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/_reindex":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		f.copies = append(f.copies, body)
+		if f.failCopy {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"type":"exception","reason":"copy failed"},"status":500}`))
+			return
+		}
+		w.Write([]byte(`{"failures":[]}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		dec := json.NewDecoder(r.Body)
+		for {
+			var action map[string]bulkTarget
+			if dec.Decode(&action) != nil {
+				break
+			}
+			if target, ok := action["delete"]; ok {
+				f.deleted = append(f.deleted, target.Index+"/"+target.ID)
+			}
+		}
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	case r.Method == http.MethodHead:
+		if !f.indices[name] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		if f.indices[name] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"type":"resource_already_exists_exception","reason":"exists"},"status":400}`))
+			return
+		}
+		f.indices[name] = true
+		w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodDelete && r.URL.Path == "/"+IndexName+"/_doc/missing":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"result":"not_found"}`))
+	case r.Method == http.MethodDelete && r.URL.Path == "/"+IndexName+"/_doc/busy":
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"type":"rejected_execution_exception","reason":"queue is full"},"status":429}`))
+	case r.Method == http.MethodDelete && strings.Contains(name, "/_doc/"):
+		w.Write([]byte(`{"result":"deleted"}`))
+	case r.Method == http.MethodDelete:
+		delete(f.indices, name)
+		w.Write([]byte(`{"acknowledged":true}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	cluster := &fakeCluster{}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+
+	// Test: Init creates the first version and the alias
+	idx, err := Init(&config.IndexConfig{Addr: srv.URL, Language: "english"})
+	require.NoError(t, err)
+	defer idx.Close()
+	assert.Equal(t, VersionedName(MAPPING_VERSION), cluster.alias)
+	assert.Contains(t, cluster.calls, "PUT /"+VersionedName(MAPPING_VERSION))
+
+	// Test: a reindex copies into the next version before moving the alias
+	cluster.calls = nil
+	blocked := func() ([]*db.BlockedURL, error) {
+		return []*db.BlockedURL{{URLHash: "gone"}}, nil
+	}
+	start := time.Now()
+	from, to, err := idx.Reindex(context.Background(), blocked)
+	require.NoError(t, err)
+	assert.Equal(t, []string{VersionedName(MAPPING_VERSION)}, from)
+	assert.Equal(t, VersionedName(MAPPING_VERSION+1), to)
+	assert.Equal(t, to, cluster.alias)
+	assert.Equal(t, []string{
+		"GET /_alias/" + IndexName,
+		"HEAD /" + LEGACY_INDEX,
+		"HEAD /" + to,
+		"PUT /" + to,
+		"POST /_reindex",
+		"POST /_aliases",
+		"POST /_reindex",
+		"POST /_bulk",
+	}, cluster.calls)
+
+	// Test: copies keep the crawl time versions, so pages crawled during
+	// the copy only replace older copies once the alias moved
+	require.Len(t, cluster.copies, 2)
+	assert.NotContains(t, cluster.copies[0]["source"], "query")
+	for _, copy := range cluster.copies {
+		assert.Equal(t, map[string]any{"index": to, "version_type": "external_gte"}, copy["dest"])
+		assert.Equal(t, "proceed", copy["conflicts"])
+	}
+	source := cluster.copies[1]["source"].(map[string]any)
+	assert.Equal(t, from[0], source["index"])
+	gte := source["query"].(map[string]any)["range"].(map[string]any)["crawled_at"].(map[string]any)["gte"]
+	since, err := time.Parse(time.RFC3339, gte.(string))
+	require.NoError(t, err)
+	assert.WithinDuration(t, start.Add(-REINDEX_CLOCK_SKEW), since, 2*time.Second)
+
+	// Test: pages deleted during the copy are removed from the new index
+	assert.Equal(t, []string{to + "/gone"}, cluster.deleted)
+
+	// Test: pages of the pre-alias index are copied first and unversioned
+	cluster.calls = nil
+	cluster.copies = nil
+	cluster.indices[LEGACY_INDEX] = true
+	from, to, err = idx.Reindex(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{LEGACY_INDEX, VersionedName(MAPPING_VERSION + 1)}, from)
+	assert.Equal(t, VersionedName(MAPPING_VERSION+2), to)
+	require.Len(t, cluster.copies, 3)
+	assert.Equal(t, LEGACY_INDEX, cluster.copies[0]["source"].(map[string]any)["index"])
+	assert.Equal(t, map[string]any{"index": to}, cluster.copies[0]["dest"])
+	assert.Equal(t, from[1], cluster.copies[1]["source"].(map[string]any)["index"])
+	delete(cluster.indices, LEGACY_INDEX)
+
+	// Test: a failed copy deletes the new index and keeps the alias
+	cluster.failCopy = true
+	_, _, err = idx.Reindex(context.Background(), nil)
+	require.Error(t, err)
+	assert.Equal(t, to, cluster.alias)
+	assert.False(t, cluster.indices[VersionedName(MAPPING_VERSION+3)])
+
+	// Test: an index left behind by an earlier run is replaced
+	cluster.failCopy = false
+	cluster.indices[VersionedName(MAPPING_VERSION+3)] = true
+	_, to, err = idx.Reindex(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, VersionedName(MAPPING_VERSION+3), to)
+	assert.Equal(t, to, cluster.alias)
+
+	// Test: an existing alias is left alone on startup
+	cluster.calls = nil
+	require.NoError(t, idx.Bootstrap(context.Background()))
+	assert.Equal(t, []string{"GET /_alias/" + IndexName}, cluster.calls)
+}
+
+func TestDeleteDocument(t *testing.T) {
+	cluster := &fakeCluster{}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+	idx, err := Connect(&config.IndexConfig{Addr: srv.URL})
+	require.NoError(t, err)
+	defer idx.Close()
+
+	require.NoError(t, idx.DeleteDocument(context.Background(), "a"))
+	assert.Equal(t, []string{"DELETE /" + IndexName + "/_doc/a"}, cluster.calls)
+
+	// Test: deleting a page that was never indexed is not an error
+	require.NoError(t, idx.DeleteDocument(context.Background(), "missing"))
+
+	// Test: error responses keep the status of the cluster
+	err = idx.DeleteDocument(context.Background(), "busy")
+	var cerr *ClusterError
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, http.StatusTooManyRequests, cerr.Status)
+	assert.Equal(t, "rejected_execution_exception", cerr.Type)
+}
+
+func TestBulkIndexVersions(t *testing.T) {
+	var actions []bulkAction
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"2.11.0","distribution":"opensearch"}}`))
+			return
+		}
+		dec := json.NewDecoder(r.Body)
+		for {
+			var action bulkAction
+			if dec.Decode(&action) != nil {
+				break
+			}
+			actions = append(actions, action)
+			var doc map[string]any
+			dec.Decode(&doc)
+		}
+		w.Write([]byte(`{"errors":true,"items":[` +
+			`{"index":{"_id":"new","status":201}},` +
+			`{"index":{"_id":"stale","status":409,"error":{"type":"version_conflict_engine_exception","reason":"newer copy"}}},` +
+			`{"index":{"_id":"bad","status":400,"error":{"type":"mapper_parsing_exception","reason":"bad field"}}}]}`))
+	}))
+	defer srv.Close()
+	idx, err := Connect(&config.IndexConfig{Addr: srv.URL})
+	require.NoError(t, err)
+	defer idx.Close()
+
+	crawled := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	errs := idx.BulkIndex(context.Background(), []*Document{
+		NewDocument(&db.Page{URLHash: "new", CrawledAt: crawled}, nil),
+		NewDocument(&db.Page{URLHash: "stale", CrawledAt: crawled}, nil),
+		NewDocument(&db.Page{URLHash: "bad"}, nil),
+	})
+
+	// Test: documents are versioned with their crawl time
+	require.Len(t, actions, 3)
+	assert.Equal(t, crawled.UnixMilli(), actions[0].Index.Version)
+	assert.Equal(t, "external_gte", actions[0].Index.VersionType)
+	assert.Zero(t, actions[2].Index.Version)
+	assert.Empty(t, actions[2].Index.VersionType)
+
+	// Test: a write that lost to a newer copy is not an error
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Error(t, errs[2])
+}
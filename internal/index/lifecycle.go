@@ -0,0 +1,428 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MAPPING_VERSION is the version of the mapping below. Bump it with every
+// mapping change and run a reindex, which moves the alias to a new index
+// built with the new mapping.
+const MAPPING_VERSION = 4
+
+// LEGACY_INDEX is the index pages were written to before they moved
+// behind the alias. A reindex copies what is left in it.
+const LEGACY_INDEX = "pages_index"
+
+// REINDEX_CLOCK_SKEW is how far before the start of a reindex the catch-up
+// reaches back, as crawled_at comes from the clock of the crawler.
+const REINDEX_CLOCK_SKEW = time.Minute
+
+// REINDEX_DELETE_BATCH is how many blocked pages one bulk request removes
+// from a new index.
+const REINDEX_DELETE_BATCH = 500
+
+var ERROR_AMBIGUOUS_ALIAS = errors.New("alias points at more than one index")
+var ERROR_UNAVAILABLE = errors.New("search cluster is unavailable")
+
+// VersionedName is the concrete index that holds mapping version v.
+func VersionedName(v int) string {
+	return fmt.Sprintf("%s_v%d", IndexName, v)
+}
+
+func indexVersion(name string) int {
+	v, err := strconv.Atoi(strings.TrimPrefix(name, IndexName+"_v"))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// textField analyzes a field with the configured language, so stemming and
+// stop words match the crawled content, and keeps a standard-analyzed
+// subfield for exact word matches.
+func textField(language string) map[string]any {
+	return map[string]any{
+		"type":     "text",
+		"analyzer": language,
+		"fields": map[string]any{
+			"std": map[string]any{"type": "text", "analyzer": "standard"},
+		},
+	}
+}
+
+// indexBody is the settings and mapping every versioned index is created
+// with. Fields that are not mapped are kept in _source but not indexed.
+func indexBody(cfg *config.IndexConfig) map[string]any {
+	keyword := map[string]any{"type": "keyword"}
+	return map[string]any{
+		"settings": map[string]any{
+			"index": map[string]any{
+				"number_of_shards":   cfg.Settings.ShardsNum,
+				"number_of_replicas": cfg.Settings.ReplicasNum,
+			},
+		},
+		"mappings": map[string]any{
+			"dynamic": "false",
+			"_meta":   map[string]any{"version": MAPPING_VERSION},
+			"properties": map[string]any{
+				"id":             keyword,
+				"url":            keyword,
+				"host":           keyword,
+				"domains":        keyword,
+				"language":       keyword,
+				"content_type":   keyword,
+				"keywords":       keyword,
+				"content_hash":   keyword,
+				"title":          textField(cfg.Language),
+				"content":        textField(cfg.Language),
+				"anchors":        textField(cfg.Language),
+				"anchor_context": textField(cfg.Language),
+				"updated_at":     map[string]any{"type": "date"},
+				"crawled_at":     map[string]any{"type": "date"},
+				"rank":           map[string]any{"type": "float"},
+				"in_degree":      map[string]any{"type": "integer"},
+				"meta":           map[string]any{"type": "object", "enabled": false},
+				"suggest":        map[string]any{"type": "completion", "analyzer": "simple"},
+			},
+		},
+	}
+}
+
+type responseError struct {
+	Error struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// ClusterError is an error response of the cluster. Status is its HTTP
+// status, so callers can tell a rejected request from a busy or
+// unavailable cluster.
+type ClusterError struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ClusterError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("request failed: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Reason)
+}
+
+// checkResponse turns a failed request into ERROR_UNAVAILABLE and an error
+// response into a *ClusterError, closing the body of the latter.
+func checkResponse(res *opensearchapi.Response, err error) (*opensearchapi.Response, error) {
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ERROR_UNAVAILABLE, err.Error())
+	}
+	if !res.IsError() {
+		return res, nil
+	}
+	defer res.Body.Close()
+	var parsed responseError
+	json.NewDecoder(res.Body).Decode(&parsed)
+	return nil, &ClusterError{
+		Status: res.StatusCode,
+		Type:   parsed.Error.Type,
+		Reason: parsed.Error.Reason,
+	}
+}
+
+func encodeBody(v any) (*bytes.Reader, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// Bootstrap makes sure the alias exists. On a fresh cluster it creates the
+// index for the current mapping version and points the alias at it; an
+// existing alias is left alone even if it is on an older version. Pages
+// of the LEGACY_INDEX are not touched here; a reindex copies them over.
+func (i *Index) Bootstrap(ctx context.Context) error {
+	current, err := i.aliasTarget(ctx)
+	if err != nil {
+		return fmt.Errorf("Bootstrap: %s", err.Error())
+	}
+	if current != "" {
+		return nil
+	}
+	name := VersionedName(MAPPING_VERSION)
+	if err := i.createIndex(ctx, name); err != nil {
+		return fmt.Errorf("Bootstrap: %s", err.Error())
+	}
+	if err := i.swapAlias(ctx, "", name); err != nil {
+		return fmt.Errorf("Bootstrap: %s", err.Error())
+	}
+	return nil
+}
+
+// Reindex copies the documents behind the alias into a new versioned index
+// and then moves the alias in one atomic step, so searches never see a
+// missing or half-filled index. Pages written while the copy runs still go
+// to the old index, so once the alias moved the ones crawled since the
+// copy started are copied again. Copies keep the version BulkIndex gives
+// every document, its crawl time, so they never replace a page that was
+// crawled again since. Pages of the LEGACY_INDEX that predates the alias
+// are copied first. Deletes sent through the alias during the copy only
+// reach the old index, so the ids blocked returns are removed from the new
+// one at the end. A run that fails before the alias moved deletes the new
+// index again; the source indexes are kept and have to be deleted by hand.
+func (i *Index) Reindex(ctx context.Context, blocked func() ([]*db.BlockedURL, error)) (from []string, to string, err error) {
+	current, err := i.aliasTarget(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+	}
+	legacy, err := i.indexExists(ctx, LEGACY_INDEX)
+	if err != nil {
+		return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+	}
+	to = VersionedName(max(indexVersion(current)+1, MAPPING_VERSION))
+	// Nothing points at to yet, so an existing one is left from a run
+	// that could not clean up after itself.
+	leftover, err := i.indexExists(ctx, to)
+	if err != nil {
+		return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+	}
+	if leftover {
+		if err := i.deleteIndex(ctx, to); err != nil {
+			return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+		}
+	}
+	if err := i.createIndex(ctx, to); err != nil {
+		return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+	}
+
+	swapped, target := false, to
+	defer func() {
+		if err == nil || swapped {
+			return
+		}
+		cleanup, cancel := context.WithTimeout(context.WithoutCancel(ctx), BOOTSTRAP_TIMEOUT)
+		defer cancel()
+		i.deleteIndex(cleanup, target)
+	}()
+	if legacy {
+		if err := i.copyIndex(ctx, LEGACY_INDEX, to, time.Time{}, false); err != nil {
+			return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+		}
+		from = append(from, LEGACY_INDEX)
+	}
+	start := time.Now().Add(-REINDEX_CLOCK_SKEW)
+	if current != "" {
+		if err := i.copyIndex(ctx, current, to, time.Time{}, true); err != nil {
+			return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+		}
+		from = append(from, current)
+	}
+	if err := i.swapAlias(ctx, current, to); err != nil {
+		return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+	}
+	swapped = true
+
+	if current != "" {
+		if err := i.copyIndex(ctx, current, to, start, true); err != nil {
+			return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+		}
+	}
+	if blocked != nil {
+		if err := i.removeBlocked(ctx, to, blocked); err != nil {
+			return nil, "", fmt.Errorf("Reindex: %s", err.Error())
+		}
+	}
+	return from, to, nil
+}
+
+// removeBlocked deletes the pages of the blocklist from index name in
+// batches of REINDEX_DELETE_BATCH.
+func (i *Index) removeBlocked(ctx context.Context, name string, blocked func() ([]*db.BlockedURL, error)) error {
+	entries, err := blocked()
+	if err != nil {
+		return err
+	}
+	for len(entries) > 0 {
+		batch := entries[:min(len(entries), REINDEX_DELETE_BATCH)]
+		entries = entries[len(batch):]
+
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, b := range batch {
+			if err := enc.Encode(bulkAction{Delete: &bulkTarget{Index: name, ID: b.URLHash}}); err != nil {
+				return err
+			}
+		}
+		for _, err := range i.bulk(ctx, "removeBlocked", &body, make([]error, len(batch)), http.StatusNotFound) {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexExists reports whether there is a concrete index or alias called
+// name.
+func (i *Index) indexExists(ctx context.Context, name string) (bool, error) {
+	res, err := i.osClient.Indices.Exists([]string{name},
+		i.osClient.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ERROR_UNAVAILABLE, err.Error())
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, &ClusterError{Status: res.StatusCode}
+}
+
+// aliasTarget returns the index the alias points at, or "" if there is no
+// alias yet.
+func (i *Index) aliasTarget(ctx context.Context) (string, error) {
+	res, err := i.osClient.Indices.GetAlias(
+		i.osClient.Indices.GetAlias.WithName(IndexName),
+		i.osClient.Indices.GetAlias.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return "", nil
+	}
+	if res, err = checkResponse(res, nil); err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var indices map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return "", err
+	}
+	if len(indices) > 1 {
+		return "", ERROR_AMBIGUOUS_ALIAS
+	}
+	for name := range indices {
+		return name, nil
+	}
+	return "", nil
+}
+
+func (i *Index) createIndex(ctx context.Context, name string) error {
+	body, err := encodeBody(indexBody(i.cfg))
+	if err != nil {
+		return err
+	}
+	res, err := checkResponse(i.osClient.Indices.Create(name,
+		i.osClient.Indices.Create.WithBody(body),
+		i.osClient.Indices.Create.WithContext(ctx)))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (i *Index) deleteIndex(ctx context.Context, name string) error {
+	res, err := checkResponse(i.osClient.Indices.Delete([]string{name},
+		i.osClient.Indices.Delete.WithContext(ctx)))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// swapAlias points the alias at to, removing it from from in the same
+// request when from is set.
+func (i *Index) swapAlias(ctx context.Context, from, to string) error {
+	actions := []map[string]any{}
+	if from != "" {
+		actions = append(actions, map[string]any{
+			"remove": map[string]any{"index": from, "alias": IndexName},
+		})
+	}
+	actions = append(actions, map[string]any{
+		"add": map[string]any{"index": to, "alias": IndexName, "is_write_index": true},
+	})
+	body, err := encodeBody(map[string]any{"actions": actions})
+	if err != nil {
+		return err
+	}
+	res, err := checkResponse(i.osClient.Indices.UpdateAliases(body,
+		i.osClient.Indices.UpdateAliases.WithContext(ctx)))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// copyIndex runs a _reindex from one index to another and waits for it.
+// With a non-zero since only pages crawled at or after it are copied.
+// With versioned, documents keep their version and do not replace copies
+// in the destination with a higher one.
+func (i *Index) copyIndex(ctx context.Context, from, to string, since time.Time, versioned bool) error {
+	source := map[string]any{"index": from}
+	if !since.IsZero() {
+		source["query"] = map[string]any{
+			"range": map[string]any{
+				"crawled_at": map[string]any{"gte": since.UTC().Format(time.RFC3339)},
+			},
+		}
+	}
+	dest := map[string]any{"index": to}
+	req := map[string]any{"source": source, "dest": dest}
+	if versioned {
+		dest["version_type"] = "external_gte"
+		req["conflicts"] = "proceed"
+	}
+	body, err := encodeBody(req)
+	if err != nil {
+		return err
+	}
+	res, err := checkResponse(i.osClient.Reindex(body,
+		i.osClient.Reindex.WithContext(ctx),
+		i.osClient.Reindex.WithWaitForCompletion(true),
+		i.osClient.Reindex.WithRefresh(true),
+		i.osClient.Reindex.WithTimeout(time.Hour)))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var parsed struct {
+		Failures []struct {
+			ID    string `json:"id"`
+			Cause struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"cause"`
+		} `json:"failures"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return err
+	}
+	for _, f := range parsed.Failures {
+		if versioned && f.Cause.Type == "version_conflict_engine_exception" {
+			continue
+		}
+		return fmt.Errorf("copying %s failed: %s: %s", f.ID, f.Cause.Type, f.Cause.Reason)
+	}
+	return nil
+}
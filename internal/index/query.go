@@ -0,0 +1,74 @@
+package index
+
+import (
+	"github.com/evok02/jcrawler/internal/query"
+	"strings"
+)
+
+var wildcardEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`)
+
+// compileQuery turns a parsed query into OpenSearch DSL. Text terms score
+// like a plain search does; site: and url: only narrow the hits.
+func compileQuery(n query.Node) map[string]any {
+	switch n := n.(type) {
+	case *query.Term:
+		return compileTerm(n)
+	case *query.Not:
+		return map[string]any{"bool": map[string]any{"must_not": []any{compileQuery(n.Node)}}}
+	case *query.Or:
+		should := make([]any, 0, len(n.Nodes))
+		for _, c := range n.Nodes {
+			should = append(should, compileQuery(c))
+		}
+		return map[string]any{"bool": map[string]any{"should": should, "minimum_should_match": 1}}
+	case *query.And:
+		must, mustNot, filter := []any{}, []any{}, []any{}
+		for _, c := range n.Nodes {
+			switch c := c.(type) {
+			case *query.Not:
+				mustNot = append(mustNot, compileQuery(c.Node))
+			case *query.Term:
+				if c.Field == query.FIELD_SITE || c.Field == query.FIELD_URL {
+					filter = append(filter, compileTerm(c))
+				} else {
+					must = append(must, compileTerm(c))
+				}
+			default:
+				must = append(must, compileQuery(c))
+			}
+		}
+		clauses := map[string]any{}
+		for key, list := range map[string][]any{"must": must, "must_not": mustNot, "filter": filter} {
+			if len(list) > 0 {
+				clauses[key] = list
+			}
+		}
+		return map[string]any{"bool": clauses}
+	}
+	return map[string]any{"match_none": map[string]any{}}
+}
+
+func compileTerm(t *query.Term) map[string]any {
+	switch t.Field {
+	case query.FIELD_SITE:
+		return map[string]any{"term": map[string]any{"domains": t.Text}}
+	case query.FIELD_URL:
+		return map[string]any{"wildcard": map[string]any{"url": map[string]any{
+			"value":            "*" + wildcardEscaper.Replace(t.Text) + "*",
+			"case_insensitive": true,
+		}}}
+	case "":
+		match := map[string]any{"query": t.Text, "fields": SearchFields}
+		if t.Phrase {
+			match["type"] = "phrase"
+		} else {
+			match["type"] = "best_fields"
+			match["tie_breaker"] = 0.3
+		}
+		return map[string]any{"multi_match": match}
+	}
+	if t.Phrase {
+		return map[string]any{"match_phrase": map[string]any{t.Field: t.Text}}
+	}
+	return map[string]any{"match": map[string]any{t.Field: t.Text}}
+}
@@ -0,0 +1,245 @@
+package index
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/query"
+)
+
+const DEFAULT_PAGE_SIZE = 10
+const MAX_PAGE_SIZE = 100
+
+// MAX_RESULT_WINDOW is how deep from/size paging may go, the OpenSearch
+// default for index.max_result_window. Deeper pages need the cursor.
+const MAX_RESULT_WINDOW = 10000
+
+// SNIPPET_SIZE is the length in characters of a highlighted fragment.
+const SNIPPET_SIZE = 160
+
+var ERROR_INVALID_PAGE = errors.New("from and size must be positive and stay within the result window")
+var ERROR_INVALID_CURSOR = errors.New("malformed search cursor")
+
+// SearchRequest asks for one page of results. After is the Next cursor of
+// the previous page and takes precedence over From. Expr is Query after
+// parsing, which Validate does when it is not set yet.
+type SearchRequest struct {
+	Query   string
+	Expr    query.Node
+	From    int
+	Size    int
+	After   string
+	Filters Filters
+}
+
+// Validate parses the query, fills in the default page size and rejects
+// pages outside of the result window. Malformed queries are returned as
+// a *query.Error.
+func (r *SearchRequest) Validate() error {
+	if r.Size == 0 {
+		r.Size = DEFAULT_PAGE_SIZE
+	}
+	if r.From < 0 || r.Size < 0 || r.Size > MAX_PAGE_SIZE || r.From+r.Size > MAX_RESULT_WINDOW {
+		return ERROR_INVALID_PAGE
+	}
+	if r.Expr == nil {
+		expr, err := query.Parse(r.Query)
+		if err != nil {
+			return err
+		}
+		r.Expr = expr
+	}
+	return nil
+}
+
+type Hit struct {
+	db.PageServe
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+type SearchResult struct {
+	Total int64 `json:"total"`
+	// TotalExact is false when Total is only a lower bound.
+	TotalExact bool   `json:"total_exact"`
+	From       int    `json:"from"`
+	Size       int    `json:"size"`
+	Hits       []*Hit `json:"hits"`
+	Next       string `json:"next,omitempty"`
+	// Facets count the matching pages per host, language, content type,
+	// keyword and age, over all hits and not just this page.
+	Facets map[string][]*FacetBucket `json:"facets,omitempty"`
+}
+
+func encodeCursor(sort []any) (string, error) {
+	data, err := json.Marshal(sort)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ERROR_INVALID_CURSOR
+	}
+	var sort []any
+	if err := json.Unmarshal(data, &sort); err != nil || len(sort) != 2 {
+		return nil, ERROR_INVALID_CURSOR
+	}
+	return sort, nil
+}
+
+// matchQuery scores the query with BM25 over SearchFields and scales the
+// result by ln(2 + rank). Ranks have a mean of 1, so an average page gets
+// ln 3; a page that was not ranked yet is stored with rank 0 and gets
+// ln 2, which never zeroes its text score.
+func matchQuery(expr query.Node) map[string]any {
+	return map[string]any{
+		"function_score": map[string]any{
+			"query": compileQuery(expr),
+			"functions": []any{map[string]any{
+				"field_value_factor": map[string]any{
+					"field":    "rank",
+					"modifier": "ln2p",
+					"missing":  1,
+				},
+			}},
+			"boost_mode": "multiply",
+		},
+	}
+}
+
+// filtered wraps a query in the filters of the request. They go into the
+// filter context, so they narrow the hits without changing the scores.
+func filtered(query map[string]any, f *Filters) map[string]any {
+	clauses := f.clauses()
+	if len(clauses) == 0 {
+		return query
+	}
+	return map[string]any{"bool": map[string]any{"must": query, "filter": clauses}}
+}
+
+// searchBody builds the request for one page of results. Hits are sorted
+// by score with the page id as tie breaker, which is what makes the
+// search_after cursor stable.
+func searchBody(req *SearchRequest, query map[string]any) (map[string]any, error) {
+	body := map[string]any{
+		"query":            filtered(query, &req.Filters),
+		"aggs":             aggregations(),
+		"size":             req.Size,
+		"track_total_hits": true,
+		"track_scores":     true,
+		"sort":             []any{map[string]any{"_score": "desc"}, map[string]any{"id": "asc"}},
+		"_source":          []string{"id", "url", "title", "updated_at"},
+		// The html encoder escapes the page text around the tags, so
+		// fragments can be shown as they are.
+		"highlight": map[string]any{
+			"encoder":   "html",
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields": map[string]any{
+				"title":   map[string]any{"number_of_fragments": 0},
+				"anchors": map[string]any{"number_of_fragments": 1, "fragment_size": SNIPPET_SIZE},
+				"content": map[string]any{"number_of_fragments": 3, "fragment_size": SNIPPET_SIZE},
+			},
+		},
+	}
+	if req.After == "" {
+		body["from"] = req.From
+		return body, nil
+	}
+	after, err := decodeCursor(req.After)
+	if err != nil {
+		return nil, err
+	}
+	body["search_after"] = after
+	return body, nil
+}
+
+type searchResponse struct {
+	Hits struct {
+		Total struct {
+			Value    int64  `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		Hits []struct {
+			Score     float64             `json:"_score"`
+			Source    db.PageServe        `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+			Sort      []any               `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]*aggregationResult `json:"aggregations"`
+}
+
+// Search runs a full text query against the alias.
+func (i *Index) Search(ctx context.Context, req *SearchRequest) (*SearchResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return i.search(ctx, req, matchQuery(req.Expr))
+}
+
+func (i *Index) search(ctx context.Context, req *SearchRequest, query map[string]any) (*SearchResult, error) {
+	body, err := searchBody(req, query)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := encodeBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("Search: %s", err.Error())
+	}
+	res, err := checkResponse(i.osClient.Search(
+		i.osClient.Search.WithIndex(IndexName),
+		i.osClient.Search.WithBody(reader),
+		i.osClient.Search.WithContext(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("Search: %w", err)
+	}
+	defer res.Body.Close()
+
+	var parsed searchResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("Search: %s", err.Error())
+	}
+	return parsed.result(req)
+}
+
+func (parsed *searchResponse) result(req *SearchRequest) (*SearchResult, error) {
+	result := &SearchResult{
+		Total:      parsed.Hits.Total.Value,
+		TotalExact: parsed.Hits.Total.Relation == "eq",
+		From:       req.From,
+		Size:       req.Size,
+		Hits:       make([]*Hit, 0, len(parsed.Hits.Hits)),
+	}
+	if len(parsed.Aggregations) > 0 {
+		result.Facets = make(map[string][]*FacetBucket, len(parsed.Aggregations))
+		for name, agg := range parsed.Aggregations {
+			result.Facets[name] = agg.facet()
+		}
+	}
+	if req.After != "" {
+		result.From = 0
+	}
+	for _, h := range parsed.Hits.Hits {
+		result.Hits = append(result.Hits, &Hit{
+			PageServe:  h.Source,
+			Score:      h.Score,
+			Highlights: h.Highlight,
+		})
+	}
+	if n := len(parsed.Hits.Hits); n > 0 && n == req.Size {
+		next, err := encodeCursor(parsed.Hits.Hits[n-1].Sort)
+		if err != nil {
+			return nil, fmt.Errorf("Search: %s", err.Error())
+		}
+		result.Next = next
+	}
+	return result, nil
+}
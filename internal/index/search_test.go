@@ -0,0 +1,146 @@
+package index
+
+import (
+	"context"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/evok02/jcrawler/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchRequestValidate(t *testing.T) {
+	req := &SearchRequest{Query: "go"}
+	require.NoError(t, req.Validate())
+	assert.Equal(t, DEFAULT_PAGE_SIZE, req.Size)
+
+	// Test: pages outside of the result window are rejected
+	for _, bad := range []*SearchRequest{
+		{From: -1},
+		{Size: MAX_PAGE_SIZE + 1},
+		{From: MAX_RESULT_WINDOW, Size: 1},
+	} {
+		assert.ErrorIs(t, bad.Validate(), ERROR_INVALID_PAGE)
+	}
+
+	// Test: malformed queries are rejected with their position
+	req = &SearchRequest{Query: "go OR"}
+	var qerr *query.Error
+	require.ErrorAs(t, req.Validate(), &qerr)
+	assert.Equal(t, 3, qerr.Pos)
+}
+
+func TestSearchBody(t *testing.T) {
+	req := &SearchRequest{Query: "go", From: 20, Size: 10}
+	require.NoError(t, req.Validate())
+	body, err := searchBody(req, matchQuery(req.Expr))
+	require.NoError(t, err)
+	assert.Equal(t, 20, body["from"])
+	assert.NotContains(t, body, "search_after")
+	// Test: highlighted fragments escape the page text
+	assert.Equal(t, "html", body["highlight"].(map[string]any)["encoder"])
+
+	// Test: the rank factor keeps unranked pages above a zero score
+	score := matchQuery(req.Expr)["function_score"].(map[string]any)
+	factor := score["functions"].([]any)[0].(map[string]any)["field_value_factor"].(map[string]any)
+	assert.Equal(t, "ln2p", factor["modifier"])
+	assert.Equal(t, "multiply", score["boost_mode"])
+
+	// Test: a cursor replaces from with search_after
+	cursor, err := encodeCursor([]any{1.5, "abc"})
+	require.NoError(t, err)
+	req.After = cursor
+	body, err = searchBody(req, matchQuery(req.Expr))
+	require.NoError(t, err)
+	assert.Equal(t, []any{1.5, "abc"}, body["search_after"])
+	assert.NotContains(t, body, "from")
+
+	// Test: facets are requested with every search
+	assert.Contains(t, body["aggs"], "keywords")
+	assert.Contains(t, body["aggs"], "updated")
+
+	req.After = "not a cursor"
+	_, err = searchBody(req, matchQuery(req.Expr))
+	assert.ErrorIs(t, err, ERROR_INVALID_CURSOR)
+}
+
+func TestCompileQuery(t *testing.T) {
+	expr, err := query.Parse(`"backend intern" site:example.com -senior title:go`)
+	require.NoError(t, err)
+	clauses := compileQuery(expr)["bool"].(map[string]any)
+
+	// Test: text terms score, site: filters and negations exclude
+	assert.Equal(t, []any{
+		map[string]any{"multi_match": map[string]any{"query": "backend intern", "fields": SearchFields, "type": "phrase"}},
+		map[string]any{"match": map[string]any{"title": "go"}},
+	}, clauses["must"])
+	assert.Equal(t, []any{map[string]any{"term": map[string]any{"domains": "example.com"}}}, clauses["filter"])
+	assert.Len(t, clauses["must_not"], 1)
+
+	// Test: OR needs one of its clauses to match
+	expr, err = query.Parse("go OR rust")
+	require.NoError(t, err)
+	or := compileQuery(expr)["bool"].(map[string]any)
+	assert.Len(t, or["should"], 2)
+	assert.Equal(t, 1, or["minimum_should_match"])
+
+	// Test: wildcard characters in url: are taken literally
+	expr, err = query.Parse("url:a*b")
+	require.NoError(t, err)
+	wildcard := compileQuery(expr)["wildcard"].(map[string]any)["url"].(map[string]any)
+	assert.Equal(t, `*a\*b*`, wildcard["value"])
+}
+
+const testSearchResponse = `{"hits":{"total":{"value":42,"relation":"eq"},"hits":[
+	{"_score":3.5,"_source":{"id":"a","url":"https://a.com","title":"Go"},
+	 "highlight":{"title":["<em>Go</em>"]},"sort":[3.5,"a"]},
+	{"_score":1.25,"_source":{"id":"b","url":"https://b.com","title":"Gophers"},"sort":[1.25,"b"]}]},
+	"aggregations":{"host":{"buckets":[{"key":"a.com","doc_count":30},{"key":"b.com","doc_count":12}]},
+	"updated":{"buckets":[{"key":"day","from":1.7e12,"doc_count":2}]}}}`
+
+func TestSearch(t *testing.T) {
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"2.11.0","distribution":"opensearch"}}`))
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		sent = r.URL.Path + " " + string(data)
+		w.Write([]byte(testSearchResponse))
+	}))
+	defer srv.Close()
+	idx, err := Connect(&config.IndexConfig{Addr: srv.URL})
+	require.NoError(t, err)
+	defer idx.Close()
+
+	res, err := idx.Search(context.Background(), &SearchRequest{Query: "go", Size: 2})
+	require.NoError(t, err)
+	assert.Contains(t, sent, "/"+IndexName+"/_search")
+	assert.Contains(t, sent, `"anchors^3"`)
+
+	// Test: totals, scores and highlights are passed through
+	assert.Equal(t, int64(42), res.Total)
+	assert.True(t, res.TotalExact)
+	require.Len(t, res.Hits, 2)
+	assert.Equal(t, "a", res.Hits[0].ID)
+	assert.Equal(t, 3.5, res.Hits[0].Score)
+	assert.Equal(t, []string{"<em>Go</em>"}, res.Hits[0].Highlights["title"])
+
+	// Test: aggregations come back as facets
+	assert.Equal(t, []*FacetBucket{{"a.com", 30}, {"b.com", 12}}, res.Facets["host"])
+	assert.Equal(t, []*FacetBucket{{"day", 2}}, res.Facets["updated"])
+
+	// Test: a full page links to the next one through the last sort values
+	after, err := decodeCursor(res.Next)
+	require.NoError(t, err)
+	assert.Equal(t, []any{1.25, "b"}, after)
+
+	res, err = idx.Search(context.Background(), &SearchRequest{Query: "go", Size: 3})
+	require.NoError(t, err)
+	assert.Empty(t, res.Next)
+}
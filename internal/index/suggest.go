@@ -0,0 +1,176 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// SUGGEST_SIZE is how many completions a suggestion request returns.
+const SUGGEST_SIZE = 8
+
+// FEW_RESULTS is the hit count below which the input gets a spelling
+// correction.
+const FEW_RESULTS = 5
+
+// MAX_COMPLETION_INPUTS bounds how many word suffixes of a title it can
+// be completed from, so "Go crawler guide" also completes "crawler".
+const MAX_COMPLETION_INPUTS = 4
+
+// Completion is the value of the completion field a title is suggested
+// from. Better linked pages weigh more.
+type Completion struct {
+	Input  []string `json:"input"`
+	Weight int      `json:"weight"`
+}
+
+func titleCompletion(p *db.Page) *Completion {
+	words := strings.Fields(p.Title)
+	if len(words) == 0 {
+		return nil
+	}
+	c := &Completion{Weight: max(int(math.Round(p.Rank*100)), 1)}
+	for i := 0; i < min(len(words), MAX_COMPLETION_INPUTS); i++ {
+		c.Input = append(c.Input, strings.Join(words[i:], " "))
+	}
+	return c
+}
+
+type TitleSuggestion struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// Suggestions answer a partly typed query. Total counts its hits with the
+// last word taken as a prefix, but only up to FEW_RESULTS; Correction is
+// set when that is below FEW_RESULTS and a spelling fix was found.
+type Suggestions struct {
+	Titles     []*TitleSuggestion
+	Total      int64
+	Correction string
+}
+
+// suggestBody asks for title completions, a hit count and spelling
+// suggestions in one round trip, which keeps a request per keystroke
+// cheap.
+func suggestBody(text string, size int) map[string]any {
+	return map[string]any{
+		"size":             0,
+		"track_total_hits": FEW_RESULTS,
+		"query": map[string]any{
+			"multi_match": map[string]any{
+				"query":    text,
+				"fields":   SearchFields,
+				"type":     "bool_prefix",
+				"operator": "and",
+			},
+		},
+		"suggest": map[string]any{
+			"titles": map[string]any{
+				"prefix": text,
+				"completion": map[string]any{
+					"field":           "suggest",
+					"size":            size,
+					"skip_duplicates": true,
+				},
+			},
+			"spelling": map[string]any{
+				"text": text,
+				"term": map[string]any{
+					"field":        "content.std",
+					"suggest_mode": "popular",
+					"size":         1,
+				},
+			},
+		},
+		"_source": []string{"id", "url", "title"},
+	}
+}
+
+type suggestResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Suggest struct {
+		Titles []struct {
+			Options []struct {
+				Source TitleSuggestion `json:"_source"`
+			} `json:"options"`
+		} `json:"titles"`
+		Spelling []termSuggestion `json:"spelling"`
+	} `json:"suggest"`
+}
+
+// termSuggestion is one token of the input. Offset and Length count UTF-16
+// code units, as OpenSearch does.
+type termSuggestion struct {
+	Offset  int          `json:"offset"`
+	Length  int          `json:"length"`
+	Options []termOption `json:"options"`
+}
+
+type termOption struct {
+	Text string `json:"text"`
+}
+
+// Suggest completes a partly typed query from the indexed titles.
+func (i *Index) Suggest(ctx context.Context, text string, size int) (*Suggestions, error) {
+	reader, err := encodeBody(suggestBody(text, size))
+	if err != nil {
+		return nil, fmt.Errorf("Suggest: %s", err.Error())
+	}
+	res, err := checkResponse(i.osClient.Search(
+		i.osClient.Search.WithIndex(IndexName),
+		i.osClient.Search.WithBody(reader),
+		i.osClient.Search.WithContext(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("Suggest: %w", err)
+	}
+	defer res.Body.Close()
+
+	var parsed suggestResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("Suggest: %s", err.Error())
+	}
+	s := &Suggestions{Titles: []*TitleSuggestion{}, Total: parsed.Hits.Total.Value}
+	for _, entry := range parsed.Suggest.Titles {
+		for _, o := range entry.Options {
+			title := o.Source
+			s.Titles = append(s.Titles, &title)
+		}
+	}
+	if s.Total < FEW_RESULTS {
+		s.Correction = correct(text, parsed.Suggest.Spelling)
+	}
+	return s, nil
+}
+
+// correct replaces every token of text that has a suggestion with its best
+// one. It returns "" when nothing was replaced.
+func correct(text string, tokens []termSuggestion) string {
+	units := utf16.Encode([]rune(text))
+	res := []uint16{}
+	prev := 0
+	changed := false
+	for _, t := range tokens {
+		if len(t.Options) == 0 || t.Offset < prev || t.Offset+t.Length > len(units) {
+			continue
+		}
+		res = append(res, units[prev:t.Offset]...)
+		res = append(res, utf16.Encode([]rune(t.Options[0].Text))...)
+		prev = t.Offset + t.Length
+		changed = true
+	}
+	if !changed {
+		return ""
+	}
+	res = append(res, units[prev:]...)
+	return string(utf16.Decode(res))
+}
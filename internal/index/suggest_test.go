@@ -0,0 +1,68 @@
+package index
+
+import (
+	"context"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTitleCompletion(t *testing.T) {
+	c := titleCompletion(&db.Page{Title: "Go crawler guide", Rank: 1.5})
+	assert.Equal(t, []string{"Go crawler guide", "crawler guide", "guide"}, c.Input)
+	assert.Equal(t, 150, c.Weight)
+
+	// Test: unranked pages still get a valid weight
+	assert.Equal(t, 1, titleCompletion(&db.Page{Title: "A"}).Weight)
+	assert.Nil(t, titleCompletion(&db.Page{}))
+}
+
+func TestCorrect(t *testing.T) {
+	tokens := []termSuggestion{
+		{Offset: 0, Length: 7},
+		{Offset: 8, Length: 7, Options: []termOption{{"crawler"}}},
+	}
+	assert.Equal(t, "gophers crawler", correct("gophers crawlre", tokens))
+
+	// Test: nothing to fix gives no correction
+	assert.Empty(t, correct("gophers", tokens[:1]))
+
+	// Test: offsets count UTF-16 units
+	tokens = []termSuggestion{{Offset: 3, Length: 4, Options: []termOption{{"golang"}}}}
+	assert.Equal(t, "😀 golang", correct("😀 goln", tokens))
+}
+
+const testSuggestResponse = `{"hits":{"total":{"value":1,"relation":"eq"},"hits":[]},
+	"suggest":{
+		"titles":[{"text":"go cr","offset":0,"length":5,"options":[
+			{"text":"Go crawler","_id":"a","_source":{"id":"a","url":"https://a.com","title":"Go crawler"}}]}],
+		"spelling":[
+			{"text":"go","offset":0,"length":2,"options":[]},
+			{"text":"cr","offset":3,"length":2,"options":[{"text":"crawler","score":0.5,"freq":3}]}]}}`
+
+func TestSuggest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"2.11.0","distribution":"opensearch"}}`))
+			return
+		}
+		w.Write([]byte(testSuggestResponse))
+	}))
+	defer srv.Close()
+	idx, err := Connect(&config.IndexConfig{Addr: srv.URL})
+	require.NoError(t, err)
+	defer idx.Close()
+
+	s, err := idx.Suggest(context.Background(), "go cr", SUGGEST_SIZE)
+	require.NoError(t, err)
+	assert.Equal(t, []*TitleSuggestion{{ID: "a", URL: "https://a.com", Title: "Go crawler"}}, s.Titles)
+
+	// Test: few hits come with a spelling correction
+	assert.Equal(t, int64(1), s.Total)
+	assert.Equal(t, "go crawler", s.Correction)
+}
@@ -0,0 +1,66 @@
+package lang
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SAMPLE_WORDS is how many words of a text Detect looks at.
+const SAMPLE_WORDS = 2000
+
+// MIN_HITS is how many stop words a text needs before Detect trusts it.
+const MIN_HITS = 5
+
+// stopWords are the most frequent words of every language Detect knows.
+// Words that are common in more than one of them are left out.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for", "was", "on", "are", "this", "be", "have", "from", "or", "by", "not", "which", "you", "they", "we"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "sich", "auf", "für", "ein", "eine", "den", "dem", "von", "zu", "auch", "wird", "sind", "oder", "wir", "ich", "aber"},
+	"fr": {"le", "les", "des", "et", "est", "une", "dans", "pour", "pas", "qui", "que", "sur", "avec", "sont", "au", "du", "mais", "nous", "vous", "ce", "cette", "être", "il"},
+	"es": {"el", "los", "las", "y", "es", "una", "por", "para", "con", "del", "que", "se", "su", "al", "lo", "como", "más", "pero", "sus", "está", "son", "muy", "fue"},
+	"it": {"il", "di", "che", "è", "gli", "della", "per", "una", "sono", "con", "non", "del", "alla", "anche", "come", "questo", "nel", "più", "ma", "dei", "delle", "si", "ha"},
+	"nl": {"de", "het", "een", "en", "van", "dat", "niet", "zijn", "op", "voor", "met", "ook", "maar", "wordt", "bij", "naar", "deze", "kan", "nog", "wij", "heeft", "ze", "ik"},
+	"pt": {"o", "os", "um", "uma", "não", "com", "para", "mais", "por", "dos", "das", "como", "ao", "foi", "são", "seu", "sua", "também", "muito", "já", "pelo", "isso", "nas"},
+}
+
+var index = func() map[string][]string {
+	idx := make(map[string][]string)
+	for lang, words := range stopWords {
+		for _, w := range words {
+			idx[w] = append(idx[w], lang)
+		}
+	}
+	return idx
+}()
+
+// Detect guesses the language of text from its stop words and returns its
+// ISO 639-1 code, or "" when the text is too short or too mixed to tell.
+func Detect(text string) string {
+	hits := make(map[string]int)
+	words := 0
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if words++; words > SAMPLE_WORDS {
+			break
+		}
+		for _, lang := range index[w] {
+			hits[lang]++
+		}
+	}
+
+	best, second := "", 0
+	for lang, n := range hits {
+		switch {
+		case best == "" || n > hits[best] || (n == hits[best] && lang < best):
+			second = max(second, hits[best])
+			best = lang
+		default:
+			second = max(second, n)
+		}
+	}
+	if best == "" || hits[best] < MIN_HITS || hits[best] < 2*second {
+		return ""
+	}
+	return best
+}
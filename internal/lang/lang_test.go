@@ -0,0 +1,18 @@
+package lang
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	// Test: texts with enough stop words are recognized
+	assert.Equal(t, "en", Detect("The crawler fetches pages from the web and stores them in a database, which is then searched by the API."))
+	assert.Equal(t, "de", Detect("Der Crawler lädt Seiten aus dem Netz und speichert sie in einer Datenbank, die von der API durchsucht wird. Das ist nicht schwer."))
+	assert.Equal(t, "fr", Detect("Le robot télécharge les pages du web et les enregistre dans une base qui est ensuite interrogée par l'API pour les recherches."))
+
+	// Test: short and mixed texts are not guessed
+	assert.Equal(t, "", Detect("Go crawler"))
+	assert.Equal(t, "", Detect(""))
+	assert.Equal(t, "", Detect("the and of to is der die und das ist"))
+}
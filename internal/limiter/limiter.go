@@ -0,0 +1,170 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/time/rate"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var ERROR_INVALID_LIMITS = errors.New("rates should not be negative and concurrency should be positive")
+
+type HostLimit struct {
+	Host string  `bson:"host" json:"host"`
+	RPS  float64 `bson:"rps" json:"rps"`
+}
+
+// Limits describes the fetch rate limits. A rate of zero means the
+// corresponding limiter is disabled.
+type Limits struct {
+	GlobalRPS      float64     `bson:"global_rps" json:"global_rps"`
+	HostRPS        float64     `bson:"host_rps" json:"host_rps"`
+	Hosts          []HostLimit `bson:"hosts" json:"hosts"`
+	MaxConcurrency int         `bson:"max_concurrency" json:"max_concurrency"`
+}
+
+func (l *Limits) Validate() error {
+	if l.GlobalRPS < 0 || l.HostRPS < 0 || l.MaxConcurrency <= 0 {
+		return ERROR_INVALID_LIMITS
+	}
+	for _, h := range l.Hosts {
+		if h.RPS < 0 || h.Host == "" {
+			return ERROR_INVALID_LIMITS
+		}
+	}
+	return nil
+}
+
+type Limiter struct {
+	mu      sync.Mutex
+	limits  Limits
+	perHost map[string]float64
+	global  *rate.Limiter
+	hosts   map[string]*rate.Limiter
+	active  int
+	changed chan struct{}
+}
+
+func NewLimiter(limits Limits) (*Limiter, error) {
+	l := &Limiter{
+		global:  rate.NewLimiter(rate.Inf, 0),
+		hosts:   make(map[string]*rate.Limiter),
+		changed: make(chan struct{}),
+	}
+	if err := l.Set(limits); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func toRate(rps float64) (rate.Limit, int) {
+	if rps == 0 {
+		return rate.Inf, 0
+	}
+	return rate.Limit(rps), max(1, int(math.Ceil(rps)))
+}
+
+func (l *Limiter) Limits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limits := l.limits
+	limits.Hosts = slices.Clone(l.limits.Hosts)
+	return limits
+}
+
+func (l *Limiter) hostRPS(host string) float64 {
+	if rps, ok := l.perHost[host]; ok {
+		return rps
+	}
+	return l.limits.HostRPS
+}
+
+// Set replaces the limits. Existing token buckets are adjusted in place,
+// so fetches already waiting pick up the new rate immediately.
+func (l *Limiter) Set(limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	limits.Hosts = slices.Clone(limits.Hosts)
+	perHost := make(map[string]float64, len(limits.Hosts))
+	for i := range limits.Hosts {
+		limits.Hosts[i].Host = strings.ToLower(limits.Hosts[i].Host)
+		perHost[limits.Hosts[i].Host] = limits.Hosts[i].RPS
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.perHost = perHost
+
+	r, burst := toRate(limits.GlobalRPS)
+	l.global.SetBurst(burst)
+	l.global.SetLimit(r)
+	for host, hl := range l.hosts {
+		r, burst := toRate(l.hostRPS(host))
+		hl.SetBurst(burst)
+		hl.SetLimit(r)
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return nil
+}
+
+func (l *Limiter) hostLimiter(host string) *rate.Limiter {
+	host = strings.ToLower(host)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hl, ok := l.hosts[host]
+	if !ok {
+		hl = rate.NewLimiter(toRate(l.hostRPS(host)))
+		l.hosts[host] = hl
+	}
+	return hl
+}
+
+// Wait blocks until both the global and the host bucket allow a request.
+func (l *Limiter) Wait(ctx context.Context, host string) error {
+	if err := l.global.Wait(ctx); err != nil {
+		return err
+	}
+	return l.hostLimiter(host).Wait(ctx)
+}
+
+// Acquire takes one of MaxConcurrency fetch slots, blocking while all of
+// them are in use. Raising the limit wakes blocked callers right away.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.active < l.limits.MaxConcurrency {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *Limiter) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
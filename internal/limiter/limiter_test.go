@@ -0,0 +1,76 @@
+package limiter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSetValidates(t *testing.T) {
+	l, err := NewLimiter(Limits{MaxConcurrency: 1})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, l.Set(Limits{MaxConcurrency: 0}), ERROR_INVALID_LIMITS)
+	assert.ErrorIs(t, l.Set(Limits{GlobalRPS: -1, MaxConcurrency: 1}), ERROR_INVALID_LIMITS)
+	assert.ErrorIs(t, l.Set(Limits{
+		Hosts:          []HostLimit{{Host: "example.com", RPS: -2}},
+		MaxConcurrency: 1,
+	}), ERROR_INVALID_LIMITS)
+
+	require.NoError(t, l.Set(Limits{
+		HostRPS:        1,
+		Hosts:          []HostLimit{{Host: "Example.com", RPS: 5}},
+		MaxConcurrency: 3,
+	}))
+	limits := l.Limits()
+	assert.Equal(t, 3, limits.MaxConcurrency)
+	assert.Equal(t, []HostLimit{{Host: "example.com", RPS: 5}}, limits.Hosts)
+}
+
+func TestAcquireResize(t *testing.T) {
+	l, err := NewLimiter(Limits{MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.NoError(t, l.Acquire(context.Background()))
+
+	// Test: all slots taken
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.Acquire(ctx))
+
+	// Test: raising the limit wakes up a blocked caller
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.Acquire(context.Background())
+	}()
+	require.NoError(t, l.Set(Limits{MaxConcurrency: 2}))
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Acquire was not woken up by Set")
+	}
+	assert.Equal(t, 2, l.Active())
+
+	l.Release()
+	l.Release()
+	assert.Equal(t, 0, l.Active())
+}
+
+func TestWaitHostRate(t *testing.T) {
+	l, err := NewLimiter(Limits{
+		Hosts:          []HostLimit{{Host: "slow.example.com", RPS: 1}},
+		MaxConcurrency: 1,
+	})
+	require.NoError(t, err)
+
+	// Test: the first request uses the burst token, the second one has to wait
+	require.NoError(t, l.Wait(context.Background(), "slow.example.com"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.Wait(ctx, "slow.example.com"))
+
+	// Test: other hosts are not limited
+	require.NoError(t, l.Wait(context.Background(), "fast.example.com"))
+}
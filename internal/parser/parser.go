@@ -7,6 +7,7 @@ import (
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -19,6 +20,12 @@ const (
 	FoundState
 )
 
+const MAX_ANCHOR_TEXT = 256
+
+// MAX_ANCHOR_CONTEXT is how many words on either side of a link are kept
+// as its context.
+const MAX_ANCHOR_CONTEXT = 10
+
 var ERROR_FOUND_TO_UNINIT_KEYWORD = errors.New("trying to set FoundState to unitialized value")
 
 type Matches struct {
@@ -58,24 +65,40 @@ func (m *Matches) InitKeyword(key string) {
 }
 
 type Parser struct {
-	buf        []byte
-	currTitle  string
-	linksFound []*url.URL
-	currAddr   *url.URL
+	buf          []byte
+	currTitle    string
+	currLang     string
+	linksFound   []*url.URL
+	anchorsFound []*Anchor
+	feedsFound   []*url.URL
+	currAddr     *url.URL
 }
 
 func NewParser() *Parser {
 	return &Parser{
-		buf: make([]byte, 4096),
+		buf: make([]byte, 0, 4096),
 	}
 }
 
+// Anchor is a link as it appears on the page: the resolved target, the
+// text it was given and the words around it.
+type Anchor struct {
+	URL     *url.URL
+	Text    string
+	Context string
+}
+
 type ParseResponse struct {
 	Content []byte
 	Links   []*url.URL
+	Anchors []*Anchor
+	Feeds   []*url.URL
 	Title   string
-	Addr    *url.URL
-	mu      *sync.Mutex
+	// Language is the primary subtag of the page's declared language,
+	// such as "en" for <html lang="en-US">.
+	Language string
+	Addr     *url.URL
+	mu       *sync.Mutex
 }
 
 var mu = new(sync.Mutex)
@@ -93,17 +116,26 @@ func (p *Parser) Parse(fres *worker.FetchResponse) (*ParseResponse, error) {
 	defer fres.Response.Body.Close()
 
 	p.findLinks(root)
+	p.findFeeds(root)
 	p.findRawText(root)
 	pres.Links = p.linksFound
+	pres.Anchors = p.anchorsFound
+	pres.Feeds = p.feedsFound
 	pres.Content = append(pres.Content, p.buf...)
 	pres.Title = p.currTitle
+	pres.Language = p.currLang
 	p.currTitle = ""
+	p.currLang = ""
 	p.buf = p.buf[len(p.buf):]
 	return &pres, nil
 }
 
 func (p *Parser) findLinks(root *html.Node) {
 	p.linksFound = []*url.URL{}
+	p.anchorsFound = []*Anchor{}
+	blocks := make(map[*html.Node]map[*html.Node]string)
+	self := *p.currAddr
+	self.Fragment, self.RawFragment = "", ""
 	for node := range root.Descendants() {
 		if node.Type == html.ElementNode && node.DataAtom == atom.A {
 			for _, a := range node.Attr {
@@ -115,17 +147,164 @@ func (p *Parser) findLinks(root *html.Node) {
 					if a.Val == p.currAddr.String() {
 						continue
 					}
-					if a.Val[0] == '/' && len(a.Val) > 1 {
-						p.linksFound = append(p.linksFound, parsed.ResolveReference(p.currAddr))
+					if !parsed.IsAbs() && p.currAddr.IsAbs() {
+						parsed = p.currAddr.ResolveReference(parsed)
+					}
+					// A fragment points into a page, not at another one.
+					parsed.Fragment, parsed.RawFragment = "", ""
+					if parsed.String() == self.String() {
 						continue
 					}
 					p.linksFound = append(p.linksFound, parsed)
+					p.anchorsFound = append(p.anchorsFound, &Anchor{
+						URL:     parsed,
+						Text:    anchorText(node),
+						Context: anchorContext(node, blocks),
+					})
 				}
 			}
 		}
 	}
 }
 
+// anchorText joins the text below an <a> element with single spaces and
+// cuts it at MAX_ANCHOR_TEXT bytes.
+func anchorText(a *html.Node) string {
+	var b strings.Builder
+	for node := range a.Descendants() {
+		if node.Type != html.TextNode {
+			continue
+		}
+		for _, word := range strings.Fields(node.Data) {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(word)
+		}
+		if b.Len() >= MAX_ANCHOR_TEXT {
+			break
+		}
+	}
+	text := b.String()
+	if len(text) > MAX_ANCHOR_TEXT {
+		text = strings.ToValidUTF8(text[:MAX_ANCHOR_TEXT], "")
+	}
+	return text
+}
+
+// anchorContext returns the words of the block a link sits in that come
+// right before and after it, without the link text itself. The contexts
+// of all links in a block are found in one walk and kept in blocks, so a
+// block with many links is not walked once per link.
+func anchorContext(a *html.Node, blocks map[*html.Node]map[*html.Node]string) string {
+	block := a.Parent
+	for block != nil && !isBlock(block) {
+		block = block.Parent
+	}
+	if block == nil {
+		return ""
+	}
+	contexts, ok := blocks[block]
+	if !ok {
+		contexts = blockContexts(block)
+		blocks[block] = contexts
+	}
+	return contexts[a]
+}
+
+// blockContexts collects the words of a block and where the text of each
+// link in it starts and ends, then cuts the context of every link from
+// them.
+func blockContexts(block *html.Node) map[*html.Node]string {
+	type span struct{ start, end int }
+	words := []string{}
+	spans := make(map[*html.Node]span)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style):
+			return
+		case n.Type == html.TextNode:
+			words = append(words, strings.Fields(n.Data)...)
+		}
+		start := len(words)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			spans[n] = span{start, len(words)}
+		}
+	}
+	walk(block)
+
+	contexts := make(map[*html.Node]string, len(spans))
+	for a, s := range spans {
+		before := words[max(s.start-MAX_ANCHOR_CONTEXT, 0):s.start]
+		after := words[s.end:min(s.end+MAX_ANCHOR_CONTEXT, len(words))]
+		contexts[a] = strings.Join(append(slices.Clip(before), after...), " ")
+	}
+	return contexts
+}
+
+func isBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.P, atom.Li, atom.Td, atom.Th, atom.Dd, atom.Dt, atom.Blockquote, atom.Figcaption,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Div, atom.Section, atom.Article, atom.Nav, atom.Header, atom.Footer, atom.Body:
+		return true
+	}
+	return false
+}
+
+func declaredLanguage(n *html.Node) string {
+	for _, a := range n.Attr {
+		if a.Key == "lang" {
+			tag, _, _ := strings.Cut(strings.TrimSpace(a.Val), "-")
+			return strings.ToLower(tag)
+		}
+	}
+	return ""
+}
+
+func isFeedType(t string) bool {
+	switch strings.ToLower(strings.TrimSpace(t)) {
+	case "application/rss+xml", "application/atom+xml", "application/rdf+xml":
+		return true
+	}
+	return false
+}
+
+func (p *Parser) findFeeds(root *html.Node) {
+	p.feedsFound = []*url.URL{}
+	for node := range root.Descendants() {
+		if node.Type != html.ElementNode || node.DataAtom != atom.Link {
+			continue
+		}
+		var rel, typ, href string
+		for _, a := range node.Attr {
+			switch a.Key {
+			case "rel":
+				rel = strings.ToLower(a.Val)
+			case "type":
+				typ = a.Val
+			case "href":
+				href = strings.TrimSpace(a.Val)
+			}
+		}
+		if href == "" || !slices.Contains(strings.Fields(rel), "alternate") || !isFeedType(typ) {
+			continue
+		}
+		parsed, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		p.feedsFound = append(p.feedsFound, p.currAddr.ResolveReference(parsed))
+	}
+}
+
 func (p *Parser) findRawText(n *html.Node) {
 	var traverse func(n *html.Node)
 	traverse = func(n *html.Node) {
@@ -142,6 +321,9 @@ func (p *Parser) findRawText(n *html.Node) {
 			if n.Data == "title" && n.FirstChild != nil {
 				p.currTitle = n.FirstChild.Data
 			}
+			if n.DataAtom == atom.Html {
+				p.currLang = declaredLanguage(n)
+			}
 		}
 		for e := n.FirstChild; e != nil; e = e.NextSibling {
 			traverse(e)
@@ -46,6 +46,126 @@ func TestFindLinks(t *testing.T) {
 	assert.Equal(t, 0, len(parser.linksFound))
 }
 
+func TestFindAnchors(t *testing.T) {
+	page := "<html><body>" +
+		"<a href=\"about.html\">About   <b>us</b></a>" +
+		"<a href=\"/blog/\"><img src=\"logo.png\"></a>" +
+		"<a href=\"https://other.org/x\">\n\tOther\n</a>" +
+		"</body></html>"
+	parser := NewParser()
+	addr, err := url.Parse("https://example.com/docs/index.html")
+	require.NoError(t, err)
+	parser.currAddr = addr
+
+	root, err := html.Parse(strings.NewReader(page))
+	require.NoError(t, err)
+	parser.findLinks(root)
+
+	// Test: relative links are resolved against the page
+	require.Len(t, parser.anchorsFound, 3)
+	assert.Equal(t, "https://example.com/docs/about.html", parser.anchorsFound[0].URL.String())
+	assert.Equal(t, "https://example.com/blog/", parser.anchorsFound[1].URL.String())
+	assert.Equal(t, "https://other.org/x", parser.anchorsFound[2].URL.String())
+
+	// Test: anchor text is collapsed, and empty for image links
+	assert.Equal(t, "About us", parser.anchorsFound[0].Text)
+	assert.Equal(t, "", parser.anchorsFound[1].Text)
+	assert.Equal(t, "Other", parser.anchorsFound[2].Text)
+	assert.Len(t, parser.linksFound, 3)
+}
+
+func TestFindLinksFragments(t *testing.T) {
+	page := "<html><body>" +
+		"<a href=\"#top\">top</a>" +
+		"<a href=\"index.html#usage\">usage</a>" +
+		"<a href=\"about.html#team\">team</a>" +
+		"<a href=\"https://other.org/x#y\">other</a>" +
+		"</body></html>"
+	parser := NewParser()
+	addr, err := url.Parse("https://example.com/docs/index.html")
+	require.NoError(t, err)
+	parser.currAddr = addr
+
+	root, err := html.Parse(strings.NewReader(page))
+	require.NoError(t, err)
+	parser.findLinks(root)
+
+	// Test: fragments are dropped and links back to the page are skipped
+	require.Len(t, parser.linksFound, 2)
+	assert.Equal(t, "https://example.com/docs/about.html", parser.linksFound[0].String())
+	assert.Equal(t, "https://other.org/x", parser.linksFound[1].String())
+}
+
+func TestAnchorContext(t *testing.T) {
+	page := "<html><body>" +
+		"<p>Read the <a href=\"/guide\">install guide</a> before <b>you</b> start.</p>" +
+		"<ul><li><a href=\"/a\">alone</a></li></ul>" +
+		"<p>one two three four five six seven eight nine ten eleven <a href=\"/b\">x</a></p>" +
+		"</body></html>"
+	parser := NewParser()
+	addr, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+	parser.currAddr = addr
+
+	root, err := html.Parse(strings.NewReader(page))
+	require.NoError(t, err)
+	parser.findLinks(root)
+	require.Len(t, parser.anchorsFound, 3)
+
+	// Test: the context is the rest of the enclosing block
+	assert.Equal(t, "install guide", parser.anchorsFound[0].Text)
+	assert.Equal(t, "Read the before you start.", parser.anchorsFound[0].Context)
+	assert.Equal(t, "", parser.anchorsFound[1].Context)
+
+	// Test: only the closest words are kept
+	assert.Equal(t, "two three four five six seven eight nine ten eleven", parser.anchorsFound[2].Context)
+
+	// Test: links sharing a block see each other's text as context
+	root, err = html.Parse(strings.NewReader("<html><body><p>" +
+		"see <a href=\"/1\">one</a> and <i><a href=\"/2\">two</a></i><script>skip()</script> then <a href=\"/3\">three</a>" +
+		"</p></body></html>"))
+	require.NoError(t, err)
+	parser.findLinks(root)
+	require.Len(t, parser.anchorsFound, 3)
+	assert.Equal(t, "see and two then three", parser.anchorsFound[0].Context)
+	assert.Equal(t, "see one and then three", parser.anchorsFound[1].Context)
+	assert.Equal(t, "see one and two then", parser.anchorsFound[2].Context)
+}
+
+func TestDeclaredLanguage(t *testing.T) {
+	parser := NewParser()
+	root, err := html.Parse(strings.NewReader(`<html lang="en-US"><body><p>hi</p></body></html>`))
+	require.NoError(t, err)
+	parser.findRawText(root)
+	assert.Equal(t, "en", parser.currLang)
+
+	root, err = html.Parse(strings.NewReader(`<html><body><p>hi</p></body></html>`))
+	require.NoError(t, err)
+	parser.currLang = ""
+	parser.findRawText(root)
+	assert.Equal(t, "", parser.currLang)
+}
+
+func TestFindFeeds(t *testing.T) {
+	feedHtml := "<html><head>" +
+		"<link rel=\"alternate\" type=\"application/rss+xml\" href=\"/feed.xml\">" +
+		"<link rel=\"Alternate\" type=\"application/atom+xml\" href=\"https://blog.example.com/atom\">" +
+		"<link rel=\"stylesheet\" type=\"text/css\" href=\"/style.css\">" +
+		"<link rel=\"alternate\" hreflang=\"de\" href=\"/de/\">" +
+		"</head><body></body></html>"
+	parser := NewParser()
+	addr, err := url.Parse("https://example.com/posts/1")
+	require.NoError(t, err)
+	parser.currAddr = addr
+
+	root, err := html.Parse(strings.NewReader(feedHtml))
+	require.NoError(t, err)
+	parser.findFeeds(root)
+	require.Equal(t, 2, len(parser.feedsFound))
+	assert.Equal(t, "https://example.com/feed.xml", parser.feedsFound[0].String())
+	assert.Equal(t, "https://blog.example.com/atom", parser.feedsFound[1].String())
+}
+
 func TestKeywordsFound(t *testing.T) {
 	noKeywordsHtml := "<div class=\"section\"><ul><li><a href=\"\"></li></ul></div>"
 	nestedDivHtml := "<div><div>Go</div><div>Intern</div><div><p>Backend</p></div></div>"
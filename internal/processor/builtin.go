@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ERROR_INVALID_OPTION = errors.New("invalid processor option")
+
+func init() {
+	Register("min_length", newMinLength)
+	Register("keywords", newKeywords)
+}
+
+func intOption(options map[string]any, key string, def int) (int, error) {
+	v, ok := options[key]
+	if !ok {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ERROR_INVALID_OPTION, key)
+}
+
+// minLength drops pages with less than the configured number of words,
+// which are mostly redirects, error pages and empty shells.
+type minLength struct {
+	words int
+}
+
+func newMinLength(options map[string]any) (Processor, error) {
+	words, err := intOption(options, "words", 20)
+	if err != nil {
+		return nil, err
+	}
+	return &minLength{words: words}, nil
+}
+
+func (m *minLength) Name() string {
+	return "min_length"
+}
+
+func (m *minLength) Process(ctx context.Context, doc *Document) error {
+	if len(strings.Fields(doc.Content)) < m.words {
+		return ERROR_DROP_DOCUMENT
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/parser"
+	"strings"
+	"unicode"
+)
+
+func stringsOption(options map[string]any, key string) ([]string, error) {
+	v, ok := options[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ERROR_INVALID_OPTION, key)
+	}
+	res := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("%w: %s", ERROR_INVALID_OPTION, key)
+		}
+		res = append(res, strings.TrimSpace(s))
+	}
+	return res, nil
+}
+
+// keywords tags documents with the configured keywords that occur in the
+// title or content. Keywords match whole words, case insensitively, and a
+// keyword of several words has to occur as that exact sequence.
+type keywords struct {
+	words []string
+}
+
+func newKeywords(options map[string]any) (Processor, error) {
+	words, err := stringsOption(options, "keywords")
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%w: keywords", ERROR_INVALID_OPTION)
+	}
+	return &keywords{words: words}, nil
+}
+
+func (k *keywords) Name() string {
+	return "keywords"
+}
+
+func (k *keywords) Process(ctx context.Context, doc *Document) error {
+	tokens := strings.FieldsFunc(strings.ToLower(doc.Title+" "+doc.Content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	text := " " + strings.Join(tokens, " ") + " "
+
+	matches := parser.NewMatches()
+	matches.InitKeywords(k.words)
+	for _, token := range tokens {
+		if _, ok := matches.Get(token); ok {
+			matches.SetFound(token)
+		}
+	}
+	for _, word := range k.words {
+		if strings.Contains(word, " ") && strings.Contains(text, " "+strings.ToLower(word)+" ") {
+			matches.SetFound(word)
+		}
+	}
+
+	for _, word := range k.words {
+		if state, _ := matches.Get(word); state == parser.FoundState {
+			doc.Keywords = append(doc.Keywords, strings.ToLower(word))
+		}
+	}
+	return nil
+}
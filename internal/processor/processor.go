@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/config"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ERROR_DROP_DOCUMENT = errors.New("document dropped by processor")
+var ERROR_UNKNOWN_PROCESSOR = errors.New("unknown processor")
+var ERROR_PROCESSOR_PANIC = errors.New("processor panicked")
+
+// Document is the view of a fetched and parsed page that processors work
+// on. Processors enrich it by changing Title, Content, Language, Keywords
+// or Fields, and emit extra links by appending to Links.
+type Document struct {
+	URL      *url.URL
+	Status   int
+	Header   http.Header
+	Title    string
+	Content  string
+	Language string
+	Keywords []string
+	Links    []*url.URL
+	Fields   map[string]any
+}
+
+func (d *Document) clone() *Document {
+	c := *d
+	c.Header = d.Header.Clone()
+	c.Links = slices.Clone(d.Links)
+	c.Keywords = slices.Clone(d.Keywords)
+	c.Fields = maps.Clone(d.Fields)
+	if c.Fields == nil {
+		c.Fields = make(map[string]any)
+	}
+	return &c
+}
+
+// Processor is a custom pipeline step. Returning ERROR_DROP_DOCUMENT
+// drops the document; any other error discards the processor's changes
+// and the document continues to the next step.
+type Processor interface {
+	Name() string
+	Process(ctx context.Context, doc *Document) error
+}
+
+type Factory func(options map[string]any) (Processor, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a processor available under name for the
+// pipeline.processors config list. It is meant to be called from init.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = f
+}
+
+func New(name string, options map[string]any) (Processor, error) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("New: %w: %s", ERROR_UNKNOWN_PROCESSOR, name)
+	}
+	return f(options)
+}
+
+type Stats struct {
+	Name      string        `json:"name"`
+	Processed int64         `json:"processed"`
+	Dropped   int64         `json:"dropped"`
+	Failed    int64         `json:"failed"`
+	Duration  time.Duration `json:"duration"`
+}
+
+type step struct {
+	proc      Processor
+	processed atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+	nanos     atomic.Int64
+}
+
+func (s *step) run(ctx context.Context, doc *Document) (res *Document, err error) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ERROR_PROCESSOR_PANIC, r)
+		}
+		s.nanos.Add(int64(time.Since(start)))
+		switch {
+		case err == nil:
+			s.processed.Add(1)
+		case errors.Is(err, ERROR_DROP_DOCUMENT):
+			s.dropped.Add(1)
+		default:
+			s.failed.Add(1)
+		}
+	}()
+
+	c := doc.clone()
+	if err := s.proc.Process(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type Chain struct {
+	steps []*step
+}
+
+func NewChain(cfgs []config.ProcessorConfig) (*Chain, error) {
+	c := &Chain{}
+	for _, cfg := range cfgs {
+		proc, err := New(cfg.Name, cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("NewChain: %s", err.Error())
+		}
+		c.steps = append(c.steps, &step{proc: proc})
+	}
+	return c, nil
+}
+
+// Run passes doc through every processor in order. It returns the
+// resulting document, or nil if a processor dropped it, together with the
+// errors of processors that failed and were skipped.
+func (c *Chain) Run(ctx context.Context, doc *Document) (*Document, error) {
+	var errs []error
+	for _, s := range c.steps {
+		res, err := s.run(ctx, doc)
+		if errors.Is(err, ERROR_DROP_DOCUMENT) {
+			return nil, errors.Join(errs...)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.proc.Name(), err))
+			continue
+		}
+		doc = res
+	}
+	return doc, errors.Join(errs...)
+}
+
+func (c *Chain) Stats() []Stats {
+	stats := make([]Stats, 0, len(c.steps))
+	for _, s := range c.steps {
+		stats = append(stats, Stats{
+			Name:      s.proc.Name(),
+			Processed: s.processed.Load(),
+			Dropped:   s.dropped.Load(),
+			Failed:    s.failed.Load(),
+			Duration:  time.Duration(s.nanos.Load()),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"github.com/evok02/jcrawler/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+type funcProcessor struct {
+	name string
+	fn   func(doc *Document) error
+}
+
+func (f *funcProcessor) Name() string {
+	return f.name
+}
+
+func (f *funcProcessor) Process(ctx context.Context, doc *Document) error {
+	return f.fn(doc)
+}
+
+func register(name string, fn func(doc *Document) error) {
+	Register(name, func(map[string]any) (Processor, error) {
+		return &funcProcessor{name: name, fn: fn}, nil
+	})
+}
+
+func TestChain(t *testing.T) {
+	extra, err := url.Parse("https://example.com/extra")
+	require.NoError(t, err)
+	register("test_enrich", func(doc *Document) error {
+		doc.Fields["lang"] = "en"
+		doc.Links = append(doc.Links, extra)
+		return nil
+	})
+	register("test_fail", func(doc *Document) error {
+		doc.Title = "changed"
+		return errors.New("boom")
+	})
+	register("test_panic", func(doc *Document) error {
+		panic("boom")
+	})
+
+	chain, err := NewChain([]config.ProcessorConfig{
+		{Name: "test_fail"},
+		{Name: "test_panic"},
+		{Name: "test_enrich"},
+	})
+	require.NoError(t, err)
+
+	res, err := chain.Run(context.Background(), &Document{Title: "title"})
+	require.Error(t, err)
+	require.NotNil(t, res)
+
+	// Test: changes of failing processors are discarded
+	assert.Equal(t, "title", res.Title)
+	assert.Equal(t, "en", res.Fields["lang"])
+	assert.Equal(t, 1, len(res.Links))
+
+	stats := chain.Stats()
+	require.Equal(t, 3, len(stats))
+	assert.Equal(t, int64(1), stats[0].Failed)
+	assert.Equal(t, int64(1), stats[1].Failed)
+	assert.Equal(t, int64(1), stats[2].Processed)
+}
+
+func TestChainDrop(t *testing.T) {
+	chain, err := NewChain([]config.ProcessorConfig{
+		{Name: "min_length", Options: map[string]any{"words": 3}},
+	})
+	require.NoError(t, err)
+
+	res, err := chain.Run(context.Background(), &Document{Content: "too short"})
+	require.NoError(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, int64(1), chain.Stats()[0].Dropped)
+
+	res, err = chain.Run(context.Background(), &Document{Content: "long enough content"})
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+}
+
+func TestUnknownProcessor(t *testing.T) {
+	_, err := NewChain([]config.ProcessorConfig{{Name: "does_not_exist"}})
+	assert.ErrorContains(t, err, ERROR_UNKNOWN_PROCESSOR.Error())
+}
+
+func TestKeywords(t *testing.T) {
+	chain, err := NewChain([]config.ProcessorConfig{
+		{Name: "keywords", Options: map[string]any{"keywords": []any{"Go", "backend intern", "rust"}}},
+	})
+	require.NoError(t, err)
+
+	// Test: words match whole and case insensitively, phrases in sequence
+	res, err := chain.Run(context.Background(), &Document{
+		Title:   "Backend Intern",
+		Content: "We write go, not golang. No trust issues.",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "backend intern"}, res.Keywords)
+
+	// Test: a keyword list is required
+	_, err = NewChain([]config.ProcessorConfig{{Name: "keywords"}})
+	assert.ErrorContains(t, err, ERROR_INVALID_OPTION.Error())
+}
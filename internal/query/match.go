@@ -0,0 +1,124 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Doc is what Match evaluates a query against.
+type Doc struct {
+	Title   string
+	Content string
+	URL     string
+	Host    string
+	Anchors []string
+}
+
+// Match evaluates a query on one page, for backends without a search
+// index. Words are compared case-insensitively and whole, without the
+// stemming an index analyzer applies.
+func Match(n Node, d *Doc) bool {
+	m := &matcher{doc: d, tokens: make(map[string][]string)}
+	return m.match(n)
+}
+
+type matcher struct {
+	doc    *Doc
+	tokens map[string][]string
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// fieldTokens tokenizes a text field once per Match call.
+func (m *matcher) fieldTokens(field string) []string {
+	if tokens, ok := m.tokens[field]; ok {
+		return tokens
+	}
+	var tokens []string
+	switch field {
+	case FIELD_TITLE:
+		tokens = tokenize(m.doc.Title)
+	case FIELD_CONTENT:
+		tokens = tokenize(m.doc.Content)
+	case FIELD_ANCHORS:
+		// Anchors are joined with a break that no phrase can span.
+		for i, a := range m.doc.Anchors {
+			if i > 0 {
+				tokens = append(tokens, "")
+			}
+			tokens = append(tokens, tokenize(a)...)
+		}
+	}
+	m.tokens[field] = tokens
+	return tokens
+}
+
+func (m *matcher) match(n Node) bool {
+	switch n := n.(type) {
+	case *Term:
+		return m.matchTerm(n)
+	case *Not:
+		return !m.match(n.Node)
+	case *And:
+		for _, c := range n.Nodes {
+			if !m.match(c) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, c := range n.Nodes {
+			if m.match(c) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func (m *matcher) matchTerm(t *Term) bool {
+	switch t.Field {
+	case FIELD_SITE:
+		host := strings.ToLower(m.doc.Host)
+		return host == t.Text || strings.HasSuffix(host, "."+t.Text)
+	case FIELD_URL:
+		return strings.Contains(strings.ToLower(m.doc.URL), strings.ToLower(t.Text))
+	case "":
+		for _, field := range []string{FIELD_TITLE, FIELD_CONTENT, FIELD_ANCHORS} {
+			if m.matchText(field, t.Text) {
+				return true
+			}
+		}
+		return false
+	}
+	return m.matchText(t.Field, t.Text)
+}
+
+// matchText looks for the words of text as a sequence in a field. A single
+// word is a sequence of one, and a word the tokenizer splits, like
+// node.js, has to match as a phrase.
+func (m *matcher) matchText(field, text string) bool {
+	words := tokenize(text)
+	if len(words) == 0 {
+		return false
+	}
+	tokens := m.fieldTokens(field)
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		found := true
+		for j, w := range words {
+			if tokens[i+j] != w {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,442 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MAX_QUERY_LENGTH caps the input, so a query cannot nest deep enough to
+// exhaust the parser's stack.
+const MAX_QUERY_LENGTH = 1024
+
+var ERROR_EMPTY_QUERY = errors.New("query is empty")
+var ERROR_QUERY_TOO_LONG = errors.New("query is too long")
+var ERROR_UNTERMINATED_PHRASE = errors.New("phrase is missing its closing quote")
+var ERROR_UNBALANCED_PAREN = errors.New("parenthesis is not balanced")
+var ERROR_MISSING_OPERAND = errors.New("operator is missing an operand")
+var ERROR_UNKNOWN_FIELD = errors.New("unknown field")
+var ERROR_MISSING_VALUE = errors.New("field is missing a value")
+var ERROR_ONLY_NEGATIONS = errors.New("query needs at least one term that is not negated")
+
+// Fields that may prefix a term. A term without a field searches the
+// text fields of a page.
+const (
+	FIELD_TITLE   = "title"
+	FIELD_CONTENT = "content"
+	FIELD_ANCHORS = "anchors"
+	FIELD_URL     = "url"
+	FIELD_SITE    = "site"
+)
+
+var fields = map[string]bool{
+	FIELD_TITLE:   true,
+	FIELD_CONTENT: true,
+	FIELD_ANCHORS: true,
+	FIELD_URL:     true,
+	FIELD_SITE:    true,
+}
+
+// Node is an element of a parsed query: a Term, or an And, Or or Not of
+// other nodes.
+type Node interface {
+	node()
+}
+
+// Term is a word, or a quoted phrase, optionally limited to one field.
+type Term struct {
+	Field  string
+	Text   string
+	Phrase bool
+}
+
+type And struct {
+	Nodes []Node
+}
+
+type Or struct {
+	Nodes []Node
+}
+
+type Not struct {
+	Node Node
+}
+
+func (*Term) node() {}
+func (*And) node()  {}
+func (*Or) node()   {}
+func (*Not) node()  {}
+
+// Error is a malformed query. Pos is the byte offset in the query the
+// problem was found at.
+type Error struct {
+	Pos int
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Message  string `json:"message"`
+		Position int    `json:"position"`
+	}{e.Err.Error(), e.Pos})
+}
+
+type parser struct {
+	in  string
+	pos int
+}
+
+// Parse reads a search query. Terms next to each other must all match and
+// OR lets either side match; it binds looser, so `a b OR c` is
+// `(a AND b) OR c`. A leading - or NOT excludes a term, double quotes make
+// a phrase, parentheses group, and field:value limits a term to a field.
+func Parse(in string) (Node, error) {
+	if len(in) > MAX_QUERY_LENGTH {
+		return nil, &Error{Pos: MAX_QUERY_LENGTH, Err: ERROR_QUERY_TOO_LONG}
+	}
+	p := &parser{in: in}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.in) {
+		// parseOr only stops early at a closing parenthesis.
+		return nil, &Error{Pos: p.pos, Err: ERROR_UNBALANCED_PAREN}
+	}
+	if n == nil {
+		return nil, &Error{Pos: 0, Err: ERROR_EMPTY_QUERY}
+	}
+	if !positive(n) {
+		return nil, &Error{Pos: 0, Err: ERROR_ONLY_NEGATIONS}
+	}
+	return n, nil
+}
+
+// positive reports whether a node needs something to match, as opposed to
+// only ruling things out. Only such queries can be answered from an
+// inverted index.
+func positive(n Node) bool {
+	switch n := n.(type) {
+	case *Term:
+		return true
+	case *Not:
+		return false
+	case *And:
+		for _, c := range n.Nodes {
+			if positive(c) {
+				return true
+			}
+		}
+		return false
+	case *Or:
+		for _, c := range n.Nodes {
+			if !positive(c) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.in) {
+		r, size := utf8.DecodeRuneInString(p.in[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+// spaceAt reports whether the rune starting at byte i is a space. The
+// input is decoded, as bytes inside a UTF-8 sequence like the 0xA0 of "à"
+// would read as spaces on their own.
+func (p *parser) spaceAt(i int) bool {
+	r, _ := utf8.DecodeRuneInString(p.in[i:])
+	return unicode.IsSpace(r)
+}
+
+// keyword reports whether the operator kw is next in the input. Operators
+// are upper case only, so "and" and "or" are still searchable.
+func (p *parser) keyword(kw string) bool {
+	if !strings.HasPrefix(p.in[p.pos:], kw) {
+		return false
+	}
+	end := p.pos + len(kw)
+	return end == len(p.in) || p.spaceAt(end) || p.in[end] == '(' || p.in[end] == '"'
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{}
+	if left != nil {
+		nodes = append(nodes, left)
+	}
+	for {
+		p.skipSpace()
+		if !p.keyword("OR") {
+			break
+		}
+		if left == nil {
+			return nil, &Error{Pos: p.pos, Err: ERROR_MISSING_OPERAND}
+		}
+		opPos := p.pos
+		p.pos += len("OR")
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if right == nil {
+			return nil, &Error{Pos: opPos, Err: ERROR_MISSING_OPERAND}
+		}
+		nodes = append(nodes, right)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	}
+	return &Or{Nodes: flatten(nodes, func(n Node) []Node {
+		if or, ok := n.(*Or); ok {
+			return or.Nodes
+		}
+		return nil
+	})}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	nodes := []Node{}
+	for {
+		p.skipSpace()
+		if p.pos == len(p.in) || p.in[p.pos] == ')' || p.keyword("OR") {
+			break
+		}
+		opPos := p.pos
+		if p.keyword("AND") {
+			if len(nodes) == 0 {
+				return nil, &Error{Pos: p.pos, Err: ERROR_MISSING_OPERAND}
+			}
+			p.pos += len("AND")
+			p.skipSpace()
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			return nil, &Error{Pos: opPos, Err: ERROR_MISSING_OPERAND}
+		}
+		nodes = append(nodes, n)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	}
+	return &And{Nodes: flatten(nodes, func(n Node) []Node {
+		if and, ok := n.(*And); ok {
+			return and.Nodes
+		}
+		return nil
+	})}, nil
+}
+
+func flatten(nodes []Node, children func(Node) []Node) []Node {
+	res := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if c := children(n); c != nil {
+			res = append(res, c...)
+		} else {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// parseUnary reads one operand, with a leading - or NOT. It returns nil at
+// the end of the input, a closing parenthesis or an operator.
+func (p *parser) parseUnary() (Node, error) {
+	p.skipSpace()
+	if p.pos == len(p.in) || p.in[p.pos] == ')' || p.keyword("OR") || p.keyword("AND") {
+		return nil, nil
+	}
+	negPos := p.pos
+	negated := false
+	if p.keyword("NOT") {
+		p.pos += len("NOT")
+		negated = true
+	} else if p.in[p.pos] == '-' && p.pos+1 < len(p.in) && !p.spaceAt(p.pos+1) {
+		p.pos++
+		negated = true
+	}
+	if negated {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			return nil, &Error{Pos: negPos, Err: ERROR_MISSING_OPERAND}
+		}
+		return &Not{Node: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	start := p.pos
+	switch p.in[p.pos] {
+	case '(':
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.in) || p.in[p.pos] != ')' {
+			return nil, &Error{Pos: start, Err: ERROR_UNBALANCED_PAREN}
+		}
+		p.pos++
+		if n == nil {
+			return nil, &Error{Pos: start, Err: ERROR_EMPTY_QUERY}
+		}
+		return n, nil
+	case '"':
+		return p.parsePhrase("")
+	}
+
+	word := p.word()
+	field, value, found := strings.Cut(word, ":")
+	if !found || !isFieldName(field) || strings.HasPrefix(value, "//") {
+		return &Term{Text: word}, nil
+	}
+	field = strings.ToLower(field)
+	if !fields[field] {
+		return nil, &Error{Pos: start, Err: fmt.Errorf("%w %q", ERROR_UNKNOWN_FIELD, field)}
+	}
+	if value == "" {
+		if p.pos < len(p.in) && p.in[p.pos] == '"' {
+			return p.parsePhrase(field)
+		}
+		return nil, &Error{Pos: start, Err: ERROR_MISSING_VALUE}
+	}
+	if field == FIELD_SITE {
+		value = strings.ToLower(strings.TrimSuffix(value, "."))
+	}
+	return &Term{Field: field, Text: value}, nil
+}
+
+func (p *parser) parsePhrase(field string) (Node, error) {
+	start := p.pos
+	end := strings.IndexByte(p.in[start+1:], '"')
+	if end < 0 {
+		return nil, &Error{Pos: start, Err: ERROR_UNTERMINATED_PHRASE}
+	}
+	text := strings.TrimSpace(p.in[start+1 : start+1+end])
+	p.pos = start + end + 2
+	if text == "" {
+		return nil, &Error{Pos: start, Err: ERROR_EMPTY_QUERY}
+	}
+	return &Term{Field: field, Text: text, Phrase: true}, nil
+}
+
+// word reads up to the next space, parenthesis or quote.
+func (p *parser) word() string {
+	start := p.pos
+	for p.pos < len(p.in) {
+		r, size := utf8.DecodeRuneInString(p.in[p.pos:])
+		if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+			break
+		}
+		p.pos += size
+	}
+	return p.in[start:p.pos]
+}
+
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Terms lists the text of every term that is not negated, for backends
+// that look up candidates by the words of their title and content and
+// then match the query on them. It returns nil when a page could match
+// without containing any of them, like for `site:example.com`, and every
+// page is a candidate.
+func Terms(n Node) []string {
+	if !needsText(n) {
+		return nil
+	}
+	terms := []string{}
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *Term:
+			if isText(n) {
+				terms = append(terms, n.Text)
+			}
+		case *And:
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *Or:
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return terms
+}
+
+func isText(t *Term) bool {
+	return t.Field == "" || t.Field == FIELD_TITLE || t.Field == FIELD_CONTENT
+}
+
+// needsText reports whether every page a node matches contains one of its
+// text terms.
+func needsText(n Node) bool {
+	switch n := n.(type) {
+	case *Term:
+		return isText(n)
+	case *And:
+		for _, c := range n.Nodes {
+			if needsText(c) {
+				return true
+			}
+		}
+		return false
+	case *Or:
+		for _, c := range n.Nodes {
+			if !needsText(c) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
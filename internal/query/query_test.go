@@ -0,0 +1,125 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	n, err := Parse(`"backend intern" site:Example.com -senior title:go`)
+	require.NoError(t, err)
+	assert.Equal(t, &And{Nodes: []Node{
+		&Term{Text: "backend intern", Phrase: true},
+		&Term{Field: FIELD_SITE, Text: "example.com"},
+		&Not{Node: &Term{Text: "senior"}},
+		&Term{Field: FIELD_TITLE, Text: "go"},
+	}}, n)
+
+	// Test: OR binds looser than the implicit AND
+	n, err = Parse("a b OR c")
+	require.NoError(t, err)
+	assert.Equal(t, &Or{Nodes: []Node{
+		&And{Nodes: []Node{&Term{Text: "a"}, &Term{Text: "b"}}},
+		&Term{Text: "c"},
+	}}, n)
+
+	// Test: parentheses group and NOT negates a group
+	n, err = Parse(`go AND NOT (java OR title:"c sharp")`)
+	require.NoError(t, err)
+	assert.Equal(t, &And{Nodes: []Node{
+		&Term{Text: "go"},
+		&Not{Node: &Or{Nodes: []Node{
+			&Term{Text: "java"},
+			&Term{Field: FIELD_TITLE, Text: "c sharp", Phrase: true},
+		}}},
+	}}, n)
+
+	// Test: lower case operators, URLs and dashes inside words are text
+	n, err = Parse("rock and roll https://a.com/x e-mail")
+	require.NoError(t, err)
+	assert.Len(t, n.(*And).Nodes, 5)
+	assert.Equal(t, &Term{Text: "https://a.com/x"}, n.(*And).Nodes[3])
+	assert.Equal(t, &Term{Text: "e-mail"}, n.(*And).Nodes[4])
+
+	// Test: UTF-8 bytes that read as spaces on their own do not split words
+	n, err = Parse("voilà хлеб -Århus\u00a0OR title:naïve")
+	require.NoError(t, err)
+	assert.Equal(t, &Or{Nodes: []Node{
+		&And{Nodes: []Node{
+			&Term{Text: "voilà"},
+			&Term{Text: "хлеб"},
+			&Not{Node: &Term{Text: "Århus"}},
+		}},
+		&Term{Field: FIELD_TITLE, Text: "naïve"},
+	}}, n)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		err error
+		pos int
+	}{
+		{"", ERROR_EMPTY_QUERY, 0},
+		{"   ", ERROR_EMPTY_QUERY, 0},
+		{`go "backend intern`, ERROR_UNTERMINATED_PHRASE, 3},
+		{"(go OR rust", ERROR_UNBALANCED_PAREN, 0},
+		{"go)", ERROR_UNBALANCED_PAREN, 2},
+		{"go OR", ERROR_MISSING_OPERAND, 3},
+		{"OR go", ERROR_MISSING_OPERAND, 0},
+		{"go AND", ERROR_MISSING_OPERAND, 3},
+		{"go NOT", ERROR_MISSING_OPERAND, 3},
+		{"go titel:x", ERROR_UNKNOWN_FIELD, 3},
+		{"site: go", ERROR_MISSING_VALUE, 0},
+		{"-go NOT rust", ERROR_ONLY_NEGATIONS, 0},
+		{"go OR -rust", ERROR_ONLY_NEGATIONS, 0},
+		{"()", ERROR_EMPTY_QUERY, 0},
+	} {
+		_, err := Parse(tt.in)
+		var qerr *Error
+		require.ErrorAs(t, err, &qerr, tt.in)
+		assert.ErrorIs(t, err, tt.err, tt.in)
+		assert.Equal(t, tt.pos, qerr.Pos, tt.in)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	n, err := Parse(`"backend intern" site:example.com -senior (go OR rust)`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backend intern", "go", "rust"}, Terms(n))
+
+	// Test: a query that can match without any text needs a full scan
+	n, err = Parse("go OR site:example.com")
+	require.NoError(t, err)
+	assert.Nil(t, Terms(n))
+	n, err = Parse("anchors:careers")
+	require.NoError(t, err)
+	assert.Nil(t, Terms(n))
+}
+
+func TestMatch(t *testing.T) {
+	d := &Doc{
+		Title:   "Backend intern (Go)",
+		Content: "We are hiring a backend intern to work on node.js services.",
+		URL:     "https://jobs.example.com/42",
+		Host:    "jobs.example.com",
+		Anchors: []string{"open position", "careers"},
+	}
+	matches := func(q string) bool {
+		n, err := Parse(q)
+		require.NoError(t, err, q)
+		return Match(n, d)
+	}
+
+	assert.True(t, matches(`"backend intern" site:example.com -senior title:go`))
+	assert.False(t, matches(`"intern backend"`))
+	assert.False(t, matches("site:ample.com go"))
+	assert.True(t, matches("node.js"))
+	assert.False(t, matches("title:hiring"))
+	assert.True(t, matches("anchors:careers url:/42"))
+
+	// Test: phrases do not span two anchors
+	assert.False(t, matches(`"position careers"`))
+	assert.True(t, matches("java OR (go -rust)"))
+}
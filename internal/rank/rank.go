@@ -0,0 +1,120 @@
+package rank
+
+import (
+	"errors"
+	"math"
+)
+
+var ERROR_INVALID_DAMPING = errors.New("damping factor must be between 0 and 1")
+
+// Options control the PageRank iteration. It stops after Iterations
+// rounds or once no score moves by more than Tolerance.
+type Options struct {
+	Damping    float64
+	Iterations int
+	Tolerance  float64
+}
+
+// Graph maps every page to the pages it links to. Pages that only appear
+// as targets are part of the graph too.
+type Graph map[string][]string
+
+type Score struct {
+	Rank     float64
+	InDegree int
+}
+
+// PageRank computes the score and the number of distinct linking pages of
+// every node in g. Duplicate links and self links are counted once and not
+// at all; pages without outgoing links spread their score over the whole
+// graph. Ranks are scaled so that their mean is 1, which keeps them
+// comparable between graphs of different sizes.
+func PageRank(g Graph, opts Options) (map[string]Score, error) {
+	if opts.Damping <= 0 || opts.Damping >= 1 {
+		return nil, ERROR_INVALID_DAMPING
+	}
+
+	ids := make(map[string]int)
+	names := []string{}
+	node := func(name string) int {
+		if i, ok := ids[name]; ok {
+			return i
+		}
+		ids[name] = len(names)
+		names = append(names, name)
+		return len(names) - 1
+	}
+	out := [][]int{}
+	for src, targets := range g {
+		s := node(src)
+		seen := make(map[int]bool, len(targets))
+		edges := []int{}
+		for _, target := range targets {
+			t := node(target)
+			if t == s || seen[t] {
+				continue
+			}
+			seen[t] = true
+			edges = append(edges, t)
+		}
+		for len(out) <= s {
+			out = append(out, nil)
+		}
+		out[s] = edges
+	}
+	n := len(names)
+	for len(out) < n {
+		out = append(out, nil)
+	}
+	scores := make(map[string]Score, n)
+	if n == 0 {
+		return scores, nil
+	}
+
+	inDegree := make([]int, n)
+	for _, edges := range out {
+		for _, t := range edges {
+			inDegree[t]++
+		}
+	}
+
+	rank := make([]float64, n)
+	next := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for range max(opts.Iterations, 1) {
+		dangling := 0.0
+		for i, edges := range out {
+			if len(edges) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-opts.Damping)/float64(n) + opts.Damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, edges := range out {
+			if len(edges) == 0 {
+				continue
+			}
+			share := opts.Damping * rank[i] / float64(len(edges))
+			for _, t := range edges {
+				next[t] += share
+			}
+		}
+		delta := 0.0
+		for i := range rank {
+			delta = math.Max(delta, math.Abs(next[i]-rank[i]))
+		}
+		rank, next = next, rank
+		if delta <= opts.Tolerance {
+			break
+		}
+	}
+
+	for i, name := range names {
+		scores[name] = Score{Rank: rank[i] * float64(n), InDegree: inDegree[i]}
+	}
+	return scores, nil
+}
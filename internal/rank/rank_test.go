@@ -0,0 +1,53 @@
+package rank
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testOptions = Options{Damping: 0.85, Iterations: 100, Tolerance: 1e-9}
+
+func TestPageRank(t *testing.T) {
+	g := Graph{
+		"a":   {"hub"},
+		"b":   {"hub", "hub", "b"},
+		"c":   {"hub", "a"},
+		"hub": {"a"},
+	}
+	scores, err := PageRank(g, testOptions)
+	require.NoError(t, err)
+	require.Len(t, scores, 4)
+
+	// Test: duplicate and self links are ignored for the in-degree
+	assert.Equal(t, 3, scores["hub"].InDegree)
+	assert.Equal(t, 2, scores["a"].InDegree)
+	assert.Equal(t, 0, scores["b"].InDegree)
+
+	// Test: the most linked page ranks first and ranks average to 1
+	assert.Greater(t, scores["hub"].Rank, scores["a"].Rank)
+	assert.Greater(t, scores["a"].Rank, scores["b"].Rank)
+	assert.Equal(t, scores["b"].Rank, scores["c"].Rank)
+	sum := 0.0
+	for _, s := range scores {
+		sum += s.Rank
+	}
+	assert.InDelta(t, 4, sum, 1e-6)
+}
+
+func TestPageRankDangling(t *testing.T) {
+	// Test: targets that were never crawled are nodes without links
+	scores, err := PageRank(Graph{"a": {"b"}, "c": {"b"}}, testOptions)
+	require.NoError(t, err)
+	require.Len(t, scores, 3)
+	assert.Equal(t, 2, scores["b"].InDegree)
+	assert.Greater(t, scores["b"].Rank, scores["a"].Rank)
+	assert.InDelta(t, 3, scores["a"].Rank+scores["b"].Rank+scores["c"].Rank, 1e-6)
+
+	// Test: an empty graph and an invalid damping factor
+	scores, err = PageRank(Graph{}, testOptions)
+	require.NoError(t, err)
+	assert.Empty(t, scores)
+	_, err = PageRank(Graph{"a": {"b"}}, Options{Damping: 1})
+	assert.ErrorIs(t, err, ERROR_INVALID_DAMPING)
+}
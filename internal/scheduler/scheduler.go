@@ -1,43 +1,239 @@
 package scheduler
 
 import (
+	"container/heap"
 	"context"
+	"errors"
+	"sync"
+	"time"
 )
 
+var ERROR_QUEUE_CLOSED = errors.New("queue is closed")
+var ERROR_QUEUE_FULL = errors.New("queue is full")
+
+const (
+	PriorityLow     = 0.1
+	PriorityDefault = 0.5
+	PriorityHigh    = 1.0
+	PriorityUrgent  = 10.0
+)
+
+type Job struct {
+	URL        string
+	Priority   float64
+	LastMod    time.Time
+	ChangeFreq string
+	SeedID     string
+	Depth      int
+	// CrawlID and CrawlTarget point at the on-demand crawl job and target
+	// the job was pushed for, if any, so its progress can be reported.
+	CrawlID     string
+	CrawlTarget int
+	seq         uint64
+	// rank is the score of the job when it was pushed. The heap orders by
+	// it, as the score itself changes while the job waits.
+	rank float64
+}
+
+func NewJob(url string) *Job {
+	return &Job{
+		URL:      url,
+		Priority: PriorityDefault,
+	}
+}
+
+// score blends the explicit priority with the freshness hints a sitemap
+// can provide, so recently modified and frequently changing pages are
+// fetched before stale ones of the same priority.
+func (j *Job) score(now time.Time) float64 {
+	s := j.Priority
+	switch j.ChangeFreq {
+	case "always", "hourly":
+		s += 0.2
+	case "daily":
+		s += 0.1
+	case "yearly", "never":
+		s -= 0.1
+	}
+	if !j.LastMod.IsZero() && now.Sub(j.LastMod) < 24*time.Hour {
+		s += 0.1
+	}
+	return s
+}
+
+type jobHeap []*Job
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank > h[j].rank
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) { *h = append(*h, x.(*Job)) }
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return job
+}
+
 type JobQueue struct {
-	Queue chan string
+	mu     sync.Mutex
+	jobs   jobHeap
+	limit  int
+	seq    uint64
+	ready  chan struct{}
+	space  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+	now    func() time.Time
 }
 
 func NewJobQueue(n int) *JobQueue {
 	return &JobQueue{
-		Queue: make(chan string, n),
+		limit:  n,
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		now:    time.Now,
+	}
+}
+
+// Close stops the queue from accepting new jobs. Jobs already queued can
+// still be popped or drained.
+func (jq *JobQueue) Close() {
+	jq.once.Do(func() { close(jq.closed) })
+}
+
+func (jq *JobQueue) isClosed() bool {
+	select {
+	case <-jq.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain removes and returns every queued job in priority order.
+func (jq *JobQueue) Drain() []*Job {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	jobs := make([]*Job, 0, jq.jobs.Len())
+	for jq.jobs.Len() > 0 {
+		jobs = append(jobs, heap.Pop(&jq.jobs).(*Job))
+	}
+	notify(jq.space)
+	return jobs
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+func (jq *JobQueue) Len() int {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	return jq.jobs.Len()
+}
+
+func (jq *JobQueue) PopJob(ctx context.Context) (*Job, error) {
+	for {
+		jq.mu.Lock()
+		if jq.jobs.Len() > 0 {
+			job := heap.Pop(&jq.jobs).(*Job)
+			if jq.jobs.Len() > 0 {
+				notify(jq.ready)
+			}
+			jq.mu.Unlock()
+			notify(jq.space)
+			return job, nil
+		}
+		jq.mu.Unlock()
+		select {
+		case <-jq.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryPushJob adds the job without waiting for space.
+func (jq *JobQueue) TryPushJob(job *Job) error {
+	if jq.isClosed() {
+		return ERROR_QUEUE_CLOSED
+	}
+	jq.mu.Lock()
+	if jq.limit > 0 && jq.jobs.Len() >= jq.limit {
+		jq.mu.Unlock()
+		return ERROR_QUEUE_FULL
+	}
+	jq.seq++
+	job.seq = jq.seq
+	job.rank = job.score(jq.now())
+	heap.Push(&jq.jobs, job)
+	if jq.jobs.Len() < jq.limit {
+		notify(jq.space)
+	}
+	jq.mu.Unlock()
+	notify(jq.ready)
+	return nil
+}
+
+func (jq *JobQueue) PushJob(ctx context.Context, job *Job) error {
+	for {
+		err := jq.TryPushJob(job)
+		if err != ERROR_QUEUE_FULL {
+			return err
+		}
+		select {
+		case <-jq.space:
+		case <-jq.closed:
+			return ERROR_QUEUE_CLOSED
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
 func (jq *JobQueue) Pop(ctx context.Context, n int) chan string {
 	res := make(chan string, n)
 	go func() {
-	outer:
+		defer close(res)
 		for range n {
-			select {
-			case res <- <-jq.Queue:
-			case <-ctx.Done():
-				break outer
+			job, err := jq.PopJob(ctx)
+			if err != nil {
+				return
 			}
+			res <- job.URL
 		}
-		close(res)
 	}()
 	return res
 }
 
 func (jq *JobQueue) Push(ctx context.Context, n int, in <-chan string) {
 	go func() {
-	outer:
 		for range n {
 			select {
-			case jq.Queue <- <-in:
+			case url, ok := <-in:
+				if !ok {
+					return
+				}
+				if err := jq.PushJob(ctx, NewJob(url)); err != nil {
+					return
+				}
 			case <-ctx.Done():
-				break outer
+				return
 			}
 		}
 	}()
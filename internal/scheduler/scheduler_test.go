@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPopOrder(t *testing.T) {
+	jq := NewJobQueue(10)
+	ctx := context.Background()
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "low", Priority: PriorityLow}))
+	require.NoError(t, jq.PushJob(ctx, NewJob("first")))
+	require.NoError(t, jq.PushJob(ctx, NewJob("second")))
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "urgent", Priority: PriorityUrgent}))
+
+	for _, want := range []string{"urgent", "first", "second", "low"} {
+		job, err := jq.PopJob(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, job.URL)
+	}
+}
+
+func TestPopOrderFreshness(t *testing.T) {
+	jq := NewJobQueue(10)
+	now := time.Now()
+	jq.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Test: a page modified just under a day ago is ahead while it is
+	// fresh, and keeps its place once it turns stale in the queue
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "fresh", Priority: PriorityDefault, LastMod: now.Add(-23 * time.Hour)}))
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "a", Priority: PriorityDefault + 0.05}))
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "b", Priority: PriorityDefault + 0.05}))
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "stale", Priority: PriorityDefault, LastMod: now.Add(-25 * time.Hour)}))
+	require.NoError(t, jq.PushJob(ctx, &Job{URL: "c", Priority: PriorityDefault + 0.05}))
+
+	for _, want := range []string{"fresh", "a", "b", "c", "stale"} {
+		job, err := jq.PopJob(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, job.URL)
+	}
+}
+
+func TestPushBlocksWhenFull(t *testing.T) {
+	jq := NewJobQueue(1)
+	require.NoError(t, jq.PushJob(context.Background(), NewJob("a")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, jq.PushJob(ctx, NewJob("b")), context.DeadlineExceeded)
+	assert.ErrorIs(t, jq.TryPushJob(NewJob("b")), ERROR_QUEUE_FULL)
+}
+
+func TestCloseAndDrain(t *testing.T) {
+	jq := NewJobQueue(1)
+	require.NoError(t, jq.PushJob(context.Background(), NewJob("a")))
+
+	// Test: a blocked pusher is released by Close
+	pushed := make(chan error)
+	go func() {
+		pushed <- jq.PushJob(context.Background(), NewJob("b"))
+	}()
+	jq.Close()
+	assert.ErrorIs(t, <-pushed, ERROR_QUEUE_CLOSED)
+
+	jobs := jq.Drain()
+	require.Equal(t, 1, len(jobs))
+	assert.Equal(t, "a", jobs[0].URL)
+	assert.Equal(t, 0, jq.Len())
+}
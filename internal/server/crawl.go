@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"net/http"
+	"net/url"
+)
+
+// MAX_CRAWL_URLS bounds how many URLs one crawl request may ask for.
+const MAX_CRAWL_URLS = 100
+
+var ERROR_NO_CRAWL_URLS = errors.New("crawl request should have at least one url")
+var ERROR_TOO_MANY_CRAWL_URLS = errors.New("crawl request has too many urls")
+var ERROR_INVALID_CRAWL_URL = errors.New("crawl url should be absolute http(s) url")
+
+type crawlRequest struct {
+	URLs []string `json:"urls"`
+}
+
+func (req *crawlRequest) validate() error {
+	if len(req.URLs) == 0 {
+		return ERROR_NO_CRAWL_URLS
+	}
+	if len(req.URLs) > MAX_CRAWL_URLS {
+		return ERROR_TOO_MANY_CRAWL_URLS
+	}
+	for _, link := range req.URLs {
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return ERROR_INVALID_CRAWL_URL
+		}
+	}
+	return nil
+}
+
+// HandlePostCrawl queues a crawl of the given URLs. A running crawler
+// claims the job and fetches them ahead of its frontier, even if they
+// were fetched recently.
+func (cfg *ApiConfig) HandlePostCrawl(w http.ResponseWriter, r *http.Request) {
+	var req crawlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, ERROR_MALFORMED_BODY)
+		return
+	}
+	if err := req.validate(); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	job := db.NewCrawlJob(req.URLs)
+	if err := cfg.store.InsertCrawlJob(job); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSONStatus(w, http.StatusAccepted, job)
+}
+
+// HandleGetCrawl reports the progress of a crawl job, URL by URL.
+func (cfg *ApiConfig) HandleGetCrawl(w http.ResponseWriter, r *http.Request) {
+	job, err := cfg.store.GetCrawlJob(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, job)
+}
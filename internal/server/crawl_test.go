@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCrawlRequestValidate(t *testing.T) {
+	tooMany := make([]string, MAX_CRAWL_URLS+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("https://example.com/%d", i)
+	}
+	for _, tc := range []struct {
+		name string
+		urls []string
+		err  error
+	}{
+		{"valid", []string{"https://example.com/", "http://example.org/a?b=c"}, nil},
+		{"empty", nil, ERROR_NO_CRAWL_URLS},
+		{"too many", tooMany, ERROR_TOO_MANY_CRAWL_URLS},
+		{"relative", []string{"/a"}, ERROR_INVALID_CRAWL_URL},
+		{"other scheme", []string{"ftp://example.com/"}, ERROR_INVALID_CRAWL_URL},
+		{"no host", []string{"https:///a"}, ERROR_INVALID_CRAWL_URL},
+		{"unparsable", []string{"https://example.com/", "http://[::1"}, ERROR_INVALID_CRAWL_URL},
+	} {
+		req := &crawlRequest{URLs: tc.urls}
+
+		// Test: only lists of absolute http(s) URLs are accepted
+		if tc.err == nil {
+			assert.NoError(t, req.validate(), tc.name)
+		} else {
+			assert.ErrorIs(t, req.validate(), tc.err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/limiter"
+	"net/http"
+	"strings"
+)
+
+var ERROR_LIMITS_NOT_SET = errors.New("crawler has not published its limits yet")
+
+type limitRequest struct {
+	GlobalRPS      *float64             `json:"global_rps"`
+	HostRPS        *float64             `json:"host_rps"`
+	Hosts          *[]limiter.HostLimit `json:"hosts"`
+	MaxConcurrency *int                 `json:"max_concurrency"`
+}
+
+type hostLimitRequest struct {
+	RPS float64 `json:"rps"`
+}
+
+func (req *limitRequest) apply(l *limiter.Limits) {
+	if req.GlobalRPS != nil {
+		l.GlobalRPS = *req.GlobalRPS
+	}
+	if req.HostRPS != nil {
+		l.HostRPS = *req.HostRPS
+	}
+	if req.Hosts != nil {
+		l.Hosts = *req.Hosts
+	}
+	if req.MaxConcurrency != nil {
+		l.MaxConcurrency = *req.MaxConcurrency
+	}
+}
+
+func (cfg *ApiConfig) getLimits() (*limiter.Limits, error) {
+	limits, err := cfg.store.GetLimits()
+	if errors.Is(err, db.ERROR_INVALID_ID) {
+		return nil, ERROR_LIMITS_NOT_SET
+	}
+	return limits, err
+}
+
+func (cfg *ApiConfig) saveLimits(w http.ResponseWriter, r *http.Request, limits *limiter.Limits) {
+	if err := limits.Validate(); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := cfg.store.SetLimits(limits); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, limits)
+}
+
+func (cfg *ApiConfig) HandleGetLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := cfg.getLimits()
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, limits)
+}
+
+func (cfg *ApiConfig) HandlePutLimits(w http.ResponseWriter, r *http.Request) {
+	var req limitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, ERROR_MALFORMED_BODY)
+		return
+	}
+
+	limits, err := cfg.getLimits()
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	req.apply(limits)
+	cfg.saveLimits(w, r, limits)
+}
+
+func (cfg *ApiConfig) HandlePutHostLimit(w http.ResponseWriter, r *http.Request) {
+	var req hostLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, ERROR_MALFORMED_BODY)
+		return
+	}
+
+	limits, err := cfg.getLimits()
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	host := strings.ToLower(r.PathValue("host"))
+	limits.Hosts = removeHostLimit(limits.Hosts, host)
+	limits.Hosts = append(limits.Hosts, limiter.HostLimit{Host: host, RPS: req.RPS})
+	cfg.saveLimits(w, r, limits)
+}
+
+func (cfg *ApiConfig) HandleDeleteHostLimit(w http.ResponseWriter, r *http.Request) {
+	limits, err := cfg.getLimits()
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	limits.Hosts = removeHostLimit(limits.Hosts, strings.ToLower(r.PathValue("host")))
+	cfg.saveLimits(w, r, limits)
+}
+
+func removeHostLimit(hosts []limiter.HostLimit, host string) []limiter.HostLimit {
+	res := []limiter.HostLimit{}
+	for _, h := range hosts {
+		if h.Host != host {
+			res = append(res, h)
+		}
+	}
+	return res
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type pageDeleted struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Deleted bool   `json:"deleted"`
+	Blocked bool   `json:"blocked"`
+}
+
+// cacheTemplate shows the stored text of a page under a banner that says
+// where and when it was taken from. The parser keeps no block structure,
+// so the text is one block that keeps whatever line breaks it has. It is
+// escaped like any other template value, so a cached page cannot run
+// scripts.
+var cacheTemplate = template.Must(template.New("cache").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} (cached)</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; line-height: 1.5; }
+.banner { background: #f4f4f4; border: 1px solid #ccc; padding: .5em 1em; margin-bottom: 2em; }
+.text { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<div class="banner">
+This is the text of <a href="{{.URL}}" rel="nofollow noreferrer">{{.URL}}</a>
+as it was crawled on {{.UpdatedAt}}. The page may have changed since.
+</div>
+<h1>{{.Title}}</h1>
+<div class="text">{{.Text}}</div>
+</body>
+</html>
+`))
+
+type cacheView struct {
+	Title     string
+	URL       string
+	UpdatedAt string
+	Text      string
+}
+
+func newCacheView(p *db.Page) *cacheView {
+	v := &cacheView{
+		Title:     p.Title,
+		URL:       p.URL,
+		UpdatedAt: p.UpdatedAt.UTC().Format(time.RFC1123),
+		Text:      strings.TrimSpace(p.Content),
+	}
+	if v.Title == "" {
+		v.Title = p.URL
+	}
+	return v
+}
+
+// HandleGetPage returns the stored metadata and extracted text of a page.
+func (cfg *ApiConfig) HandleGetPage(w http.ResponseWriter, r *http.Request) {
+	page, err := cfg.pages.GetPageByID(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, page)
+}
+
+// HandleGetPageCache renders the stored text of a page as HTML.
+func (cfg *ApiConfig) HandleGetPageCache(w http.ResponseWriter, r *http.Request) {
+	page, err := cfg.pages.GetPageByID(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := cacheTemplate.Execute(&body, newCacheView(page)); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Write(body.Bytes())
+}
+
+// HandleDeletePage removes a page, its versions and its links from the
+// store and the page from the search index. The URL is blocked first, so
+// the crawler does not fetch it again even if one of the removals fails.
+// Every step may run again, and a page that is already gone from the
+// store is found through its blocklist entry, so a failed delete can be
+// retried until it went through.
+func (cfg *ApiConfig) HandleDeletePage(w http.ResponseWriter, r *http.Request) {
+	page, err := cfg.deletedPage(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = cfg.store.BlockURL(&db.BlockedURL{
+		URLHash:   page.URLHash,
+		URL:       page.URL,
+		BlockedAt: time.Now(),
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := cfg.pages.DeletePageByID(page.URLHash); err != nil && !errors.Is(err, db.ERROR_INVALID_ID) {
+		WriteError(w, r, err)
+		return
+	}
+	if err := cfg.store.DeleteVersions(page.URLHash); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := cfg.store.DeleteLinks(page.URLHash); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if cfg.index != nil {
+		if err := cfg.index.DeleteDocument(r.Context(), page.URLHash); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+	}
+
+	WriteJSON(w, &pageDeleted{ID: page.URLHash, URL: page.URL, Deleted: true, Blocked: true})
+}
+
+// deletedPage looks up the page HandleDeletePage removes. A page that is
+// only left in the blocklist was removed from the store by an earlier
+// request that failed later on.
+func (cfg *ApiConfig) deletedPage(id string) (*db.Page, error) {
+	page, err := cfg.pages.GetPageByID(id)
+	if !errors.Is(err, db.ERROR_INVALID_ID) {
+		return page, err
+	}
+	blocked, berr := cfg.store.GetBlockedURL(id)
+	if berr != nil {
+		return nil, berr
+	}
+	return &db.Page{URLHash: blocked.URLHash, URL: blocked.URL}, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestApi serves a local store in a temporary directory without a
+// search index.
+func newTestApi(t *testing.T) (*ApiConfig, *db.LocalStore) {
+	store, err := db.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.CloseConnection() })
+	return NewApiConfig(store, nil), store
+}
+
+func serve(cfg *ApiConfig, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestHandleGetPage(t *testing.T) {
+	cfg, store := newTestApi(t)
+	page := &db.Page{URLHash: "a", URL: "https://a.com/", Title: "A", Content: "alpha",
+		UpdatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	_, err := store.InsertPage(page)
+	require.NoError(t, err)
+
+	// Test: a stored page is returned as JSON
+	w := serve(cfg, http.MethodGet, "/api/page/a")
+	require.Equal(t, http.StatusOK, w.Code)
+	var got db.Page
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, "https://a.com/", got.URL)
+	assert.Equal(t, "alpha", got.Content)
+
+	// Test: an unknown page is a not found problem
+	w = serve(cfg, http.MethodGet, "/api/page/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Header().Get("Content-Type"))
+}
+
+func TestHandleGetPageCache(t *testing.T) {
+	cfg, store := newTestApi(t)
+	_, err := store.InsertPage(&db.Page{URLHash: "a", URL: "https://a.com/", Title: "A <b>",
+		Content: "first part second part <script>alert(1)</script>"})
+	require.NoError(t, err)
+
+	w := serve(cfg, http.MethodGet, "/api/page/a/cache")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Security-Policy"), "default-src 'none'")
+
+	// Test: the text is one escaped block, not split into paragraphs
+	body := w.Body.String()
+	assert.Contains(t, body, `<div class="text">first part second part &lt;script&gt;alert(1)&lt;/script&gt;</div>`)
+	assert.Contains(t, body, "<h1>A &lt;b&gt;</h1>")
+	assert.NotContains(t, body, "<script>")
+
+	w = serve(cfg, http.MethodGet, "/api/page/missing/cache")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleDeletePage(t *testing.T) {
+	cfg, store := newTestApi(t)
+	page := &db.Page{URLHash: "a", URL: "https://a.com/", Title: "A", Content: "alpha"}
+	_, err := store.InsertPage(page)
+	require.NoError(t, err)
+	version, err := db.NewPageVersion(page)
+	require.NoError(t, err)
+	require.NoError(t, store.AddVersions([]*db.PageVersion{version})[0])
+	require.NoError(t, store.SaveLinks([]*db.PageLinks{{URLHash: "a", URL: page.URL,
+		Links: []db.Link{{TargetHash: "b", TargetURL: "https://b.com/", Anchor: "b"}}}})[0])
+	anchors, err := store.GetAnchors("b", 10)
+	require.NoError(t, err)
+	require.Len(t, anchors, 1)
+
+	// Test: the page, its versions and links are removed and the URL blocked
+	w := serve(cfg, http.MethodDelete, "/api/page/a")
+	require.Equal(t, http.StatusOK, w.Code)
+	var res pageDeleted
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, pageDeleted{ID: "a", URL: page.URL, Deleted: true, Blocked: true}, res)
+
+	_, err = store.GetPageByID("a")
+	assert.ErrorIs(t, err, db.ERROR_INVALID_ID)
+	versions, err := store.GetVersions("a")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+	anchors, err = store.GetAnchors("b", 10)
+	require.NoError(t, err)
+	assert.Empty(t, anchors)
+	blocked, err := store.GetBlockedURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, page.URL, blocked.URL)
+
+	// Test: deleting again goes through the blocklist entry
+	w = serve(cfg, http.MethodDelete, "/api/page/a")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test: a page that was never stored is not found
+	w = serve(cfg, http.MethodDelete, "/api/page/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/index"
+	"github.com/evok02/jcrawler/internal/limiter"
+	"github.com/evok02/jcrawler/internal/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// REQUEST_ID_HEADER carries the ID of a request. A valid ID sent by the
+// client is kept, so a request can be followed through a proxy.
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// PROBLEM_CONTENT_TYPE is the media type of error responses, RFC 7807.
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Problem is the body of every error response, see RFC 7807. Position is
+// set for malformed search queries and points at the offending rune.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Position  *int   `json:"position,omitempty"`
+}
+
+// errorStatuses maps the errors handlers return to the status they are
+// answered with. Anything not listed here is an internal error.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{db.ERROR_INVALID_ID, http.StatusNotFound},
+	{ERROR_NO_VERSIONS, http.StatusNotFound},
+	{ERROR_MALFORMED_BODY, http.StatusBadRequest},
+	{ERROR_MALFORMED_QUERY, http.StatusBadRequest},
+	{ERROR_INVALID_SEED_URL, http.StatusBadRequest},
+	{ERROR_INVALID_SEED_LIMITS, http.StatusBadRequest},
+	{ERROR_INVALID_VERSION, http.StatusBadRequest},
+	{ERROR_NO_CRAWL_URLS, http.StatusBadRequest},
+	{ERROR_TOO_MANY_CRAWL_URLS, http.StatusBadRequest},
+	{ERROR_INVALID_CRAWL_URL, http.StatusBadRequest},
+	{ERROR_CURSOR_UNSUPPORTED, http.StatusBadRequest},
+	{ERROR_TEXT_TERM_REQUIRED, http.StatusBadRequest},
+	{index.ERROR_INVALID_PAGE, http.StatusBadRequest},
+	{index.ERROR_INVALID_CURSOR, http.StatusBadRequest},
+	{index.ERROR_INVALID_DATE, http.StatusBadRequest},
+	{limiter.ERROR_INVALID_LIMITS, http.StatusBadRequest},
+	{ERROR_LIMITS_NOT_SET, http.StatusServiceUnavailable},
+	{index.ERROR_UNAVAILABLE, http.StatusServiceUnavailable},
+}
+
+// statusOf picks the HTTP status for err. Error responses of the search
+// cluster keep their status when it is one the client can act on, and a
+// store that is down or timed out is reported as unavailable.
+func statusOf(err error) int {
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		return http.StatusBadRequest
+	}
+	var cerr *index.ClusterError
+	if errors.As(err, &cerr) {
+		switch cerr.Status {
+		case http.StatusBadRequest, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return cerr.Status
+		}
+		return http.StatusInternalServerError
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+	if db.IsUnavailable(err) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// NewProblem describes err as a response to r. The details of internal
+// errors are logged under the request ID rather than sent to the client.
+func NewProblem(r *http.Request, err error) *Problem {
+	status := statusOf(err)
+	p := &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Error(),
+		Instance:  r.URL.Path,
+		RequestID: RequestID(r.Context()),
+	}
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		p.Detail = qerr.Err.Error()
+		p.Position = &qerr.Pos
+	}
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s %s: %s", p.RequestID, r.Method, r.URL.Path, err.Error())
+		p.Detail = ""
+	}
+	return p
+}
+
+// WriteError answers r with the problem details of err.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	p := NewProblem(r, err)
+	data, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	w.WriteHeader(p.Status)
+	w.Write(data)
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID WithRequestID gave the request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID gives every request an ID, returned in REQUEST_ID_HEADER
+// and in error responses.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if !requestIDPattern.MatchString(id) {
+			id = bson.NewObjectID().Hex()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/index"
+	"github.com/evok02/jcrawler/internal/query"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusOf(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"missing entry", db.ERROR_INVALID_ID, http.StatusNotFound},
+		{"wrapped missing entry", fmt.Errorf("GetPageByID: %w", db.ERROR_INVALID_ID), http.StatusNotFound},
+		{"bad body", ERROR_MALFORMED_BODY, http.StatusBadRequest},
+		{"malformed query", &query.Error{Pos: 3, Err: query.ERROR_UNBALANCED_PAREN}, http.StatusBadRequest},
+		{"store timeout", fmt.Errorf("GetPages: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{"index down", index.ERROR_UNAVAILABLE, http.StatusServiceUnavailable},
+		{"cluster rejects query", &index.ClusterError{Status: http.StatusBadRequest}, http.StatusBadRequest},
+		{"cluster throttles", &index.ClusterError{Status: http.StatusTooManyRequests}, http.StatusTooManyRequests},
+		{"cluster fails", &index.ClusterError{Status: http.StatusForbidden}, http.StatusInternalServerError},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError},
+	} {
+		// Test: every error is answered with the status it maps to
+		assert.Equal(t, tc.status, statusOf(tc.err), tc.name)
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/page?search=(go", nil)
+
+	// Test: malformed queries point at the offending rune
+	p := NewProblem(r, &query.Error{Pos: 0, Err: query.ERROR_UNBALANCED_PAREN})
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, query.ERROR_UNBALANCED_PAREN.Error(), p.Detail)
+	if assert.NotNil(t, p.Position) {
+		assert.Equal(t, 0, *p.Position)
+	}
+
+	// Test: the details of internal errors are not sent to the client
+	p = NewProblem(r, errors.New("connection string leaked"))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Empty(t, p.Detail)
+}
+
+func TestWithRequestID(t *testing.T) {
+	var seen string
+	h := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+	for _, tc := range []struct {
+		name string
+		sent string
+		kept bool
+	}{
+		{"valid", "req-42.a_b", true},
+		{"missing", "", false},
+		{"invalid characters", "bad id\n", false},
+		{"too long", strings.Repeat("a", 65), false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.sent != "" {
+			r.Header.Set(REQUEST_ID_HEADER, tc.sent)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		// Test: a valid ID is kept, anything else is replaced
+		got := w.Header().Get(REQUEST_ID_HEADER)
+		assert.Equal(t, got, seen, tc.name)
+		assert.Regexp(t, requestIDPattern, got, tc.name)
+		if tc.kept {
+			assert.Equal(t, tc.sent, got, tc.name)
+		} else {
+			assert.NotEqual(t, tc.sent, got, tc.name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/evok02/jcrawler/internal/index"
+	"github.com/evok02/jcrawler/internal/query"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STORE_SEARCH_CANDIDATES caps how many text search hits of the page
+// store a query is matched on when there is no search index. Results
+// beyond it are missed, and the total is marked as a lower bound.
+const STORE_SEARCH_CANDIDATES = 1000
+
+var ERROR_CURSOR_UNSUPPORTED = errors.New("cursor paging needs the search index, use from and size")
+var ERROR_TEXT_TERM_REQUIRED = errors.New("queries without a word to search for need the search index")
+
+func parseSearchRequest(r *http.Request) (*index.SearchRequest, error) {
+	queries := r.URL.Query()
+	if queries["search"] == nil {
+		return nil, ERROR_MALFORMED_QUERY
+	}
+	req := &index.SearchRequest{
+		Query: strings.Join(queries["search"], " "),
+		After: queries.Get("after"),
+	}
+	var err error
+	if raw := queries.Get("from"); raw != "" {
+		if req.From, err = strconv.Atoi(raw); err != nil {
+			return nil, index.ERROR_INVALID_PAGE
+		}
+	}
+	if raw := queries.Get("size"); raw != "" {
+		if req.Size, err = strconv.Atoi(raw); err != nil {
+			return nil, index.ERROR_INVALID_PAGE
+		}
+	}
+	if err := parseFilters(queries, &req.Filters); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// parseFilters reads the filter parameters. Each of them may be repeated
+// or hold a comma separated list, and a page passes when it matches any
+// of the given values.
+func parseFilters(queries url.Values, f *index.Filters) error {
+	list := func(key string) []string {
+		values := []string{}
+		for _, raw := range queries[key] {
+			for _, v := range strings.Split(raw, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		return values
+	}
+	f.Hosts = list("host")
+	f.Domains = list("domain")
+	f.Languages = list("lang")
+	f.ContentTypes = list("type")
+	f.Keywords = list("keyword")
+	for key, t := range map[string]*time.Time{
+		"updated_after":  &f.UpdatedAfter,
+		"updated_before": &f.UpdatedBefore,
+	} {
+		if raw := queries.Get(key); raw != "" {
+			parsed, err := index.ParseDate(raw)
+			if err != nil {
+				return err
+			}
+			*t = parsed
+		}
+	}
+	return nil
+}
+
+// HandleGetPages serves full text search. With a search index configured
+// the results come from OpenSearch; otherwise the page store ranks them,
+// without scores or highlights, only from/size paging works and a query
+// needs a word to look up, so `site:` alone is refused. Malformed queries
+// are answered with the position and reason of the problem.
+func (cfg *ApiConfig) HandleGetPages(w http.ResponseWriter, r *http.Request) {
+	req, err := parseSearchRequest(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var res *index.SearchResult
+	if cfg.index != nil {
+		res, err = cfg.index.Search(r.Context(), req)
+	} else {
+		res, err = cfg.storeSearch(req)
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	cfg.recordQuery(req, res)
+
+	WriteJSON(w, res)
+}
+
+func (cfg *ApiConfig) storeSearch(req *index.SearchRequest) (*index.SearchResult, error) {
+	if req.After != "" {
+		return nil, ERROR_CURSOR_UNSUPPORTED
+	}
+	candidates, capped, err := cfg.searchCandidates(req.Expr)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]*db.Page, 0, len(candidates))
+	for _, p := range candidates {
+		if !req.Filters.Match(p) {
+			continue
+		}
+		anchors, err := cfg.store.GetAnchors(p.URLHash, index.MAX_ANCHORS)
+		if err != nil {
+			return nil, err
+		}
+		doc := &query.Doc{Title: p.Title, Content: p.Content, URL: p.URL}
+		if u, err := url.Parse(p.URL); err == nil {
+			doc.Host = u.Hostname()
+		}
+		for _, a := range anchors {
+			doc.Anchors = append(doc.Anchors, a.Text)
+		}
+		if query.Match(req.Expr, doc) {
+			pages = append(pages, p)
+		}
+	}
+	res := &index.SearchResult{
+		Total:      int64(len(pages)),
+		TotalExact: !capped,
+		From:       req.From,
+		Size:       req.Size,
+		Hits:       []*index.Hit{},
+		Facets:     index.CountFacets(pages, time.Now()),
+	}
+	for _, p := range pages[min(req.From, len(pages)):min(req.From+req.Size, len(pages))] {
+		res.Hits = append(res.Hits, &index.Hit{PageServe: db.PageServe{
+			ID:        p.URLHash,
+			URL:       p.URL,
+			Title:     p.Title,
+			UpdatedAt: &p.UpdatedAt,
+		}})
+	}
+	return res, nil
+}
+
+// searchCandidates loads the pages a query can match: the text search
+// hits for its words, in their order. capped is set when there were more
+// hits than STORE_SEARCH_CANDIDATES. A query that can match without any
+// of its words would have to be matched on every page, which is left to
+// the search index. Operators and quotes are left to query.Match.
+func (cfg *ApiConfig) searchCandidates(expr query.Node) (pages []*db.Page, capped bool, err error) {
+	terms := query.Terms(expr)
+	if terms == nil {
+		return nil, false, ERROR_TEXT_TERM_REQUIRED
+	}
+
+	served, err := cfg.pages.GetPagesByIndex(strings.Join(terms, " "), STORE_SEARCH_CANDIDATES)
+	if err != nil {
+		return nil, false, err
+	}
+	capped = len(served) >= STORE_SEARCH_CANDIDATES
+	ids := make([]string, 0, len(served))
+	for _, s := range served {
+		ids = append(ids, s.ID)
+	}
+	pages, err = cfg.pages.GetPagesByIDs(ids)
+	if err != nil {
+		return nil, false, err
+	}
+	return pages, capped, nil
+}
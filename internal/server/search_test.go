@@ -0,0 +1,68 @@
+package server
+
+import (
+	"github.com/evok02/jcrawler/internal/index"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSearchRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+		err   error
+	}{
+		{"missing search", "from=10", ERROR_MALFORMED_QUERY},
+		{"bad from", "search=go&from=ten", index.ERROR_INVALID_PAGE},
+		{"bad size", "search=go&size=-", index.ERROR_INVALID_PAGE},
+		{"page outside the window", "search=go&from=-1", index.ERROR_INVALID_PAGE},
+		{"bad date", "search=go&updated_after=yesterday", index.ERROR_INVALID_DATE},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/page?"+tc.query, nil)
+		_, err := parseSearchRequest(r)
+
+		// Test: invalid parameters are rejected with the matching error
+		assert.ErrorIs(t, err, tc.err, tc.name)
+	}
+
+	// Test: repeated search parameters are joined into one query
+	r := httptest.NewRequest(http.MethodGet, "/api/page?search=go&search=lang&from=10&size=5&after=abc", nil)
+	req, err := parseSearchRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, "go lang", req.Query)
+	assert.Equal(t, 10, req.From)
+	assert.Equal(t, 5, req.Size)
+	assert.Equal(t, "abc", req.After)
+}
+
+func TestParseFilters(t *testing.T) {
+	queries := url.Values{
+		"host":           {"a.com, b.com", "c.com"},
+		"lang":           {"en,,de"},
+		"type":           {" text/html "},
+		"updated_after":  {"2024-01-02"},
+		"updated_before": {"2024-03-04T05:06:07Z"},
+	}
+	var f index.Filters
+	require.NoError(t, parseFilters(queries, &f))
+
+	// Test: lists may be repeated or comma separated, blanks are dropped
+	assert.Equal(t, []string{"a.com", "b.com", "c.com"}, f.Hosts)
+	assert.Equal(t, []string{"en", "de"}, f.Languages)
+	assert.Equal(t, []string{"text/html"}, f.ContentTypes)
+	assert.Empty(t, f.Domains)
+	assert.Empty(t, f.Keywords)
+
+	// Test: dates are read as days or RFC 3339 timestamps
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), f.UpdatedAfter)
+	assert.Equal(t, time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC), f.UpdatedBefore)
+
+	// Test: a malformed date is rejected
+	err := parseFilters(url.Values{"updated_before": {"03/04/2024"}}, &f)
+	assert.ErrorIs(t, err, index.ERROR_INVALID_DATE)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/evok02/jcrawler/internal/db"
+	"net/http"
+	"net/url"
+)
+
+var ERROR_MALFORMED_BODY = errors.New("invalid request body")
+var ERROR_INVALID_SEED_URL = errors.New("seed url should be absolute http(s) url")
+var ERROR_INVALID_SEED_LIMITS = errors.New("seed depth and budget should not be negative")
+
+type seedRequest struct {
+	URL    string   `json:"url"`
+	Depth  int      `json:"depth"`
+	Budget int      `json:"budget"`
+	Tags   []string `json:"tags"`
+}
+
+type seedDeleted struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (req *seedRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ERROR_INVALID_SEED_URL
+	}
+	if req.Depth < 0 || req.Budget < 0 {
+		return ERROR_INVALID_SEED_LIMITS
+	}
+	return nil
+}
+
+func (cfg *ApiConfig) HandlePostSeed(w http.ResponseWriter, r *http.Request) {
+	var req seedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, ERROR_MALFORMED_BODY)
+		return
+	}
+	if err := req.validate(); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	seed, err := cfg.store.UpsertSeed(&db.Seed{
+		URL:    req.URL,
+		Depth:  req.Depth,
+		Budget: req.Budget,
+		Tags:   req.Tags,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, seed)
+}
+
+func (cfg *ApiConfig) HandleGetSeeds(w http.ResponseWriter, r *http.Request) {
+	seeds, err := cfg.store.GetSeeds()
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, &seeds)
+}
+
+func (cfg *ApiConfig) handleSetSeedPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	seed, err := cfg.store.SetSeedPaused(r.PathValue("id"), paused)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, seed)
+}
+
+func (cfg *ApiConfig) HandlePauseSeed(w http.ResponseWriter, r *http.Request) {
+	cfg.handleSetSeedPaused(w, r, true)
+}
+
+func (cfg *ApiConfig) HandleResumeSeed(w http.ResponseWriter, r *http.Request) {
+	cfg.handleSetSeedPaused(w, r, false)
+}
+
+func (cfg *ApiConfig) HandleDeleteSeed(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := cfg.store.DeleteSeedByID(id); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, &seedDeleted{ID: id, Deleted: true})
+}
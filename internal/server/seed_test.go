@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/evok02/jcrawler/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func servePost(cfg *ApiConfig, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return w
+}
+
+func decodeSeed(t *testing.T, w *httptest.ResponseRecorder) *db.Seed {
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var seed db.Seed
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&seed))
+	return &seed
+}
+
+func TestHandlePostSeed(t *testing.T) {
+	cfg, store := newTestApi(t)
+
+	// Test: a valid seed is stored and returned with its id
+	seed := decodeSeed(t, servePost(cfg, "/api/seed",
+		`{"url": "https://a.com/", "depth": 2, "budget": 10, "tags": ["news"]}`))
+	assert.NotEmpty(t, seed.ID)
+	assert.Equal(t, "https://a.com/", seed.URL)
+	assert.Equal(t, 2, seed.Depth)
+	assert.Equal(t, 10, seed.Budget)
+	assert.Equal(t, []string{"news"}, seed.Tags)
+
+	// Test: posting the same url again updates the seed in place
+	again := decodeSeed(t, servePost(cfg, "/api/seed", `{"url": "https://a.com/", "depth": 3}`))
+	assert.Equal(t, seed.ID, again.ID)
+	assert.Equal(t, 3, again.Depth)
+	stored, err := store.GetSeeds()
+	require.NoError(t, err)
+	assert.Len(t, stored, 1)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed body", `{"url": `},
+		{"relative url", `{"url": "/a"}`},
+		{"unsupported scheme", `{"url": "ftp://a.com/"}`},
+		{"negative depth", `{"url": "https://b.com/", "depth": -1}`},
+		{"negative budget", `{"url": "https://b.com/", "budget": -1}`},
+	}
+	for _, tt := range tests {
+		// Test: invalid requests are rejected without storing a seed
+		w := servePost(cfg, "/api/seed", tt.body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.name)
+		assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Header().Get("Content-Type"), tt.name)
+	}
+	stored, err = store.GetSeeds()
+	require.NoError(t, err)
+	assert.Len(t, stored, 1)
+}
+
+func TestHandleGetSeeds(t *testing.T) {
+	cfg, store := newTestApi(t)
+
+	// Test: an empty store lists no seeds rather than null
+	w := serve(cfg, http.MethodGet, "/api/seed")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	for _, link := range []string{"https://a.com/", "https://b.com/"} {
+		_, err := store.InsertSeed(&db.Seed{URL: link})
+		require.NoError(t, err)
+	}
+
+	// Test: every stored seed is listed
+	w = serve(cfg, http.MethodGet, "/api/seed")
+	require.Equal(t, http.StatusOK, w.Code)
+	var seeds []*db.Seed
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&seeds))
+	urls := []string{}
+	for _, seed := range seeds {
+		urls = append(urls, seed.URL)
+	}
+	assert.ElementsMatch(t, []string{"https://a.com/", "https://b.com/"}, urls)
+}
+
+func TestHandlePauseResumeSeed(t *testing.T) {
+	cfg, store := newTestApi(t)
+	seed, err := store.InsertSeed(&db.Seed{URL: "https://a.com/"})
+	require.NoError(t, err)
+
+	// Test: pausing a seed is returned and stored
+	paused := decodeSeed(t, serve(cfg, http.MethodPost, "/api/seed/"+seed.ID+"/pause"))
+	assert.True(t, paused.Paused)
+	got, err := store.GetSeedByID(seed.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Paused)
+
+	// Test: resuming a seed clears the flag
+	resumed := decodeSeed(t, serve(cfg, http.MethodPost, "/api/seed/"+seed.ID+"/resume"))
+	assert.False(t, resumed.Paused)
+	got, err = store.GetSeedByID(seed.ID)
+	require.NoError(t, err)
+	assert.False(t, got.Paused)
+
+	// Test: an unknown seed is a not found problem
+	w := serve(cfg, http.MethodPost, "/api/seed/missing/pause")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(cfg, http.MethodPost, "/api/seed/missing/resume")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleDeleteSeed(t *testing.T) {
+	cfg, store := newTestApi(t)
+	seed, err := store.InsertSeed(&db.Seed{URL: "https://a.com/"})
+	require.NoError(t, err)
+
+	// Test: a deleted seed is gone from the store
+	w := serve(cfg, http.MethodDelete, "/api/seed/"+seed.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id": "`+seed.ID+`", "deleted": true}`, w.Body.String())
+	_, err = store.GetSeedByID(seed.ID)
+	assert.ErrorIs(t, err, db.ERROR_INVALID_ID)
+
+	// Test: deleting it again is a not found problem
+	w = serve(cfg, http.MethodDelete, "/api/seed/"+seed.ID)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, PROBLEM_CONTENT_TYPE, w.Header().Get("Content-Type"))
+}
@@ -1,123 +1,96 @@
 package server
 
 import (
-	"strings"
 	"encoding/json"
-	"net/http"
+	"errors"
 	"fmt"
 	"github.com/evok02/jcrawler/internal/db"
-	"reflect"
-	"errors"
-	"os"
+	"github.com/evok02/jcrawler/internal/index"
+	"net/http"
 )
 
 const DEFAULT_ADDR string = "localhost:1337"
 
-var ERROR_RES_NOT_POINTER =  errors.New("result should be a pointer")
 var ERROR_MALFORMED_QUERY = errors.New("invalid query format")
-var ERROR_EMPTY_CONN_STRING = errors.New("empty db connection string")
-
-type ResponseError struct {
-	Err error
-}
-
-func NewResponseError(err error) *ResponseError {
-	return &ResponseError{
-		Err: err,
-	}
-}
 
-func (re *ResponseError) Error() string {
-	return re.Err.Error()
+// WriteJSON answers with result and status 200.
+func WriteJSON(w http.ResponseWriter, result any) error {
+	return WriteJSONStatus(w, http.StatusOK, result)
 }
 
-func WriteJSON(w http.ResponseWriter, result any) error {
-	resultVal := reflect.ValueOf(result)
-	if resultVal.Kind() != reflect.Pointer {
-		return fmt.Errorf("WriteJSON: %s", ERROR_RES_NOT_POINTER)
-	}
-	
+// WriteJSONStatus answers with result and status. The body is encoded
+// before anything is written, so a result that cannot be encoded still
+// gets an error status.
+func WriteJSONStatus(w http.ResponseWriter, status int, result any) error {
 	jsonResult, err := json.Marshal(result)
 	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return fmt.Errorf("WriteJSON: %s", err.Error())
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-
-	_, err = w.Write(jsonResult)
-	if err != nil {
+	w.WriteHeader(status)
+	if _, err := w.Write(jsonResult); err != nil {
 		return fmt.Errorf("WriteJSON: %s", err.Error())
 	}
-
-	switch resultVal.Type(){
-	case reflect.TypeOf(&ResponseError{}):
-		w.WriteHeader(http.StatusBadRequest)
-	case reflect.TypeOf([]db.PageServe{}):
-		w.WriteHeader(http.StatusOK)
-	}  
-
 	return nil
 }
 
 type Server struct {
 	srv http.Server
-	db db.Storage
+	db  db.Storage
 }
 
 func New(addr string) *Server {
 	return &Server{
-		srv: http.Server {
+		srv: http.Server{
 			Addr: addr,
 		},
-	}	
+	}
 }
 
 type ApiConfig struct {
-	store *db.Storage
+	store db.Store
+	pages db.PageStore
+	index *index.Index
 }
 
-func NewApiConfig() (*ApiConfig, error) {
-	dbConn := os.Getenv("DB_CONN_STRING")
-	if dbConn == "" {
-		return nil, ERROR_EMPTY_CONN_STRING
-	}
-	store, err := db.NewStorage(dbConn)
-
-	if err != nil {
-		return nil, fmt.Errorf("NewApiConfig: %s", err.Error())
-	}
+// NewApiConfig serves the pages of store. Search goes to idx when it is
+// not nil and falls back to the store otherwise.
+func NewApiConfig(store db.Store, idx *index.Index) *ApiConfig {
 	return &ApiConfig{
 		store: store,
-	}, nil
-}
-
-func (cfg *ApiConfig) HandleGetPages(w http.ResponseWriter, r *http.Request) {
-	queries := r.URL.Query()
-	if queries["search"] == nil {
-		WriteJSON(w, NewResponseError(ERROR_MALFORMED_QUERY))
-		return 
-	}
-
-	pages, err := cfg.store.GetPagesByIndex(strings.Join(queries["search"], " "))
-	if err != nil {
-		WriteJSON(w, NewResponseError(err))
-		return 
+		pages: store,
+		index: idx,
 	}
-
-	WriteJSON(w, pages)
 }
 
-func Run(addr string) error {
-	mux := http.NewServeMux()
-	apiCfg, err := NewApiConfig()
-	if err != nil {
-		return fmt.Errorf("Run: %s", err.Error())
-	}
-	mux.HandleFunc("GET /api/page", apiCfg.HandleGetPages)
-	//mux.HandleFunc("/api/limit")
-	//mux.HandleFunc("/api/seed")
-
+func Run(addr string, apiCfg *ApiConfig) error {
 	server := New(addr)
-	server.srv.Handler = mux
+	server.srv.Handler = apiCfg.Handler()
 	return server.srv.ListenAndServe()
 }
+
+// Handler routes the API to the handlers of cfg.
+func (cfg *ApiConfig) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/page", cfg.HandleGetPages)
+	mux.HandleFunc("GET /api/suggest", cfg.HandleGetSuggest)
+	mux.HandleFunc("GET /api/page/{id}", cfg.HandleGetPage)
+	mux.HandleFunc("GET /api/page/{id}/cache", cfg.HandleGetPageCache)
+	mux.HandleFunc("DELETE /api/page/{id}", cfg.HandleDeletePage)
+	mux.HandleFunc("GET /api/page/{id}/versions", cfg.HandleGetVersions)
+	mux.HandleFunc("GET /api/page/{id}/diff", cfg.HandleGetDiff)
+	mux.HandleFunc("GET /api/limit", cfg.HandleGetLimits)
+	mux.HandleFunc("PUT /api/limit", cfg.HandlePutLimits)
+	mux.HandleFunc("PUT /api/limit/host/{host}", cfg.HandlePutHostLimit)
+	mux.HandleFunc("DELETE /api/limit/host/{host}", cfg.HandleDeleteHostLimit)
+	mux.HandleFunc("GET /api/seed", cfg.HandleGetSeeds)
+	mux.HandleFunc("POST /api/seed", cfg.HandlePostSeed)
+	mux.HandleFunc("POST /api/seed/{id}/pause", cfg.HandlePauseSeed)
+	mux.HandleFunc("POST /api/seed/{id}/resume", cfg.HandleResumeSeed)
+	mux.HandleFunc("DELETE /api/seed/{id}", cfg.HandleDeleteSeed)
+	mux.HandleFunc("POST /api/crawl", cfg.HandlePostCrawl)
+	mux.HandleFunc("GET /api/crawl/{id}", cfg.HandleGetCrawl)
+	return WithRequestID(mux)
+}
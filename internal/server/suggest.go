@@ -0,0 +1,90 @@
+package server
+
+import (
+	"github.com/evok02/jcrawler/internal/index"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	SuggestionQuery = "query"
+	SuggestionTitle = "title"
+)
+
+// MIN_SUGGEST_COUNT is how often a search has to be run before it is
+// suggested to others, so a query only one person typed is not shown.
+const MIN_SUGGEST_COUNT = 3
+
+type Suggestion struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+	// ID and URL are set for titles, which lead straight to their page.
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url,omitempty"`
+}
+
+type SuggestResponse struct {
+	Query       string        `json:"query"`
+	Suggestions []*Suggestion `json:"suggestions"`
+	DidYouMean  string        `json:"did_you_mean,omitempty"`
+}
+
+// normalizeQuery is the form queries are counted and completed in.
+func normalizeQuery(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
+
+// recordQuery counts a search that found something, so it can be
+// suggested to others. Only first pages count, paging through the results
+// is still one search. A failed count must not fail the search.
+func (cfg *ApiConfig) recordQuery(req *index.SearchRequest, res *index.SearchResult) {
+	if res.Total == 0 || req.From != 0 || req.After != "" {
+		return
+	}
+	if q := normalizeQuery(req.Query); q != "" {
+		cfg.store.RecordQuery(q, time.Now())
+	}
+}
+
+// HandleGetSuggest completes a partly typed query, with the most popular
+// searches that start with it first and matching page titles after them.
+// With a search index configured, queries with few hits also get a
+// spelling correction. An empty query lists the most popular searches.
+func (cfg *ApiConfig) HandleGetSuggest(w http.ResponseWriter, r *http.Request) {
+	q := normalizeQuery(r.URL.Query().Get("q"))
+	res := &SuggestResponse{Query: q, Suggestions: []*Suggestion{}}
+	seen := make(map[string]bool)
+	add := func(s *Suggestion) {
+		key := strings.ToLower(s.Text)
+		if len(res.Suggestions) < index.SUGGEST_SIZE && !seen[key] {
+			seen[key] = true
+			res.Suggestions = append(res.Suggestions, s)
+		}
+	}
+
+	popular, err := cfg.store.PopularQueries(q, MIN_SUGGEST_COUNT, index.SUGGEST_SIZE)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	for _, p := range popular {
+		add(&Suggestion{Text: p.Query, Kind: SuggestionQuery})
+	}
+
+	if cfg.index != nil && q != "" {
+		s, err := cfg.index.Suggest(r.Context(), q, index.SUGGEST_SIZE)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		for _, t := range s.Titles {
+			add(&Suggestion{Text: t.Title, Kind: SuggestionTitle, ID: t.ID, URL: t.URL})
+		}
+		res.DidYouMean = s.Correction
+	}
+
+	// Suggestions are asked for on every keystroke and may lag a little.
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	WriteJSON(w, res)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/diff"
+	"net/http"
+	"strconv"
+)
+
+const DIFF_CONTEXT = 3
+
+var ERROR_INVALID_VERSION = errors.New("version should be a positive number")
+var ERROR_NO_VERSIONS = errors.New("page has no stored versions")
+
+type pageDiff struct {
+	ID   string `json:"id"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+func (cfg *ApiConfig) HandleGetVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := cfg.store.GetVersions(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, &versions)
+}
+
+func parseVersion(r *http.Request, key string, def int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		return 0, ERROR_INVALID_VERSION
+	}
+	return v, nil
+}
+
+// HandleGetDiff compares two versions of a page. Without from and to it
+// shows what the latest version changed.
+func (cfg *ApiConfig) HandleGetDiff(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	versions, err := cfg.store.GetVersions(id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if len(versions) == 0 {
+		WriteError(w, r, ERROR_NO_VERSIONS)
+		return
+	}
+	latest := versions[len(versions)-1].Version
+
+	to, err := parseVersion(r, "to", latest)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	from, err := parseVersion(r, "from", max(to-1, 1))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	fromText, err := cfg.versionText(id, from)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	toText, err := cfg.versionText(id, to)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	WriteJSON(w, &pageDiff{
+		ID:   id,
+		From: from,
+		To:   to,
+		Diff: diff.Unified(fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", to),
+			fromText, toText, DIFF_CONTEXT),
+	})
+}
+
+func (cfg *ApiConfig) versionText(id string, version int) (string, error) {
+	v, err := cfg.store.GetVersion(id, version)
+	if err != nil {
+		return "", err
+	}
+	content, err := v.Content()
+	if err != nil {
+		return "", err
+	}
+	return diff.Sentences(content), nil
+}
@@ -0,0 +1,253 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/evok02/jcrawler/internal/worker"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MAX_SITEMAP_SIZE = 50 << 20
+
+var ERROR_BAD_STATUS = errors.New("unexpected response status")
+var ERROR_UNKNOWN_FORMAT = errors.New("unknown sitemap format")
+
+var lastModLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type URL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   float64
+}
+
+type Sitemap struct {
+	URLs     []*URL
+	Sitemaps []string
+}
+
+type rawURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+type rawURLSet struct {
+	URLs []rawURL `xml:"url"`
+}
+
+type rawIndex struct {
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+func Parse(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(io.LimitReader(r, MAX_SITEMAP_SIZE))
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("Parse: %s", err.Error())
+		}
+		defer gz.Close()
+		br = bufio.NewReader(io.LimitReader(gz, MAX_SITEMAP_SIZE))
+	}
+
+	dec := xml.NewDecoder(br)
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ERROR_UNKNOWN_FORMAT
+			}
+			return nil, fmt.Errorf("Parse: %s", err.Error())
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "urlset":
+			return decodeURLSet(dec, &start)
+		case "sitemapindex":
+			return decodeIndex(dec, &start)
+		default:
+			return nil, ERROR_UNKNOWN_FORMAT
+		}
+	}
+}
+
+func decodeURLSet(dec *xml.Decoder, start *xml.StartElement) (*Sitemap, error) {
+	var raw rawURLSet
+	if err := dec.DecodeElement(&raw, start); err != nil {
+		return nil, fmt.Errorf("decodeURLSet: %s", err.Error())
+	}
+	sm := &Sitemap{}
+	for _, u := range raw.URLs {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		sm.URLs = append(sm.URLs, &URL{
+			Loc:        loc,
+			LastMod:    parseLastMod(u.LastMod),
+			ChangeFreq: strings.ToLower(strings.TrimSpace(u.ChangeFreq)),
+			Priority:   parsePriority(u.Priority),
+		})
+	}
+	return sm, nil
+}
+
+func decodeIndex(dec *xml.Decoder, start *xml.StartElement) (*Sitemap, error) {
+	var raw rawIndex
+	if err := dec.DecodeElement(&raw, start); err != nil {
+		return nil, fmt.Errorf("decodeIndex: %s", err.Error())
+	}
+	sm := &Sitemap{}
+	for _, s := range raw.Sitemaps {
+		if loc := strings.TrimSpace(s.Loc); loc != "" {
+			sm.Sitemaps = append(sm.Sitemaps, loc)
+		}
+	}
+	return sm, nil
+}
+
+func parseLastMod(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func parsePriority(s string) float64 {
+	p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0.5
+	}
+	return p
+}
+
+func ParseRobots(r io.Reader) []string {
+	var sitemaps []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			continue
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			sitemaps = append(sitemaps, value)
+		}
+	}
+	return sitemaps
+}
+
+type Collector struct {
+	worker   *worker.Worker
+	timeout  time.Duration
+	maxDepth int
+	maxURLs  int
+}
+
+func NewCollector(w *worker.Worker, timeout time.Duration, maxDepth, maxURLs int) *Collector {
+	return &Collector{
+		worker:   w,
+		timeout:  timeout,
+		maxDepth: maxDepth,
+		maxURLs:  maxURLs,
+	}
+}
+
+func (c *Collector) fetch(ctx context.Context, loc string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	res, err := c.worker.Fetch(ctx, loc)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Response.Body.Close()
+	if res.Response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ERROR_BAD_STATUS, res.Response.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Response.Body, MAX_SITEMAP_SIZE))
+}
+
+func (c *Collector) Discover(ctx context.Context, seed string) ([]string, error) {
+	u, err := url.Parse(seed)
+	if err != nil {
+		return nil, fmt.Errorf("Discover: %s", err.Error())
+	}
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host}
+
+	robots, err := c.fetch(ctx, root.JoinPath("robots.txt").String())
+	if err == nil {
+		if found := ParseRobots(bytes.NewReader(robots)); len(found) > 0 {
+			return found, nil
+		}
+	}
+	return []string{root.JoinPath("sitemap.xml").String()}, nil
+}
+
+// Collect walks every sitemap discovered for seed, following sitemap
+// indexes up to maxDepth, and hands each page entry to fn.
+func (c *Collector) Collect(ctx context.Context, seed string, fn func(*URL)) error {
+	locs, err := c.Discover(ctx, seed)
+	if err != nil {
+		return fmt.Errorf("Collect: %s", err.Error())
+	}
+
+	visited := make(map[string]struct{})
+	found := 0
+	for depth := 0; depth <= c.maxDepth && len(locs) > 0; depth++ {
+		var next []string
+		for _, loc := range locs {
+			if _, ok := visited[loc]; ok {
+				continue
+			}
+			visited[loc] = struct{}{}
+
+			body, err := c.fetch(ctx, loc)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				continue
+			}
+			sm, err := Parse(bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			next = append(next, sm.Sitemaps...)
+			for _, u := range sm.URLs {
+				if c.maxURLs > 0 && found >= c.maxURLs {
+					return nil
+				}
+				fn(u)
+				found++
+			}
+		}
+		locs = next
+	}
+	return nil
+}
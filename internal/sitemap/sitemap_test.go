@@ -0,0 +1,86 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+const urlSetXML = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com/</loc>
+    <lastmod>2024-05-01</lastmod>
+    <changefreq>Daily</changefreq>
+    <priority>0.8</priority>
+  </url>
+  <url>
+    <loc> https://example.com/about </loc>
+    <priority>7</priority>
+  </url>
+  <url>
+    <loc></loc>
+  </url>
+</urlset>`
+
+const indexXML = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-1.xml.gz</loc></sitemap>
+  <sitemap><loc>https://example.com/sitemap-2.xml</loc></sitemap>
+</sitemapindex>`
+
+func TestParseURLSet(t *testing.T) {
+	sm, err := Parse(strings.NewReader(urlSetXML))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sm.URLs))
+	assert.Equal(t, 0, len(sm.Sitemaps))
+
+	assert.Equal(t, "https://example.com/", sm.URLs[0].Loc)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), sm.URLs[0].LastMod)
+	assert.Equal(t, "daily", sm.URLs[0].ChangeFreq)
+	assert.Equal(t, 0.8, sm.URLs[0].Priority)
+
+	// Test: out of range priority falls back to the protocol default
+	assert.Equal(t, "https://example.com/about", sm.URLs[1].Loc)
+	assert.Equal(t, 0.5, sm.URLs[1].Priority)
+	assert.True(t, sm.URLs[1].LastMod.IsZero())
+}
+
+func TestParseIndex(t *testing.T) {
+	sm, err := Parse(strings.NewReader(indexXML))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(sm.URLs))
+	assert.Equal(t, []string{
+		"https://example.com/sitemap-1.xml.gz",
+		"https://example.com/sitemap-2.xml",
+	}, sm.Sitemaps)
+}
+
+func TestParseGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(urlSetXML))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	sm, err := Parse(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(sm.URLs))
+}
+
+func TestParseUnknown(t *testing.T) {
+	_, err := Parse(strings.NewReader("<html><body></body></html>"))
+	assert.ErrorIs(t, err, ERROR_UNKNOWN_FORMAT)
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := "User-agent: *\nDisallow: /private\nSitemap: https://example.com/sitemap.xml\nsitemap:https://example.com/news.xml\n"
+	assert.Equal(t, []string{
+		"https://example.com/sitemap.xml",
+		"https://example.com/news.xml",
+	}, ParseRobots(strings.NewReader(robots)))
+}
@@ -0,0 +1,386 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const VERSION = "WARC/1.1"
+const CDX_HEADER = " CDX N b a m s k r M S V g"
+const CDX_FILE = "index.cdx"
+
+// MAX_RECORD_BODY caps how much of a response body is archived. Longer
+// bodies are cut and marked with WARC-Truncated.
+const MAX_RECORD_BODY = 32 << 20
+
+var ERROR_MALFORMED_RECORD = errors.New("malformed warc record")
+var ERROR_WRITER_CLOSED = errors.New("warc writer is closed")
+
+type Record struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *Record) TargetURI() string {
+	return r.Header.Get("WARC-Target-URI")
+}
+
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func digest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func (r *Record) encode(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(VERSION + "\r\n")
+	keys := []string{"WARC-Type", "WARC-Record-ID", "WARC-Date", "WARC-Target-URI"}
+	written := map[string]bool{}
+	for _, k := range keys {
+		if v := r.Header.Get(k); v != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+			written[k] = true
+		}
+	}
+	for k, values := range r.Header {
+		if written[k] || k == "Content-Length" {
+			continue
+		}
+		for _, v := range values {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+		}
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(r.Block))
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Writer appends records to gzip-compressed WARC files in a directory.
+// Every record is its own gzip member, so a CDX offset can be read
+// without decompressing the file from the start. Files are rotated once
+// they grow past maxSize.
+type Writer struct {
+	mu      sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64
+	seq     int
+	file    *os.File
+	name    string
+	out     *countingWriter
+	cdx     *os.File
+	closed  bool
+}
+
+func NewWriter(dir, prefix string, maxSize int64) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("NewWriter: %s", err.Error())
+	}
+	cdxPath := filepath.Join(dir, CDX_FILE)
+	_, statErr := os.Stat(cdxPath)
+	cdx, err := os.OpenFile(cdxPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("NewWriter: %s", err.Error())
+	}
+	if os.IsNotExist(statErr) {
+		if _, err := cdx.WriteString(CDX_HEADER + "\n"); err != nil {
+			cdx.Close()
+			return nil, fmt.Errorf("NewWriter: %s", err.Error())
+		}
+	}
+	return &Writer{dir: dir, prefix: prefix, maxSize: maxSize, cdx: cdx}, nil
+}
+
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	w.seq++
+	w.name = fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix,
+		time.Now().UTC().Format("20060102150405"), w.seq)
+	f, err := os.OpenFile(filepath.Join(w.dir, w.name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.out = &countingWriter{w: f}
+
+	info := &Record{Header: textproto.MIMEHeader{}}
+	info.Header.Set("WARC-Type", "warcinfo")
+	info.Header.Set("WARC-Record-ID", newRecordID())
+	info.Header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	info.Header.Set("WARC-Filename", w.name)
+	info.Header.Set("Content-Type", "application/warc-fields")
+	info.Block = []byte("software: jcrawler\r\nformat: WARC File Format 1.1\r\n")
+	_, err = w.writeMember(info)
+	return err
+}
+
+func (w *Writer) writeMember(r *Record) (int64, error) {
+	offset := w.out.n
+	zw := gzip.NewWriter(w.out)
+	if err := r.encode(zw); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+func requestHead(req *http.Request) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.URL.Host)
+	req.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// responseHead serializes the status line and headers. The body is stored
+// decoded, so the framing headers are replaced by the archived length.
+func responseHead(res *http.Response, length int) ([]byte, error) {
+	var buf bytes.Buffer
+	proto := res.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	status := res.Status
+	if status == "" {
+		status = strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode)
+	}
+	fmt.Fprintf(&buf, "%s %s\r\n", proto, status)
+	header := res.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(length))
+	if err := header.Write(&buf); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// WriteExchange archives a request and its response as a pair of
+// concurrent records. body is the response body, which the caller has
+// already read from res.
+func (w *Writer) WriteExchange(res *http.Response, body []byte) error {
+	reqBlock := requestHead(res.Request)
+	resHead, err := responseHead(res, len(body))
+	if err != nil {
+		return fmt.Errorf("WriteExchange: %s", err.Error())
+	}
+
+	now := time.Now().UTC()
+	uri := res.Request.URL.String()
+	responseID := newRecordID()
+	truncated := len(body) > MAX_RECORD_BODY
+	if truncated {
+		body = body[:MAX_RECORD_BODY]
+		if resHead, err = responseHead(res, len(body)); err != nil {
+			return fmt.Errorf("WriteExchange: %s", err.Error())
+		}
+	}
+
+	response := &Record{Header: textproto.MIMEHeader{}}
+	response.Header.Set("WARC-Type", "response")
+	response.Header.Set("WARC-Record-ID", responseID)
+	response.Header.Set("WARC-Date", now.Format(time.RFC3339))
+	response.Header.Set("WARC-Target-URI", uri)
+	response.Header.Set("Content-Type", "application/http;msgtype=response")
+	response.Header.Set("WARC-Payload-Digest", digest(body))
+	if truncated {
+		response.Header.Set("WARC-Truncated", "length")
+	}
+	response.Block = append(resHead, body...)
+	response.Header.Set("WARC-Block-Digest", digest(response.Block))
+
+	request := &Record{Header: textproto.MIMEHeader{}}
+	request.Header.Set("WARC-Type", "request")
+	request.Header.Set("WARC-Record-ID", newRecordID())
+	request.Header.Set("WARC-Date", now.Format(time.RFC3339))
+	request.Header.Set("WARC-Target-URI", uri)
+	request.Header.Set("WARC-Concurrent-To", responseID)
+	request.Header.Set("Content-Type", "application/http;msgtype=request")
+	request.Block = reqBlock
+	request.Header.Set("WARC-Block-Digest", digest(request.Block))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ERROR_WRITER_CLOSED
+	}
+	if w.file == nil || w.out.n >= w.maxSize {
+		if err := w.rotate(); err != nil {
+			return fmt.Errorf("WriteExchange: %s", err.Error())
+		}
+	}
+	offset, err := w.writeMember(response)
+	if err != nil {
+		return fmt.Errorf("WriteExchange: %s", err.Error())
+	}
+	length := w.out.n - offset
+	if _, err := w.writeMember(request); err != nil {
+		return fmt.Errorf("WriteExchange: %s", err.Error())
+	}
+
+	mime := res.Header.Get("Content-Type")
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	if mime == "" {
+		mime = "-"
+	}
+	_, err = fmt.Fprintf(w.cdx, "%s %s %s %s %d %s - - %d %d %s\n",
+		SURT(res.Request.URL.String()), now.Format("20060102150405"), uri, mime,
+		res.StatusCode, strings.TrimPrefix(digest(body), "sha1:"), length, offset, w.name)
+	if err != nil {
+		return fmt.Errorf("WriteExchange: %s", err.Error())
+	}
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+	}
+	return errors.Join(err, w.cdx.Close())
+}
+
+// SURT turns a URL into the sort-friendly form used as the CDX key:
+// reversed host, comma separated, followed by the path and query.
+func SURT(raw string) string {
+	s := strings.ToLower(raw)
+	s = strings.TrimPrefix(s, "http://")
+	s = strings.TrimPrefix(s, "https://")
+	host, rest, _ := strings.Cut(s, "/")
+	host, port, hasPort := strings.Cut(strings.TrimPrefix(host, "www."), ":")
+	parts := strings.Split(host, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	key := strings.Join(parts, ",")
+	if hasPort {
+		key += ":" + port
+	}
+	return key + ")/" + rest
+}
+
+// Reader reads records from a gzip-compressed WARC stream.
+type Reader struct {
+	br *bufio.Reader
+	zr *gzip.Reader
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("NewReader: %s", err.Error())
+	}
+	return &Reader{br: bufio.NewReader(zr), zr: zr}, nil
+}
+
+// ReadRecord returns the next record, or io.EOF after the last one.
+func (r *Reader) ReadRecord() (*Record, error) {
+	tp := textproto.NewReader(r.br)
+	version, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, ERROR_MALFORMED_RECORD
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("ReadRecord: %s", err.Error())
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, ERROR_MALFORMED_RECORD
+	}
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r.br, block); err != nil {
+		return nil, fmt.Errorf("ReadRecord: %s", err.Error())
+	}
+	var trailer [4]byte
+	if _, err := io.ReadFull(r.br, trailer[:]); err != nil || string(trailer[:]) != "\r\n\r\n" {
+		return nil, ERROR_MALFORMED_RECORD
+	}
+	return &Record{Header: header, Block: block}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.zr.Close()
+}
+
+// Response rebuilds the HTTP response stored in a response record.
+func (r *Record) Response() (*http.Response, error) {
+	if r.Type() != "response" {
+		return nil, ERROR_MALFORMED_RECORD
+	}
+	req, err := http.NewRequest("GET", r.TargetURI(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Response: %s", err.Error())
+	}
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), req)
+	if err != nil {
+		return nil, fmt.Errorf("Response: %s", err.Error())
+	}
+	return res, nil
+}
+
+// Files lists the WARC files in dir in the order they were written.
+func Files(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil {
+		return nil, fmt.Errorf("Files: %s", err.Error())
+	}
+	return files, nil
+}
@@ -0,0 +1,116 @@
+package warc
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testResponse(t *testing.T, link, body string) *http.Response {
+	req, err := http.NewRequest("GET", link, nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "jcrawler")
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Request:    req,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, "test", 1<<20)
+	require.NoError(t, err)
+	body := "<html><title>Hi</title></html>"
+	require.NoError(t, w.WriteExchange(testResponse(t, "https://www.example.com/a?b=1", body), []byte(body)))
+	require.NoError(t, w.Close())
+
+	files, err := Files(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := NewReader(f)
+	require.NoError(t, err)
+
+	types := []string{}
+	var response *Record
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, rec.Type())
+		if rec.Type() == "response" {
+			response = rec
+		}
+	}
+	assert.Equal(t, []string{"warcinfo", "response", "request"}, types)
+
+	res, err := response.Response()
+	require.NoError(t, err)
+	got, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "https://www.example.com/a?b=1", res.Request.URL.String())
+}
+
+func TestCDXOffset(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, "test", 1)
+	require.NoError(t, err)
+	for _, link := range []string{"https://a.com/", "https://b.com/x"} {
+		require.NoError(t, w.WriteExchange(testResponse(t, link, link), []byte(link)))
+	}
+	require.NoError(t, w.Close())
+
+	// Test: every exchange went to a new file once the size limit was hit
+	files, err := Files(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+
+	cdx, err := os.ReadFile(filepath.Join(dir, CDX_FILE))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimRight(string(cdx), "\n"), "\n")
+	require.Equal(t, 3, len(lines))
+	assert.Equal(t, CDX_HEADER, lines[0])
+
+	fields := strings.Fields(lines[2])
+	require.Equal(t, 11, len(fields))
+	assert.Equal(t, "com,b)/x", fields[0])
+	length, err := strconv.ParseInt(fields[8], 10, 64)
+	require.NoError(t, err)
+	offset, err := strconv.ParseInt(fields[9], 10, 64)
+	require.NoError(t, err)
+
+	// Test: the offset and length point at the response record alone
+	data, err := os.ReadFile(filepath.Join(dir, fields[10]))
+	require.NoError(t, err)
+	r, err := NewReader(bytes.NewReader(data[offset : offset+length]))
+	require.NoError(t, err)
+	rec, err := r.ReadRecord()
+	require.NoError(t, err)
+	assert.Equal(t, "response", rec.Type())
+	assert.Equal(t, "https://b.com/x", rec.TargetURI())
+	_, err = r.ReadRecord()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSURT(t *testing.T) {
+	assert.Equal(t, "com,example)/a?b=1", SURT("https://www.Example.com/a?b=1"))
+	assert.Equal(t, "1,0,0,127:8080)/", SURT("http://127.0.0.1:8080/"))
+}
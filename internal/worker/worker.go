@@ -55,10 +55,19 @@ func NewWorker(delay, timeout time.Duration) *Worker {
 }
 
 func (w *Worker) Fetch(ctx context.Context, url string) (*FetchResponse, error) {
+	return w.FetchWithHeader(ctx, url, nil)
+}
+
+func (w *Worker) FetchWithHeader(ctx context.Context, url string, header http.Header) (*FetchResponse, error) {
 	req, err := w.createReqeust(url)
 	if err != nil {
 		return nil, fmt.Errorf("Fetch %s", err)
 	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
 	resChan, errChan := w.sendRequest(req)
 	for {
 		select {